@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"main/pkg/constraint"
+	"main/pkg/pgdump"
+	"main/pkg/report"
+	"main/pkg/sqlfile"
+
+	"github.com/spf13/cobra"
+)
+
+var analyzeSQLCmd = &cobra.Command{
+	Use:   "analyze-sql [file or directory]...",
+	Short: "Report the column order of the tables that CREATE TABLE and ALTER TABLE statements define, without a database",
+	Long: `Reads CREATE TABLE and ALTER TABLE statements from SQL files, the .sql files of
+directories in name order, pg_dump custom-format archives, or stdin when no file or "-"
+is given, and reports the tables they leave behind as the root command reports a schema.
+Types are resolved with the built-in types of PostgreSQL and the types the input creates.
+There are no statistics, so variable-length values count as unaligned 1-byte headers
+followed by data of unknown length, or aligned 4-byte headers for plain storage, and
+tables are empty unless an archive holds their data.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		resolveThroughput(cmd.Flags())
+		analyzeSQL(args, cmd.Flags().Changed("schema"))
+	},
+}
+
+var countRows bool
+
+func init() {
+	analyzeSQLCmd.Flags().BoolVar(&countRows, "count-rows", true, "Count the rows and non-NULL entries of tables from the data of pg_dump archives")
+	addReportFlags(analyzeSQLCmd.Flags())
+	rootCmd.AddCommand(analyzeSQLCmd)
+}
+
+// analyzeSQL reports every table the inputs define, or those in --schema when it is
+// given and the one named by --table.
+func analyzeSQL(inputs []string, filterSchema bool) {
+	constraints, err := loadConstraints()
+	if err != nil {
+		log.Fatalf("Failed to load ordering constraints: %v", err)
+	}
+
+	files, err := sqlFiles(inputs)
+	if err != nil {
+		log.Fatalf("Failed to list SQL files: %v", err)
+	}
+
+	catalog := sqlfile.NewCatalog()
+	counts := make(map[string]pgdump.TableCount)
+	for _, file := range files {
+		name := file
+		if file == "-" {
+			name = "stdin"
+		}
+		content, err := readInput(file, name, counts)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if err := catalog.Parse(name, content); err != nil {
+			log.Fatalf("Failed to parse SQL: %v", err)
+		}
+	}
+
+	source := strings.Join(inputs, ", ")
+	if len(inputs) == 0 || (len(inputs) == 1 && inputs[0] == "-") {
+		source = "stdin"
+	}
+	reportCatalog(catalog, source, constraints, filterSchema, counts)
+}
+
+// readInput returns the SQL of file, which "-" names stdin for. A pg_dump custom-format
+// archive is read as pg_restore --schema-only would print it, and unless --count-rows is
+// off, the rows of its tables are counted into counts by qualified table name.
+func readInput(file string, name string, counts map[string]pgdump.TableCount) (string, error) {
+	input := os.Stdin
+	if file != "-" {
+		opened, err := os.Open(file)
+		if err != nil {
+			return "", err
+		}
+		defer opened.Close()
+		input = opened
+	}
+
+	reader := bufio.NewReader(input)
+	if magic, _ := reader.Peek(len(pgdump.Magic)); string(magic) != pgdump.Magic {
+		content, err := io.ReadAll(reader)
+		return string(content), err
+	}
+
+	archive, err := pgdump.Read(reader)
+	if err != nil {
+		return "", err
+	}
+	if countRows {
+		err := archive.Data(func(entry pgdump.Entry, data io.Reader) error {
+			if entry.CopyStatement == "" {
+				return nil
+			}
+			count, err := pgdump.CountCopy(entry.CopyStatement, data)
+			if err != nil {
+				return fmt.Errorf("failed to count the rows of %s.%s: %w", entry.Namespace, entry.Tag, err)
+			}
+			counts[entry.Namespace+"."+entry.Tag] = count
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Row counts of %s are not available: %v\n", name, err)
+		}
+	}
+	return archive.Schema(), nil
+}
+
+// reportCatalog reports every table of catalog, or those in --schema when filterSchema
+// is set and the one named by --table. source names the input in the report. Tables
+// with counts, by qualified name, get their row and entry counts and null fractions from
+// them in place of the statistics a database would have.
+func reportCatalog(catalog *sqlfile.Catalog, source string, constraints constraint.Set, filterSchema bool, counts map[string]pgdump.TableCount) {
+	var tables []sqlfile.Table
+	var schemas []string
+	seen := make(map[string]bool)
+	for _, definition := range catalog.Tables() {
+		if (filterSchema && definition.Schema != schemaName) || (table != "" && definition.Info.Name != table) {
+			continue
+		}
+		tables = append(tables, definition)
+		if !seen[definition.Schema] {
+			seen[definition.Schema] = true
+			schemas = append(schemas, definition.Schema)
+		}
+	}
+	if len(tables) == 0 {
+		log.Fatal("The input defines no table to report")
+	}
+
+	run := report.Run{Database: source, Schema: strings.Join(schemas, ", ")}
+	writer, err := report.NewWriter(format, output, run, report.SummaryOptions{Top: top, MinSavings: minSavings})
+	if err != nil {
+		log.Fatalf("Failed to configure report output: %v", err)
+	}
+
+	for _, definition := range tables {
+		if count, found := counts[definition.Schema+"."+definition.Info.Name]; found {
+			applyCount(&definition, count)
+		}
+		options := layoutOptions(definition.Info.Name, definition.Columns, constraints)
+		reportTable(definition.Schema, definition.Columns, definition.Info, options, writer)
+		printAppended(definition)
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+}
+
+func applyCount(definition *sqlfile.Table, count pgdump.TableCount) {
+	definition.Info.RowCount = count.Rows
+	for i := range definition.Columns {
+		col := &definition.Columns[i]
+		nonNull, found := count.NonNull[col.ColumnName]
+		if !found {
+			continue
+		}
+		col.EntryCount = nonNull
+		if count.Rows > 0 {
+			col.NullFrac = 1 - float64(nonNull)/float64(count.Rows)
+		}
+	}
+}
+
+// printAppended lists the columns that ALTER TABLE appended to a table, in table order,
+// with the file that appended each.
+func printAppended(definition sqlfile.Table) {
+	var appended []string
+	for _, col := range definition.Columns {
+		if file, found := definition.Appended[col.ColumnName]; found {
+			appended = append(appended, fmt.Sprintf("%s (%s)", col.ColumnName, file))
+		}
+	}
+	if len(appended) > 0 {
+		fmt.Printf("Table %s: columns appended by ALTER TABLE: %s\n", definition.Info.Name, strings.Join(appended, ", "))
+	}
+}
+
+// sqlFiles expands the inputs into the files to read, with directories replaced by their
+// .sql files in name order, so that numbered migrations are applied in sequence. No
+// input reads stdin, which "-" stands for.
+func sqlFiles(inputs []string) ([]string, error) {
+	if len(inputs) == 0 {
+		return []string{"-"}, nil
+	}
+
+	var files []string
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if input == "-" || (err == nil && !info.IsDir()) {
+			files = append(files, input)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		matches, err := filepath.Glob(filepath.Join(input, "*.sql"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
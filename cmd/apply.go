@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"main/pkg/apply"
+	"main/pkg/db"
+	"main/pkg/ddl"
+	"main/pkg/migration"
+	"main/pkg/report"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statementTimeout  string
+	maxReplicationLag int64
+	maxTransactionAge time.Duration
+	assumeYes         bool
+
+	applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Rebuild a table in the recommended column order on the database, in resumable batches",
+		Run: func(cmd *cobra.Command, arg []string) {
+			applyMigration()
+		},
+	}
+)
+
+func init() {
+	applyCmd.Flags().StringVar(&planDir, "plan-dir", "migrations", "Directory the rollback script is written to")
+	applyCmd.Flags().IntVar(&batchSize, "batch-size", migration.DefaultBatchSize, "Rows copied per transaction, in primary key order")
+	applyCmd.Flags().StringVar(&lockTimeout, "lock-timeout", apply.DefaultLockTimeout, "lock_timeout for every statement, including the swap")
+	applyCmd.Flags().StringVar(&statementTimeout, "statement-timeout", apply.DefaultStatementTimeout, "statement_timeout for every statement, including the index builds")
+	applyCmd.Flags().Int64Var(&maxReplicationLag, "max-replication-lag", 64<<20, "Abort when a replica lags further behind than this many bytes (0 disables the check)")
+	applyCmd.Flags().DurationVar(&maxTransactionAge, "max-transaction-age", 5*time.Minute, "Abort while another transaction has been open longer than this (0 disables the check)")
+	applyCmd.Flags().BoolVar(&assumeYes, "yes", false, "Do not ask for confirmation")
+	applyCmd.Flags().StringVar(&throughputFile, "throughput-file", "", "Save the measured copy and index build rates to this file, for the maintenance estimate of later reports on the same server")
+	rootCmd.AddCommand(applyCmd)
+}
+
+func applyMigration() {
+	if table == "" {
+		log.Fatal("The apply command rebuilds a single table, pass it with --table")
+	}
+
+	connection, err := db.ConnectForWrites(db.Config{
+		DBName:   dbName,
+		UserName: userName,
+		Password: password,
+		Host:     host,
+		Schema:   schemaName,
+		Port:     port,
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer connection.Close()
+
+	constraints, err := loadConstraints()
+	if err != nil {
+		log.Fatalf("Failed to load ordering constraints: %v", err)
+	}
+
+	source := liveCatalog{connection: connection, exactCounts: exactCounts}
+	columnList, tableInfo, options := loadTable(source, schemaName, table, constraints)
+	if err := source.TableObjects(schemaName, &tableInfo); err != nil {
+		log.Fatalf("Failed to fetch indexes, grants and triggers of table %s: %v", table, err)
+	}
+
+	tableReport, err := report.BuildTableReport(columnList, tableInfo, options)
+	if err != nil {
+		log.Fatalf("Failed to compute recommended order for table %s: %v", table, err)
+	}
+
+	order := tableReport.RecommendedOrder
+	if tableReport.ConstrainedOrder != nil {
+		order = tableReport.ConstrainedOrder
+	}
+
+	// A run interrupted after the swap leaves the table in the recommended order, but its
+	// foreign keys and materialized views still to be finished, so the progress table
+	// decides whether there is anything to do.
+	phase, err := apply.Phase(context.Background(), connection, migration.ProgressTable(schemaName, tableInfo.Name))
+	if err != nil {
+		log.Fatalf("Failed to look up the progress of table %s: %v", table, err)
+	}
+
+	if phase == "" && inCurrentOrder(columnList, order) {
+		fmt.Printf("Table %s is already in the recommended order, nothing to apply.\n", table)
+		return
+	}
+
+	steps, err := migration.NewSteps(schemaName, tableInfo, ddl.ReorderByName(columnList, order), migration.Options{BatchSize: batchSize, LockTimeout: lockTimeout})
+	if err != nil {
+		log.Fatalf("Failed to plan the rebuild of table %s: %v", table, err)
+	}
+
+	// A resumed run keeps the rollback script and the confirmation of the run it continues.
+	if phase == "" {
+		if err := os.MkdirAll(planDir, 0o755); err != nil {
+			log.Fatalf("Failed to create plan directory: %v", err)
+		}
+		writeScript(filepath.Join(planDir, fmt.Sprintf("%s_rollback.sql", table)), steps.Rollback)
+
+		if !assumeYes && !confirm(steps, order) {
+			fmt.Println("Aborted, nothing was changed.")
+			return
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Session settings only hold on one connection, so the whole run uses the same one.
+	conn, err := connection.Conn(ctx)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer conn.Close()
+
+	err = apply.Run(ctx, conn, steps, apply.Options{
+		LockTimeout:       lockTimeout,
+		StatementTimeout:  statementTimeout,
+		MaxReplicationLag: maxReplicationLag,
+		MaxTransactionAge: maxTransactionAge,
+		ThroughputFile:    throughputFile,
+	}, os.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to rebuild table %s: %v. Run apply again to resume.", table, err)
+	}
+}
+
+// confirm asks for the table name before anything is written, as the rebuild only stays
+// consistent while nothing else writes to the table.
+func confirm(steps migration.Steps, order []string) bool {
+	fmt.Printf("This rebuilds %s into %s with its columns in the order: %s.\n", steps.Table, steps.NewTable, strings.Join(order, ", "))
+	fmt.Printf("Writes to %s must be stopped until the tables are swapped.\n", steps.Table)
+	fmt.Printf("Type the table name to continue: ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(answer) == table
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"main/pkg/blame"
+	"main/pkg/common"
+	"main/pkg/sqlfile"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	schemaFile string
+
+	blameCmd = &cobra.Command{
+		Use:   "blame",
+		Short: "Attribute the padding of each table to the migration or commit that introduced it",
+		Long: `Computes the layout of every table after each migration of --migrations-dir, or after
+each commit of --schema-file in its git history, and prints per table the steps that
+changed its layout, with the padding per tuple they left and the columns whose padding
+they increased. Only tables whose padding went up at some step are listed, unless
+--table names one.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			blameLayouts(cmd.Flags().Changed("schema"))
+		},
+	}
+)
+
+func init() {
+	blameCmd.Flags().StringVar(&framework, "framework", "", "Migration framework: goose, golang-migrate, flyway or sqitch (default told from the file names)")
+	blameCmd.Flags().StringVar(&migrationsDir, "migrations-dir", "migrations", "Migrations directory of the framework")
+	blameCmd.Flags().StringVar(&schemaFile, "schema-file", "", "Schema file whose git history to walk instead of a migrations directory")
+	rootCmd.AddCommand(blameCmd)
+}
+
+func blameLayouts(filterSchema bool) {
+	var snapshots []blame.Snapshot
+	if schemaFile != "" {
+		snapshots = schemaFileSnapshots()
+	} else {
+		snapshots = migrationSnapshots()
+	}
+
+	var timelines []blame.Timeline
+	for _, timeline := range blame.Trace(snapshots) {
+		schema, name, _ := strings.Cut(timeline.Table, ".")
+		if (filterSchema && schema != schemaName) || (table != "" && name != table) || (table == "" && !timeline.Grew()) {
+			continue
+		}
+		timelines = append(timelines, timeline)
+	}
+	if len(timelines) == 0 {
+		fmt.Printf("No step increased the padding of a table in %d steps.\n", len(snapshots))
+		return
+	}
+
+	if err := blame.Write(os.Stdout, timelines); err != nil {
+		log.Fatalf("Failed to write timeline: %v", err)
+	}
+}
+
+// migrationSnapshots replays the migrations of --migrations-dir and takes the tables
+// after each of them.
+func migrationSnapshots() []blame.Snapshot {
+	_, files := readMigrations()
+
+	var snapshots []blame.Snapshot
+	catalog := sqlfile.NewCatalog()
+	for _, file := range files {
+		if err := catalog.Parse(filepath.Join(migrationsDir, filepath.FromSlash(file.Path)), file.Content); err != nil {
+			log.Fatalf("Failed to replay migrations: %v", err)
+		}
+		snapshots = append(snapshots, tableSnapshot(file.Path, catalog))
+	}
+	return snapshots
+}
+
+// schemaFileSnapshots reads --schema-file as each commit that changed it left it, oldest
+// first. A version that cannot be parsed is skipped with a notice, so that one broken
+// commit does not hide the rest of the history.
+func schemaFileSnapshots() []blame.Snapshot {
+	dir, file := filepath.Split(schemaFile)
+	if dir == "" {
+		dir = "."
+	}
+
+	history, err := git(dir, "log", "--reverse", "--format=%h %s", "--", file)
+	if err != nil {
+		log.Fatalf("Failed to read the git history of %s: %v", schemaFile, err)
+	}
+
+	var snapshots []blame.Snapshot
+	for _, commit := range strings.Split(strings.TrimSpace(history), "\n") {
+		if commit == "" {
+			continue
+		}
+		hash, _, _ := strings.Cut(commit, " ")
+
+		// A commit that deleted the file has no version of it to read.
+		content, err := git(dir, "show", hash+":./"+file)
+		if err != nil {
+			content = ""
+		}
+
+		catalog := sqlfile.NewCatalog()
+		if err := catalog.Parse(schemaFile+"@"+hash, content); err != nil {
+			fmt.Printf("Skipped commit %s: %v\n", hash, err)
+			continue
+		}
+		snapshots = append(snapshots, tableSnapshot(commit, catalog))
+	}
+	return snapshots
+}
+
+func tableSnapshot(step string, catalog *sqlfile.Catalog) blame.Snapshot {
+	tables := make(map[string][]common.ColumnInfo)
+	for _, definition := range catalog.Tables() {
+		tables[definition.Schema+"."+definition.Info.Name] = definition.Columns
+	}
+	return blame.Snapshot{Step: step, Tables: tables}
+}
+
+// git runs a git command in dir and returns its output.
+func git(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	command.Stdout, command.Stderr = &stdout, &stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
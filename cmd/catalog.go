@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+
+	"main/pkg/common"
+	"main/pkg/snapshot"
+
+	"github.com/spf13/pflag"
+)
+
+var fromSnapshot string
+
+// querier is what the introspection queries run on: the connection, or the transaction a
+// snapshot is taken in.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// catalog is where the commands read tables from: the database itself, or a snapshot of
+// it taken earlier by the snapshot command.
+type catalog interface {
+	Tables(schemaName string) ([]string, error)
+	// Table returns the columns of a table, with their entry counts, and its definition
+	// with sizes, constraints and dependent objects.
+	Table(schemaName string, table string) ([]common.ColumnInfo, common.TableInfo, error)
+	// TableObjects adds what a rebuild carries over to the new table beyond its definition.
+	TableObjects(schemaName string, tableInfo *common.TableInfo) error
+	Close() error
+}
+
+// openCatalog opens the snapshot given with --from-snapshot, or connects to the database
+// when there is none. The database and schema of a snapshot stand in for --database and
+// --schema unless those are given.
+func openCatalog(flags *pflag.FlagSet) catalog {
+	if fromSnapshot == "" {
+		return liveCatalog{connection: connect(), exactCounts: exactCounts}
+	}
+
+	s, err := snapshot.Load(fromSnapshot)
+	if err != nil {
+		log.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if !flags.Changed("database") {
+		dbName = s.Database
+	}
+	if !flags.Changed("schema") {
+		schemaName = s.Schema
+	}
+	return snapshotCatalog{snapshot: s}
+}
+
+// addSnapshotFlag registers --from-snapshot, which every command that only reads the
+// catalog takes.
+func addSnapshotFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&fromSnapshot, "from-snapshot", "", "Read the tables from a file the snapshot command wrote instead of connecting to the database")
+}
+
+// liveCatalog reads tables from the database. Row and entry counts are estimated from the
+// statistics unless exactCounts is set, as counting scans every table once per column.
+type liveCatalog struct {
+	connection  querier
+	exactCounts bool
+}
+
+func (c liveCatalog) Tables(schemaName string) ([]string, error) {
+	return fetchTables(c.connection, schemaName)
+}
+
+func (c liveCatalog) Table(schemaName string, table string) ([]common.ColumnInfo, common.TableInfo, error) {
+	columnList, err := fetchColumns(c.connection, schemaName, table)
+	if err != nil {
+		return nil, common.TableInfo{}, err
+	}
+
+	tableInfo, err := fetchTableInfo(c.connection, schemaName, table)
+	if err != nil {
+		return nil, common.TableInfo{}, fmt.Errorf("failed to fetch definition: %w", err)
+	}
+
+	if !c.exactCounts {
+		for i := range columnList {
+			columnList[i].EntryCount = int(math.Round(float64(tableInfo.RowCount) * (1 - columnList[i].NullFrac)))
+		}
+		return columnList, tableInfo, nil
+	}
+
+	if tableInfo.RowCount, err = calculateTotalRows(c.connection, schemaName, table); err != nil {
+		return nil, common.TableInfo{}, err
+	}
+	for i := range columnList {
+		columnList[i].EntryCount, err = calculateTotalEntries(c.connection, schemaName, table, columnList[i].ColumnName)
+		if err != nil {
+			return nil, common.TableInfo{}, err
+		}
+	}
+	return columnList, tableInfo, nil
+}
+
+func (c liveCatalog) TableObjects(schemaName string, tableInfo *common.TableInfo) error {
+	return fetchTableObjects(c.connection, schemaName, tableInfo)
+}
+
+// Close closes the connection. A transaction is left to whoever began it.
+func (c liveCatalog) Close() error {
+	if closer, ok := c.connection.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type snapshotCatalog struct {
+	snapshot *snapshot.Snapshot
+}
+
+func (c snapshotCatalog) Tables(schemaName string) ([]string, error) {
+	if err := c.checkSchema(schemaName); err != nil {
+		return nil, err
+	}
+	return c.snapshot.TableNames(), nil
+}
+
+func (c snapshotCatalog) Table(schemaName string, table string) ([]common.ColumnInfo, common.TableInfo, error) {
+	if err := c.checkSchema(schemaName); err != nil {
+		return nil, common.TableInfo{}, err
+	}
+	captured, found := c.snapshot.Table(table)
+	if !found {
+		return nil, common.TableInfo{}, fmt.Errorf("the snapshot has no table %s", table)
+	}
+	return slices.Clone(captured.Columns), captured.Info, nil
+}
+
+// TableObjects has nothing to add, as the snapshot command captures the objects with the
+// table.
+func (c snapshotCatalog) TableObjects(schemaName string, tableInfo *common.TableInfo) error {
+	return nil
+}
+
+func (c snapshotCatalog) Close() error {
+	return nil
+}
+
+func (c snapshotCatalog) checkSchema(schemaName string) error {
+	if schemaName != c.snapshot.Schema {
+		return fmt.Errorf("the snapshot is of schema %s, not %s", c.snapshot.Schema, schemaName)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"main/pkg/common"
+	"main/pkg/ddl"
+	"main/pkg/dependency"
+)
+
+const (
+	// DependentObjectsQuery walks pg_depend and pg_rewrite for the objects that break or
+	// block a rebuild of the table: views and materialized views, recursively through
+	// other views, rules, functions bound to the table or its row type, functions whose
+	// body selects * from it, inheritance children, partitions and publications.
+	DependentObjectsQuery = `
+		WITH RECURSIVE target AS (
+			SELECT c.oid, c.reltype
+			FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = '%[1]s'
+				AND c.relname = '%[2]s'
+		), views (oid, depth) AS (
+			SELECT oid, 0 FROM target
+			UNION
+			SELECT r.ev_class, v.depth + 1
+			FROM views v
+			JOIN pg_depend d ON d.refclassid = 'pg_class'::regclass AND d.refobjid = v.oid AND d.classid = 'pg_rewrite'::regclass
+			JOIN pg_rewrite r ON r.oid = d.objid AND r.rulename = '_RETURN'
+			WHERE r.ev_class <> v.oid
+		)
+		SELECT CASE c.relkind WHEN 'm' THEN 'materialized view' ELSE 'view' END,
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			pg_get_viewdef(c.oid),
+			pg_get_userbyid(c.relowner),
+			COALESCE(array_to_string(c.reloptions, ', '), ''),
+			max(v.depth)
+		FROM views v
+		JOIN pg_class c ON c.oid = v.oid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE v.depth > 0
+		GROUP BY c.oid, c.relkind, n.nspname, c.relname, c.relowner, c.reloptions
+		UNION ALL
+		SELECT DISTINCT 'rule',
+			quote_ident(r.rulename) || ' ON ' || quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			pg_get_ruledef(r.oid), '', '', 0
+		FROM pg_rewrite r
+		JOIN pg_class c ON c.oid = r.ev_class
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_depend d ON d.classid = 'pg_rewrite'::regclass AND d.objid = r.oid
+		JOIN target t ON d.refclassid = 'pg_class'::regclass AND d.refobjid = t.oid
+		WHERE r.rulename <> '_RETURN'
+		UNION ALL
+		SELECT DISTINCT 'function', p.oid::regprocedure::text, pg_get_functiondef(p.oid), pg_get_userbyid(p.proowner), '', 0
+		FROM pg_proc p
+		JOIN pg_depend d ON d.classid = 'pg_proc'::regclass AND d.objid = p.oid
+		JOIN target t ON (d.refclassid = 'pg_class'::regclass AND d.refobjid = t.oid)
+			OR (d.refclassid = 'pg_type'::regclass AND d.refobjid = t.reltype)
+		WHERE p.prokind IN ('f', 'p')
+		UNION ALL
+		SELECT 'function using *', p.oid::regprocedure::text, '', pg_get_userbyid(p.proowner), '', 0
+		FROM pg_proc p
+		JOIN pg_language l ON l.oid = p.prolang
+		WHERE l.lanname IN ('sql', 'plpgsql')
+			AND p.prosrc ~* '\m%[3]s\M'
+			AND p.prosrc ~* '(select|returning)\s+([a-z_][a-z0-9_$]*\.)?\*'
+		UNION ALL
+		SELECT CASE WHEN c.relispartition THEN 'partition' ELSE 'inheritance child' END,
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname), '', '', '', 0
+		FROM pg_inherits i
+		JOIN target t ON t.oid = i.inhparent
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		UNION ALL
+		SELECT 'publication', quote_ident(p.pubname), '', '', '', 0
+		FROM pg_publication_rel pr
+		JOIN target t ON t.oid = pr.prrelid
+		JOIN pg_publication p ON p.oid = pr.prpubid
+		ORDER BY 6, 1, 2;`
+
+	TableReferencedByQuery = `
+		SELECT con.conname, con.contype, pg_get_constraintdef(con.oid), quote_ident(rn.nspname) || '.' || quote_ident(r.relname)
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.confrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class r ON r.oid = con.conrelid
+		JOIN pg_namespace rn ON rn.oid = r.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s'
+			AND con.contype = 'f'
+			AND con.conrelid <> con.confrelid
+		ORDER BY 4, 1;`
+
+	// Grants on recreated views and functions, with the privileges PUBLIC has by default
+	// spelled out so that they can be restored exactly.
+	RelationGrantsQuery = `
+		SELECT COALESCE(r.rolname, ''), acl.privilege_type, acl.is_grantable
+		FROM pg_class c
+		CROSS JOIN LATERAL aclexplode(COALESCE(c.relacl, acldefault('r', c.relowner))) acl
+		LEFT JOIN pg_roles r ON r.oid = acl.grantee
+		WHERE c.oid = %s::regclass
+			AND acl.grantee <> c.relowner;`
+
+	FunctionGrantsQuery = `
+		SELECT COALESCE(r.rolname, ''), acl.privilege_type, acl.is_grantable
+		FROM pg_proc p
+		CROSS JOIN LATERAL aclexplode(COALESCE(p.proacl, acldefault('f', p.proowner))) acl
+		LEFT JOIN pg_roles r ON r.oid = acl.grantee
+		WHERE p.oid = %s::regprocedure
+			AND acl.grantee <> p.proowner;`
+)
+
+// fetchDependencies lists the objects depending on a table and the foreign keys of other
+// tables referencing it.
+func fetchDependencies(connection querier, schemaName string, tableInfo *common.TableInfo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tableName := tableInfo.Name
+	err := queryRows(ctx, connection, fmt.Sprintf(DependentObjectsQuery, schemaName, tableName, regexp.QuoteMeta(tableName)), func(rows *sql.Rows) error {
+		var info common.DependencyInfo
+		if err := rows.Scan(&info.Kind, &info.Name, &info.Definition, &info.Owner, &info.Options, &info.Depth); err != nil {
+			return err
+		}
+		tableInfo.Dependencies = append(tableInfo.Dependencies, info)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch dependent objects: %w", err)
+	}
+
+	for i, info := range tableInfo.Dependencies {
+		query := ""
+		switch info.Kind {
+		case dependency.KindView, dependency.KindMaterializedView:
+			query = RelationGrantsQuery
+		case dependency.KindFunction:
+			query = FunctionGrantsQuery
+		default:
+			continue
+		}
+
+		err := queryRows(ctx, connection, fmt.Sprintf(query, ddl.QuoteLiteral(info.Name)), func(rows *sql.Rows) error {
+			var grant common.GrantInfo
+			if err := rows.Scan(&grant.Grantee, &grant.Privilege, &grant.Grantable); err != nil {
+				return err
+			}
+			tableInfo.Dependencies[i].Grants = append(tableInfo.Dependencies[i].Grants, grant)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch grants on %s: %w", info.Name, err)
+		}
+	}
+
+	err = queryRows(ctx, connection, fmt.Sprintf(TableReferencedByQuery, schemaName, tableName), func(rows *sql.Rows) error {
+		var constraintInfo common.ConstraintInfo
+		if err := rows.Scan(&constraintInfo.Name, &constraintInfo.Type, &constraintInfo.Definition, &constraintInfo.Table); err != nil {
+			return err
+		}
+		tableInfo.ReferencedBy = append(tableInfo.ReferencedBy, constraintInfo)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch referencing foreign keys: %w", err)
+	}
+
+	return nil
+}
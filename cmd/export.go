@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"main/pkg/ddl"
+	"main/pkg/migration"
+	"main/pkg/report"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	framework     string
+	migrationsDir string
+	planner       string
+
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Write the rebuild of a table and its rollback as a migration of goose, golang-migrate, Flyway or sqitch",
+		Run: func(cmd *cobra.Command, arg []string) {
+			exportMigration(cmd.Flags())
+		},
+	}
+)
+
+func init() {
+	exportCmd.Flags().StringVar(&framework, "framework", "", "Migration framework: goose, golang-migrate, flyway or sqitch")
+	exportCmd.Flags().StringVar(&migrationsDir, "migrations-dir", "migrations", "Migrations directory of the framework, whose latest version the migration is numbered after")
+	exportCmd.Flags().StringVar(&planner, "planner", "", "\"name <email>\" sqitch records for the change (default the planner of the last change in sqitch.plan)")
+	exportCmd.Flags().IntVar(&batchSize, "batch-size", migration.DefaultBatchSize, "Rows copied per transaction, in primary key order")
+	exportCmd.Flags().StringVar(&lockTimeout, "lock-timeout", migration.DefaultLockTimeout, "lock_timeout for the transaction that swaps the tables")
+	exportCmd.Flags().StringVar(&strategy, "strategy", "rebuild", "Migration strategy: rebuild (writes stopped during the copy) or online (changes mirrored by triggers)")
+	addSnapshotFlag(exportCmd.Flags())
+	rootCmd.AddCommand(exportCmd)
+}
+
+func exportMigration(flags *pflag.FlagSet) {
+	if table == "" {
+		log.Fatal("The export command writes the migration of a single table, pass it with --table")
+	}
+	target, err := migration.ParseFramework(framework)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	plan, planOptions := migrationPlanner()
+	planOptions.SingleStatementCopy = target.SingleStatement()
+
+	source := openCatalog(flags)
+	defer source.Close()
+
+	constraints, err := loadConstraints()
+	if err != nil {
+		log.Fatalf("Failed to load ordering constraints: %v", err)
+	}
+
+	columnList, tableInfo, options := loadTable(source, schemaName, table, constraints)
+	if err := source.TableObjects(schemaName, &tableInfo); err != nil {
+		log.Fatalf("Failed to fetch indexes, grants and triggers of table %s: %v", table, err)
+	}
+
+	tableReport, err := report.BuildTableReport(columnList, tableInfo, options)
+	if err != nil {
+		log.Fatalf("Failed to compute recommended order for table %s: %v", table, err)
+	}
+
+	order := tableReport.RecommendedOrder
+	if tableReport.ConstrainedOrder != nil {
+		order = tableReport.ConstrainedOrder
+	}
+	if inCurrentOrder(columnList, order) {
+		fmt.Printf("Table %s is already in the recommended order, no migration generated.\n", table)
+		return
+	}
+
+	scripts, err := plan(schemaName, tableInfo, ddl.ReorderByName(columnList, order), planOptions)
+	if err != nil {
+		log.Fatalf("Failed to plan the rebuild of table %s: %v", table, err)
+	}
+
+	if err := os.MkdirAll(migrationsDir, 0o755); err != nil {
+		log.Fatalf("Failed to create migrations directory: %v", err)
+	}
+	files, err := migration.Export(target, os.DirFS(migrationsDir), "reorder_"+table, scripts, migration.ExportOptions{Planner: planner})
+	if err != nil {
+		log.Fatalf("Failed to export the migration of table %s: %v", table, err)
+	}
+
+	for _, file := range files {
+		path := filepath.Join(migrationsDir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		writeScript(path, file.Content)
+	}
+}
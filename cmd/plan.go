@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"main/pkg/common"
+	"main/pkg/ddl"
+	"main/pkg/migration"
+	"main/pkg/report"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	TableOwnershipQuery = `
+		SELECT pg_get_userbyid(c.relowner), c.relrowsecurity, c.relforcerowsecurity
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s';`
+
+	TableIndexesQuery = `
+		SELECT i.relname, pg_get_indexdef(i.oid)
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_class c ON c.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s'
+			AND NOT EXISTS (
+				SELECT 1
+				FROM pg_constraint con
+				WHERE con.conindid = x.indexrelid
+					AND con.conrelid = x.indrelid
+					AND con.contype IN ('p', 'u', 'x')
+			)
+		ORDER BY i.relname;`
+
+	TableGrantsQuery = `
+		SELECT COALESCE(r.rolname, ''), acl.privilege_type, acl.is_grantable, ''
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		CROSS JOIN LATERAL aclexplode(c.relacl) acl
+		LEFT JOIN pg_roles r ON r.oid = acl.grantee
+		WHERE n.nspname = '%[1]s'
+			AND c.relname = '%[2]s'
+			AND acl.grantee <> c.relowner
+		UNION ALL
+		SELECT COALESCE(r.rolname, ''), acl.privilege_type, acl.is_grantable, a.attname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		CROSS JOIN LATERAL aclexplode(a.attacl) acl
+		LEFT JOIN pg_roles r ON r.oid = acl.grantee
+		WHERE n.nspname = '%[1]s'
+			AND c.relname = '%[2]s'
+			AND acl.grantee <> c.relowner;`
+
+	TablePoliciesQuery = `
+		SELECT policyname, permissive = 'PERMISSIVE', cmd, roles::text[], COALESCE(qual, ''), COALESCE(with_check, '')
+		FROM pg_policies
+		WHERE schemaname = '%s'
+			AND tablename = '%s'
+		ORDER BY policyname;`
+
+	TableTriggersQuery = `
+		SELECT t.tgname, pg_get_triggerdef(t.oid)
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s'
+			AND NOT t.tgisinternal
+		ORDER BY t.tgname;`
+
+	TableSequencesQuery = `
+		SELECT quote_ident(sn.nspname) || '.' || quote_ident(s.relname), a.attname, d.deptype = 'i'
+		FROM pg_depend d
+		JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class c ON c.oid = d.refobjid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.refobjsubid
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s'
+			AND d.classid = 'pg_class'::regclass
+			AND d.deptype IN ('a', 'i')
+		ORDER BY a.attnum;`
+)
+
+var (
+	planDir     string
+	batchSize   int
+	lockTimeout string
+	strategy    string
+
+	planCmd = &cobra.Command{
+		Use:   "plan",
+		Short: "Generate SQL scripts that rebuild tables in the recommended column order, with their rollback",
+		Run: func(cmd *cobra.Command, arg []string) {
+			planMigrations(cmd.Flags())
+		},
+	}
+)
+
+func init() {
+	planCmd.Flags().StringVar(&planDir, "plan-dir", "migrations", "Directory the rebuild and rollback scripts are written to")
+	planCmd.Flags().IntVar(&batchSize, "batch-size", migration.DefaultBatchSize, "Rows copied per transaction, in primary key order")
+	planCmd.Flags().StringVar(&lockTimeout, "lock-timeout", migration.DefaultLockTimeout, "lock_timeout for the transaction that swaps the tables")
+	planCmd.Flags().StringVar(&strategy, "strategy", "rebuild", "Migration strategy: rebuild (writes stopped during the copy) or online (changes mirrored by triggers)")
+	addSnapshotFlag(planCmd.Flags())
+	rootCmd.AddCommand(planCmd)
+}
+
+// migrationPlanner resolves --strategy into the function that plans the rebuild of a
+// table, and --batch-size and --lock-timeout into the options it plans with. plan and
+// export share it so that their strategies stay the same.
+func migrationPlanner() (func(string, common.TableInfo, []common.ColumnInfo, migration.Options) (migration.Plan, error), migration.Options) {
+	options := migration.Options{BatchSize: batchSize, LockTimeout: lockTimeout}
+	switch strategy {
+	case "rebuild":
+		return migration.Rebuild, options
+	case "online":
+		return migration.Online, options
+	}
+	log.Fatalf("Unsupported migration strategy %q, expected rebuild or online", strategy)
+	return nil, options
+}
+
+func planMigrations(flags *pflag.FlagSet) {
+	plan, planOptions := migrationPlanner()
+
+	source := openCatalog(flags)
+	defer source.Close()
+
+	constraints, err := loadConstraints()
+	if err != nil {
+		log.Fatalf("Failed to load ordering constraints: %v", err)
+	}
+
+	tables := []string{table}
+	if table == "" {
+		tables, err = source.Tables(schemaName)
+		if err != nil {
+			log.Fatalf("Failed to fetch tables: %v", err)
+		}
+	}
+
+	if err := os.MkdirAll(planDir, 0o755); err != nil {
+		log.Fatalf("Failed to create plan directory: %v", err)
+	}
+
+	for _, table := range tables {
+		columnList, tableInfo, options := loadTable(source, schemaName, table, constraints)
+		if err := source.TableObjects(schemaName, &tableInfo); err != nil {
+			log.Fatalf("Failed to fetch indexes, grants and triggers of table %s: %v", table, err)
+		}
+
+		tableReport, err := report.BuildTableReport(columnList, tableInfo, options)
+		if err != nil {
+			log.Fatalf("Failed to compute recommended order for table %s: %v", table, err)
+		}
+
+		order := tableReport.RecommendedOrder
+		if tableReport.ConstrainedOrder != nil {
+			order = tableReport.ConstrainedOrder
+		}
+		if inCurrentOrder(columnList, order) {
+			fmt.Printf("Table %s is already in the recommended order, no plan generated.\n", table)
+			continue
+		}
+
+		scripts, err := plan(schemaName, tableInfo, ddl.ReorderByName(columnList, order), planOptions)
+		if err != nil {
+			// A table that cannot be planned, for example because of its dependent objects,
+			// does not stop the others from being planned.
+			fmt.Printf("No plan generated for table %s: %v.\n", table, err)
+			continue
+		}
+
+		writeScript(filepath.Join(planDir, fmt.Sprintf("%s_%s.sql", table, strategy)), scripts.Forward)
+		writeScript(filepath.Join(planDir, fmt.Sprintf("%s_rollback.sql", table)), scripts.Rollback)
+	}
+}
+
+func inCurrentOrder(columnList []common.ColumnInfo, order []string) bool {
+	for i, col := range columnList {
+		if order[i] != col.ColumnName {
+			return false
+		}
+	}
+	return true
+}
+
+func writeScript(path string, script string) {
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	fmt.Printf("Script %s generated successfully.\n", path)
+}
+
+// fetchTableObjects reads what a rebuild has to carry over to the new table beyond its
+// definition: ownership, indexes, grants, row level security, triggers and owned
+// sequences.
+func fetchTableObjects(connection querier, schemaName string, tableInfo *common.TableInfo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tableName := tableInfo.Name
+	if err := connection.QueryRowContext(ctx, fmt.Sprintf(TableOwnershipQuery, schemaName, tableName)).Scan(&tableInfo.Owner, &tableInfo.RowSecurity, &tableInfo.ForceRowSecurity); err != nil {
+		return fmt.Errorf("failed to fetch table owner: %w", err)
+	}
+
+	err := queryRows(ctx, connection, fmt.Sprintf(TableIndexesQuery, schemaName, tableName), func(rows *sql.Rows) error {
+		var index common.IndexInfo
+		if err := rows.Scan(&index.Name, &index.Definition); err != nil {
+			return err
+		}
+		tableInfo.Indexes = append(tableInfo.Indexes, index)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch indexes: %w", err)
+	}
+
+	err = queryRows(ctx, connection, fmt.Sprintf(TableGrantsQuery, schemaName, tableName), func(rows *sql.Rows) error {
+		var grant common.GrantInfo
+		if err := rows.Scan(&grant.Grantee, &grant.Privilege, &grant.Grantable, &grant.Column); err != nil {
+			return err
+		}
+		tableInfo.Grants = append(tableInfo.Grants, grant)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch grants: %w", err)
+	}
+
+	err = queryRows(ctx, connection, fmt.Sprintf(TablePoliciesQuery, schemaName, tableName), func(rows *sql.Rows) error {
+		var policy common.PolicyInfo
+		if err := rows.Scan(&policy.Name, &policy.Permissive, &policy.Command, pq.Array(&policy.Roles), &policy.Using, &policy.WithCheck); err != nil {
+			return err
+		}
+		tableInfo.Policies = append(tableInfo.Policies, policy)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch policies: %w", err)
+	}
+
+	err = queryRows(ctx, connection, fmt.Sprintf(TableTriggersQuery, schemaName, tableName), func(rows *sql.Rows) error {
+		var trigger common.TriggerInfo
+		if err := rows.Scan(&trigger.Name, &trigger.Definition); err != nil {
+			return err
+		}
+		tableInfo.Triggers = append(tableInfo.Triggers, trigger)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch triggers: %w", err)
+	}
+
+	err = queryRows(ctx, connection, fmt.Sprintf(TableSequencesQuery, schemaName, tableName), func(rows *sql.Rows) error {
+		var sequence common.SequenceInfo
+		if err := rows.Scan(&sequence.Name, &sequence.Column, &sequence.Identity); err != nil {
+			return err
+		}
+		tableInfo.Sequences = append(tableInfo.Sequences, sequence)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch owned sequences: %w", err)
+	}
+
+	return nil
+}
+
+func queryRows(ctx context.Context, connection querier, query string, scan func(rows *sql.Rows) error) error {
+	rows, err := connection.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"main/pkg/migration"
+	"main/pkg/sqlfile"
+
+	"github.com/spf13/cobra"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Apply a directory of goose, golang-migrate, Flyway or sqitch migrations to a schema model and report the tables it ends with",
+	Long: `Reads the forward migrations of --migrations-dir in the order their framework applies
+them and reports the tables they leave behind as analyze-sql does, without a database.
+The framework is told from the file names unless --framework is given. Columns that
+ALTER TABLE appended are listed with the migration that appended them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		resolveThroughput(cmd.Flags())
+		replayMigrations(cmd.Flags().Changed("schema"))
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&framework, "framework", "", "Migration framework: goose, golang-migrate, flyway or sqitch (default told from the file names)")
+	replayCmd.Flags().StringVar(&migrationsDir, "migrations-dir", "migrations", "Migrations directory of the framework")
+	addReportFlags(replayCmd.Flags())
+	rootCmd.AddCommand(replayCmd)
+}
+
+func replayMigrations(filterSchema bool) {
+	constraints, err := loadConstraints()
+	if err != nil {
+		log.Fatalf("Failed to load ordering constraints: %v", err)
+	}
+
+	source, files := readMigrations()
+
+	catalog := sqlfile.NewCatalog()
+	for _, file := range files {
+		if err := catalog.Parse(filepath.Join(migrationsDir, filepath.FromSlash(file.Path)), file.Content); err != nil {
+			log.Fatalf("Failed to replay migrations: %v", err)
+		}
+	}
+
+	reportCatalog(catalog, fmt.Sprintf("%s (%s, %d migrations)", migrationsDir, source, len(files)), constraints, filterSchema, nil)
+}
+
+// readMigrations reads the forward migrations of --migrations-dir in the order their
+// framework applies them, telling the framework from the file names unless --framework
+// is given.
+func readMigrations() (migration.Framework, []migration.File) {
+	dir := os.DirFS(migrationsDir)
+	source, err := migration.ParseFramework(framework)
+	if framework == "" {
+		source, err = migration.DetectFramework(dir)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read migrations in %s: %v", migrationsDir, err)
+	}
+
+	files, skipped, err := migration.Migrations(source, dir)
+	if err != nil {
+		log.Fatalf("Failed to read migrations in %s: %v", migrationsDir, err)
+	}
+	for _, name := range skipped {
+		fmt.Printf("Skipped %s, a Go migration cannot be replayed.\n", filepath.Join(migrationsDir, name))
+	}
+	return source, files
+}
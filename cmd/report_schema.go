@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"main/pkg/report"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportSchemaFile string
+
+	reportSchemaCmd = &cobra.Command{
+		Use:   "report-schema",
+		Short: "Print the JSON Schema that the --format json report of this build conforms to",
+		Long: `Writes the JSON Schema of the document --format json produces to standard output, or to
+--output when it is given. The schema is embedded in the binary, so it always matches the
+schemaVersion of the reports this build writes.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := writeReportSchema(); err != nil {
+				log.Fatalf("Failed to write report schema: %v", err)
+			}
+		},
+	}
+)
+
+func init() {
+	reportSchemaCmd.Flags().StringVarP(&reportSchemaFile, "output", "o", "", "File the schema is written to (default standard output)")
+	rootCmd.AddCommand(reportSchemaCmd)
+}
+
+func writeReportSchema() error {
+	if reportSchemaFile == "" {
+		_, err := os.Stdout.Write(report.JSONSchema)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(reportSchemaFile), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(reportSchemaFile, report.JSONSchema, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Schema %s written successfully.\n", reportSchemaFile)
+	return nil
+}
@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
 	"main/pkg/common"
+	"main/pkg/constraint"
+	"main/pkg/ddl"
 
 	"main/pkg/db"
+	"main/pkg/estimate"
+	"main/pkg/layout"
 	"main/pkg/report"
 
+	"github.com/lib/pq"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 const (
@@ -24,15 +31,42 @@ const (
             c.data_type,
             c.is_nullable,
             t.typlen,
-            t.typalign
+            t.typalign,
+            a.attstorage,
+            COALESCE(s.null_frac, 0),
+            COALESCE(s.avg_width, 0),
+            COALESCE(col_description(pc.oid, a.attnum), ''),
+            format_type(a.atttypid, a.atttypmod),
+            COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+            a.attnotnull,
+            a.attidentity,
+            a.attgenerated,
+            CASE WHEN a.attcollation <> t.typcollation AND a.attcollation <> 0
+                THEN quote_ident(cn.nspname) || '.' || quote_ident(co.collname)
+                ELSE ''
+            END,
+            t.typstorage
         FROM 
             information_schema.columns c
         JOIN 
-            pg_class pc ON pc.relname = c.table_name
+            pg_namespace pn ON pn.nspname = c.table_schema
+        JOIN 
+            pg_class pc ON pc.relnamespace = pn.oid AND pc.relname = c.table_name
         JOIN 
             pg_attribute a ON a.attrelid = pc.oid AND a.attname = c.column_name
         JOIN 
             pg_type t ON t.oid = a.atttypid
+        LEFT JOIN 
+            pg_stats s ON s.schemaname = c.table_schema
+                AND s.tablename = c.table_name
+                AND s.attname = c.column_name
+                AND NOT s.inherited
+        LEFT JOIN 
+            pg_attrdef d ON d.adrelid = pc.oid AND d.adnum = a.attnum
+        LEFT JOIN 
+            pg_collation co ON co.oid = a.attcollation
+        LEFT JOIN 
+            pg_namespace cn ON cn.oid = co.collnamespace
         WHERE 
             c.table_schema = '%s' 
             AND c.table_name = '%s'
@@ -40,7 +74,57 @@ const (
             c.ordinal_position;
         `
 
-	ColumnCountQuery = `SELECT COUNT('%s') FROM %s;`
+	ColumnCountQuery = `SELECT COUNT(%s) FROM %s;`
+
+	RowCountQuery = `SELECT COUNT(*) FROM %s;`
+
+	// reltuples is -1 until the table is first vacuumed or analyzed, which counts as empty.
+	EstimatedRowCountQuery = `
+		SELECT GREATEST(c.reltuples, 0)::bigint
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s';`
+
+	TableSizeQuery = `
+		SELECT pg_total_relation_size(c.oid),
+			pg_relation_size(c.oid),
+			COALESCE(pg_total_relation_size(NULLIF(c.reltoastrelid, 0)), 0),
+			pg_indexes_size(c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s';`
+
+	TableDefinitionQuery = `
+		SELECT c.relpersistence = 'u',
+			COALESCE(array_to_string(c.reloptions, ', '), ''),
+			COALESCE(obj_description(c.oid, 'pg_class'), '')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s';`
+
+	TableConstraintsQuery = `
+		SELECT con.conname, con.contype, pg_get_constraintdef(con.oid),
+			ARRAY(
+				SELECT a.attname
+				FROM unnest(con.conkey) WITH ORDINALITY k(attnum, ord)
+				JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord
+			)::text[],
+			CASE WHEN con.contype = 'f' AND con.confrelid = con.conrelid
+				THEN quote_ident(n.nspname) || '.' || quote_ident(c.relname)
+				ELSE ''
+			END
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = '%s'
+			AND c.relname = '%s'
+			AND con.contype IN ('p', 'u', 'c', 'f', 'x')
+			AND con.conislocal
+		ORDER BY position(con.contype::text IN 'pucfx'), con.conname;`
 
 	AllTablesInSchemaQuery = `
 		SELECT table_name
@@ -57,8 +141,23 @@ var (
 	port       string
 	table      string
 
+	pins            []string
+	groups          []string
+	orderedGroups   []string
+	constraintsFile string
+	deformWeight    float64
+	format          string
+	output          string
+	exactCounts     bool
+	top             int
+	ddlDir          string
+	minSavings      float64
+	copyThroughput  float64
+	indexThroughput float64
+	throughputFile  string
+
 	alignmentMap = map[string]int{
-		"c": -1,
+		"c": 1,
 		"s": 2,
 		"i": 4,
 		"d": 8,
@@ -68,7 +167,7 @@ var (
 		Use:   "cli",
 		Short: "A CLI tool for PostgreSQL column order optimization",
 		Run: func(cmd *cobra.Command, arg []string) {
-			configureDatabase()
+			configureDatabase(cmd.Flags())
 		},
 	}
 )
@@ -80,16 +179,93 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&dbName, "database", "d", "postgres", "Database name")
-	rootCmd.Flags().StringVarP(&userName, "username", "u", "postgres", "Username")
-	rootCmd.Flags().StringVarP(&password, "password", "p", "123", "Password")
-	rootCmd.Flags().StringVarP(&host, "host", "l", "localhost", "Host")
-	rootCmd.Flags().StringVarP(&schemaName, "schema", "s", "public", "Schema name")
-	rootCmd.Flags().StringVarP(&port, "port", "P", "5432", "Port")
-	rootCmd.Flags().StringVarP(&table, "table", "t", "", "Table name")
+	rootCmd.PersistentFlags().StringVarP(&dbName, "database", "d", "postgres", "Database name")
+	rootCmd.PersistentFlags().StringVarP(&userName, "username", "u", "postgres", "Username")
+	rootCmd.PersistentFlags().StringVarP(&password, "password", "p", "123", "Password")
+	rootCmd.PersistentFlags().StringVarP(&host, "host", "l", "localhost", "Host")
+	rootCmd.PersistentFlags().StringVarP(&schemaName, "schema", "s", "public", "Schema name")
+	rootCmd.PersistentFlags().StringVarP(&port, "port", "P", "5432", "Port")
+	rootCmd.PersistentFlags().StringVarP(&table, "table", "t", "", "Table name")
+	rootCmd.PersistentFlags().StringArrayVar(&pins, "pin", nil, "Pin a column to a position, as [table.]column=first|last|N")
+	rootCmd.PersistentFlags().StringArrayVar(&groups, "group", nil, "Keep columns adjacent, as [table.]column,column,...")
+	rootCmd.PersistentFlags().StringArrayVar(&orderedGroups, "ordered-group", nil, "Keep columns adjacent and in the given order, as [table.]column,column,...")
+	rootCmd.PersistentFlags().StringVar(&constraintsFile, "constraints", "", "Path to a JSON file of ordering constraints")
+	rootCmd.PersistentFlags().BoolVar(&exactCounts, "exact-counts", false, "Count rows and column entries with a scan of each table instead of estimating them from pg_class.reltuples and pg_stats.null_frac")
+	rootCmd.PersistentFlags().Float64Var(&deformWeight, "deform-weight", 0, "Bytes of tuple size one more cacheable column offset is worth when recommending an order")
+	addReportFlags(rootCmd.Flags())
+	addSnapshotFlag(rootCmd.Flags())
+}
+
+// addReportFlags registers the flags that shape the report, which every command that
+// writes one takes.
+func addReportFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&format, "format", "csv", "Report format: csv, json, markdown or html")
+	flags.IntVar(&top, "top", 0, "List only the N tables with the most reclaimable space in the run summary (0 lists all)")
+	flags.Float64Var(&minSavings, "min-savings", 0, "Leave tables reclaiming fewer bytes than this out of the run summary")
+	flags.StringVar(&ddlDir, "ddl-dir", "", "Write a CREATE TABLE in the recommended order for each table into this directory")
+	flags.Float64Var(&copyThroughput, "copy-throughput", estimate.DefaultThroughput.Copy/estimate.MiB, "MiB per second a rebuild copies, for the maintenance estimate")
+	flags.Float64Var(&indexThroughput, "index-throughput", estimate.DefaultThroughput.IndexBuild/estimate.MiB, "MiB of index per second a rebuild builds, for the maintenance estimate")
+	flags.StringVar(&throughputFile, "throughput-file", "", "File of the rates apply measured on the same server, used for the maintenance estimate in place of the throughput flags not given")
+	flags.StringVarP(&output, "output", "o", "", "Report destination: the directory for csv (default reports), the file for json, markdown or html (default reports/report.<format extension>)")
+}
+
+func configureDatabase(flags *pflag.FlagSet) {
+	resolveThroughput(flags)
+	source := openCatalog(flags)
+	defer source.Close()
+
+	constraints, err := loadConstraints()
+	if err != nil {
+		log.Fatalf("Failed to load ordering constraints: %v", err)
+	}
+
+	writer, err := report.NewWriter(format, output, report.Run{Database: dbName, Schema: schemaName}, report.SummaryOptions{Top: top, MinSavings: minSavings})
+	if err != nil {
+		log.Fatalf("Failed to configure report output: %v", err)
+	}
+
+	if table == "" {
+		generateReportForAllTablesInSchema(source, constraints, writer)
+	} else {
+		generateReportForTable(source, schemaName, table, constraints, writer)
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
 }
 
-func configureDatabase() {
+// resolveThroughput replaces the defaults of the throughput flags that are not given with
+// the rates apply measured and saved to --throughput-file, when one is given, and prints
+// where the rates of the maintenance estimate come from.
+func resolveThroughput(flags *pflag.FlagSet) {
+	copySource, indexSource := "default", "default"
+	if flags.Changed("copy-throughput") {
+		copySource = "--copy-throughput"
+	}
+	if flags.Changed("index-throughput") {
+		indexSource = "--index-throughput"
+	}
+
+	if throughputFile != "" {
+		measured, err := estimate.LoadThroughput(throughputFile)
+		if err != nil {
+			log.Fatalf("Failed to read measured throughput: %v", err)
+		}
+		if !flags.Changed("copy-throughput") {
+			copyThroughput = measured.Copy / estimate.MiB
+			copySource = "measured by apply, from " + throughputFile
+		}
+		if !flags.Changed("index-throughput") {
+			indexThroughput = measured.IndexBuild / estimate.MiB
+			indexSource = "measured by apply, from " + throughputFile
+		}
+	}
+
+	fmt.Printf("Maintenance estimate: copy at %.1f MiB/s (%s), index builds at %.1f MiB/s (%s)\n", copyThroughput, copySource, indexThroughput, indexSource)
+}
+
+func connect() *sql.DB {
 	dbConfig := db.Config{
 		DBName:   dbName,
 		UserName: userName,
@@ -103,47 +279,123 @@ func configureDatabase() {
 	if err != nil {
 		log.Fatalf("Failed to connect to the database: %v", err)
 	}
+	return connection
+}
 
-	defer connection.Close()
+// loadConstraints combines the constraint sources, with the config file taking precedence
+// over column comments and flags taking precedence over both. Comments are read per table.
+func loadConstraints() (constraint.Set, error) {
+	var constraints constraint.Set
 
-	if err := os.MkdirAll("reports", 0o755); err != nil {
-		log.Fatalf("Failed to create reports directory: %v", err)
+	if constraintsFile != "" {
+		fileConstraints, err := constraint.Load(constraintsFile)
+		if err != nil {
+			return constraint.Set{}, err
+		}
+		constraints = fileConstraints
 	}
 
-	if table == "" {
-		generateReportForAllTablesInSchema(connection)
-	} else {
-		generateReportForTable(connection, schemaName, table)
+	var flagConstraints constraint.Set
+	for _, spec := range pins {
+		pin, err := constraint.ParsePin(spec)
+		if err != nil {
+			return constraint.Set{}, err
+		}
+		flagConstraints.Pins = append(flagConstraints.Pins, pin)
 	}
+	for _, spec := range groups {
+		group, err := constraint.ParseGroup(spec, false)
+		if err != nil {
+			return constraint.Set{}, err
+		}
+		flagConstraints.Groups = append(flagConstraints.Groups, group)
+	}
+	for _, spec := range orderedGroups {
+		group, err := constraint.ParseGroup(spec, true)
+		if err != nil {
+			return constraint.Set{}, err
+		}
+		flagConstraints.Groups = append(flagConstraints.Groups, group)
+	}
+
+	return constraints.Merge(flagConstraints), nil
 }
 
-func generateReportForAllTablesInSchema(connection *sql.DB) {
-	tables, err := fetchTables(connection, schemaName)
+func generateReportForAllTablesInSchema(source catalog, constraints constraint.Set, writer report.Writer) {
+	tables, err := source.Tables(schemaName)
 	if err != nil {
 		log.Fatalf("Failed to fetch tables: %v", err)
 	}
 
 	for _, table := range tables {
-		generateReportForTable(connection, schemaName, table)
+		generateReportForTable(source, schemaName, table, constraints, writer)
+	}
+}
+
+func generateReportForTable(source catalog, schemaName string, table string, constraints constraint.Set, writer report.Writer) {
+	columnList, tableInfo, options := loadTable(source, schemaName, table, constraints)
+	reportTable(schemaName, columnList, tableInfo, options, writer)
+}
+
+// reportTable adds a table to the report and writes its DDL when --ddl-dir is set.
+func reportTable(schemaName string, columnList []common.ColumnInfo, tableInfo common.TableInfo, options layout.Options, writer report.Writer) {
+	tableReport, err := report.GenerateReport(columnList, tableInfo, options, estimate.Throughput{Copy: copyThroughput * estimate.MiB, IndexBuild: indexThroughput * estimate.MiB}, writer)
+	if err != nil {
+		log.Fatalf("Failed to generate report for table %s: %v", tableInfo.Name, err)
+	}
+
+	if ddlDir != "" {
+		if err := writeDDL(schemaName, tableInfo, columnList, tableReport); err != nil {
+			log.Fatalf("Failed to write DDL for table %s: %v", tableInfo.Name, err)
+		}
 	}
 }
 
-func generateReportForTable(connection *sql.DB, schemaName string, table string) {
-	columnList, err := fetchColumns(connection, schemaName, table)
+// loadTable reads a table from the catalog and resolves the options its recommended
+// order is computed with.
+func loadTable(source catalog, schemaName string, table string, constraints constraint.Set) ([]common.ColumnInfo, common.TableInfo, layout.Options) {
+	columnList, tableInfo, err := source.Table(schemaName, table)
 	if err != nil {
-		log.Fatalf("Failed to fetch columns for table %s: %v", table, err)
+		log.Fatalf("Failed to read table %s: %v", table, err)
+	}
+
+	return columnList, tableInfo, layoutOptions(table, columnList, constraints)
+}
+
+// layoutOptions resolves the ordering constraints of a table, including those in its
+// column comments, into the options its recommended order is computed with.
+func layoutOptions(table string, columnList []common.ColumnInfo, constraints constraint.Set) layout.Options {
+	tableConstraints, err := constraint.FromComments(table, columnList).Merge(constraints).ForTable(table, columnList)
+	if err != nil {
+		log.Fatalf("Failed to resolve ordering constraints for table %s: %v", table, err)
+	}
+
+	return layout.Options{Constraints: tableConstraints, DeformWeight: deformWeight}
+}
+
+// writeDDL writes the definition of a table in its recommended order, or in its
+// constrained order when ordering constraints apply.
+func writeDDL(schemaName string, tableInfo common.TableInfo, columnList []common.ColumnInfo, tableReport report.TableReport) error {
+	order := tableReport.RecommendedOrder
+	if tableReport.ConstrainedOrder != nil {
+		order = tableReport.ConstrainedOrder
 	}
 
-	for i := range columnList {
-		columnList[i].EntryCount = calculateTotalEntries(connection, table, columnList[i].ColumnName)
+	if err := os.MkdirAll(ddlDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create DDL directory: %w", err)
 	}
 
-	if err := report.GenerateReport(columnList, table); err != nil {
-		log.Fatalf("Failed to generate report for table %s: %v", table, err)
+	path := filepath.Join(ddlDir, fmt.Sprintf("%s_ddl.sql", tableInfo.Name))
+	statement := ddl.CreateTable(schemaName, tableInfo, ddl.ReorderByName(columnList, order))
+	if err := os.WriteFile(path, []byte(statement), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
 	}
+
+	fmt.Printf("DDL %s generated successfully.\n", path)
+	return nil
 }
 
-func fetchTables(connection *sql.DB, schemaName string) ([]string, error) {
+func fetchTables(connection querier, schemaName string) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -169,7 +421,7 @@ func fetchTables(connection *sql.DB, schemaName string) ([]string, error) {
 	return tables, nil
 }
 
-func fetchColumns(connection *sql.DB, schemaName string, tableName string) ([]common.ColumnInfo, error) {
+func fetchColumns(connection querier, schemaName string, tableName string) ([]common.ColumnInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -183,7 +435,8 @@ func fetchColumns(connection *sql.DB, schemaName string, tableName string) ([]co
 	for rows.Next() {
 		var colInfo common.ColumnInfo
 		var typAlignRune string
-		if err := rows.Scan(&colInfo.OrdinalPosition, &colInfo.ColumnName, &colInfo.DataType, &colInfo.IsNullable, &colInfo.TypLen, &typAlignRune); err != nil {
+		if err := rows.Scan(&colInfo.OrdinalPosition, &colInfo.ColumnName, &colInfo.DataType, &colInfo.IsNullable, &colInfo.TypLen, &typAlignRune, &colInfo.Storage, &colInfo.NullFrac, &colInfo.AvgWidth, &colInfo.Comment,
+			&colInfo.FormattedType, &colInfo.Default, &colInfo.NotNull, &colInfo.Identity, &colInfo.Generated, &colInfo.Collation, &colInfo.TypStorage); err != nil {
 			return nil, fmt.Errorf("failed to scan column info: %w", err)
 		}
 		alignmentValue, exists := alignmentMap[typAlignRune]
@@ -200,15 +453,64 @@ func fetchColumns(connection *sql.DB, schemaName string, tableName string) ([]co
 	return columns, nil
 }
 
-func calculateTotalEntries(connection *sql.DB, tableName string, columnName string) int {
-	query := fmt.Sprintf(ColumnCountQuery, columnName, tableName)
+func fetchTableInfo(connection querier, schemaName string, tableName string) (common.TableInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var count int
-	err := connection.QueryRowContext(ctx, query).Scan(&count)
+	tableInfo := common.TableInfo{Name: tableName}
+	if err := connection.QueryRowContext(ctx, fmt.Sprintf(EstimatedRowCountQuery, schemaName, tableName)).Scan(&tableInfo.RowCount); err != nil {
+		return common.TableInfo{}, fmt.Errorf("failed to estimate rows: %w", err)
+	}
+	if err := connection.QueryRowContext(ctx, fmt.Sprintf(TableSizeQuery, schemaName, tableName)).Scan(&tableInfo.TotalRelationSize, &tableInfo.HeapSize, &tableInfo.ToastSize, &tableInfo.IndexesSize); err != nil {
+		return common.TableInfo{}, fmt.Errorf("failed to fetch relation sizes: %w", err)
+	}
+	if err := connection.QueryRowContext(ctx, fmt.Sprintf(TableDefinitionQuery, schemaName, tableName)).Scan(&tableInfo.Unlogged, &tableInfo.Options, &tableInfo.Comment); err != nil {
+		return common.TableInfo{}, fmt.Errorf("failed to fetch table definition: %w", err)
+	}
+
+	rows, err := connection.QueryContext(ctx, fmt.Sprintf(TableConstraintsQuery, schemaName, tableName))
 	if err != nil {
-		log.Fatalf("Failed to calculate total entries for column %s in table %s: %v", columnName, tableName, err)
+		return common.TableInfo{}, fmt.Errorf("failed to fetch constraints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var constraintInfo common.ConstraintInfo
+		if err := rows.Scan(&constraintInfo.Name, &constraintInfo.Type, &constraintInfo.Definition, pq.Array(&constraintInfo.Columns), &constraintInfo.Table); err != nil {
+			return common.TableInfo{}, fmt.Errorf("failed to scan constraint: %w", err)
+		}
+		tableInfo.Constraints = append(tableInfo.Constraints, constraintInfo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return common.TableInfo{}, fmt.Errorf("rows error: %w", err)
+	}
+
+	if err := fetchDependencies(connection, schemaName, &tableInfo); err != nil {
+		return common.TableInfo{}, err
+	}
+	return tableInfo, nil
+}
+
+func calculateTotalRows(connection querier, schemaName string, tableName string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var count int
+	if err := connection.QueryRowContext(ctx, fmt.Sprintf(RowCountQuery, ddl.QualifiedName(schemaName, tableName))).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+func calculateTotalEntries(connection querier, schemaName string, tableName string, columnName string) (int, error) {
+	query := fmt.Sprintf(ColumnCountQuery, ddl.QuoteIdent(columnName), ddl.QualifiedName(schemaName, tableName))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var count int
+	if err := connection.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to calculate total entries for column %s: %w", columnName, err)
 	}
-	return count
+	return count, nil
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"main/pkg/snapshot"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotFile string
+
+	snapshotCmd = &cobra.Command{
+		Use:   "snapshot",
+		Short: "Capture what the analysis reads of a schema into a JSON file, for running it later without a connection",
+		Long: `Reads the columns, types, alignments, statistics, row and entry estimates, sizes,
+constraints and dependent objects of every table of --schema, or of --table only, in a single
+read-only transaction, and writes them to --output. The estimates come from the statistics, so
+no table is scanned unless --exact-counts is given. The report, plan and export commands read
+the file with --from-snapshot in place of the database.`,
+		Run: func(cmd *cobra.Command, arg []string) {
+			takeSnapshot()
+		},
+	}
+)
+
+func init() {
+	snapshotCmd.Flags().StringVarP(&snapshotFile, "output", "o", "snapshot.json", "File the snapshot is written to")
+	rootCmd.AddCommand(snapshotCmd)
+}
+
+func takeSnapshot() {
+	connection := connect()
+	defer connection.Close()
+
+	// One repeatable read transaction reads every table as of the same moment.
+	ctx := context.Background()
+	tx, err := connection.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		log.Fatalf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	captured := snapshot.Snapshot{Database: dbName, Schema: schemaName, TakenAt: time.Now().UTC()}
+	if err := tx.QueryRowContext(ctx, "SHOW server_version").Scan(&captured.ServerVersion); err != nil {
+		log.Fatalf("Failed to fetch server version: %v", err)
+	}
+
+	source := liveCatalog{connection: tx, exactCounts: exactCounts}
+	tables := []string{table}
+	if table == "" {
+		tables, err = source.Tables(schemaName)
+		if err != nil {
+			log.Fatalf("Failed to fetch tables: %v", err)
+		}
+	}
+
+	for _, table := range tables {
+		columnList, tableInfo, err := source.Table(schemaName, table)
+		if err != nil {
+			log.Fatalf("Failed to read table %s: %v", table, err)
+		}
+		if err := source.TableObjects(schemaName, &tableInfo); err != nil {
+			log.Fatalf("Failed to fetch indexes, grants and triggers of table %s: %v", table, err)
+		}
+		captured.Tables = append(captured.Tables, snapshot.Table{Columns: columnList, Info: tableInfo})
+	}
+
+	if err := writeSnapshot(captured); err != nil {
+		log.Fatalf("Failed to write snapshot: %v", err)
+	}
+	fmt.Printf("Snapshot %s of %d tables taken successfully.\n", snapshotFile, len(captured.Tables))
+}
+
+func writeSnapshot(captured snapshot.Snapshot) error {
+	if err := os.MkdirAll(filepath.Dir(snapshotFile), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(snapshotFile)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Write(file, captured); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"main/pkg/ddl"
+	"main/pkg/migration"
+	"main/pkg/verify"
+
+	"github.com/spf13/cobra"
+)
+
+const HeapSizeQuery = `SELECT pg_relation_size(%s::regclass, 'main');`
+
+var (
+	rangeSize     int
+	sizeTolerance float64
+
+	verifyCmd = &cobra.Command{
+		Use:   "verify <original table> <rebuilt table>",
+		Short: "Check that a rebuilt table holds the same rows as the original and has the predicted size",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			verifyRebuild(args[0], args[1])
+		},
+	}
+)
+
+func init() {
+	verifyCmd.Flags().IntVar(&rangeSize, "range-size", verify.DefaultRangeSize, "Rows of the original table per compared primary key range")
+	verifyCmd.Flags().Float64Var(&sizeTolerance, "size-tolerance", verify.DefaultSizeTolerance, "Largest accepted deviation of the rebuilt table's size from the prediction, as a fraction")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func verifyRebuild(original string, rebuilt string) {
+	connection := connect()
+	defer connection.Close()
+
+	originalColumns, err := fetchColumns(connection, schemaName, original)
+	if err != nil {
+		log.Fatalf("Failed to fetch columns for table %s: %v", original, err)
+	}
+	rebuiltColumns, err := fetchColumns(connection, schemaName, rebuilt)
+	if err != nil {
+		log.Fatalf("Failed to fetch columns for table %s: %v", rebuilt, err)
+	}
+
+	columns, err := verify.Columns(originalColumns, rebuiltColumns)
+	if err != nil {
+		log.Fatalf("Tables %s and %s cannot be compared: %v", original, rebuilt, err)
+	}
+
+	originalInfo, err := fetchTableInfo(connection, schemaName, original)
+	if err != nil {
+		log.Fatalf("Failed to fetch definition of table %s: %v", original, err)
+	}
+	key := migration.PrimaryKey(originalInfo, originalColumns)
+	if key == nil {
+		log.Fatalf("Table %s needs a primary key to be compared by range", original)
+	}
+
+	tables := verify.Tables{
+		Original:  ddl.QualifiedName(schemaName, original),
+		Rebuilt:   ddl.QualifiedName(schemaName, rebuilt),
+		Key:       key,
+		Columns:   columns,
+		RangeSize: rangeSize,
+	}
+	result, err := verify.Compare(context.Background(), connection, tables)
+	if err != nil {
+		log.Fatalf("Failed to compare %s with %s: %v", original, rebuilt, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var unlogged bool
+	var options, comment string
+	if err := connection.QueryRowContext(ctx, fmt.Sprintf(TableDefinitionQuery, schemaName, rebuilt)).Scan(&unlogged, &options, &comment); err != nil {
+		log.Fatalf("Failed to fetch definition of table %s: %v", rebuilt, err)
+	}
+
+	order := make([]string, len(rebuiltColumns))
+	for i, col := range rebuiltColumns {
+		order[i] = col.ColumnName
+	}
+
+	// The statistics of the original table describe the same rows, and stay with it
+	// when it is renamed, while the rebuilt table may not have been analyzed yet.
+	size := verify.Size{Predicted: verify.PredictedSize(originalColumns, order, result.RebuiltRows, options)}
+	if err := connection.QueryRowContext(ctx, fmt.Sprintf(HeapSizeQuery, ddl.QuoteLiteral(tables.Rebuilt))).Scan(&size.Actual); err != nil {
+		log.Fatalf("Failed to fetch size of table %s: %v", rebuilt, err)
+	}
+
+	if !verify.Write(os.Stdout, tables, result, size, sizeTolerance) {
+		log.Fatalf("Verification of %s against %s failed", rebuilt, original)
+	}
+	fmt.Printf("Table %s matches %s.\n", rebuilt, original)
+}
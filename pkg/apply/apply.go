@@ -0,0 +1,480 @@
+package apply
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lib/pq"
+
+	"main/pkg/ddl"
+	"main/pkg/estimate"
+	"main/pkg/migration"
+)
+
+const (
+	DefaultLockTimeout      = migration.DefaultLockTimeout
+	DefaultStatementTimeout = "1h"
+
+	phaseCopy      = "copy"
+	phaseBuild     = "build"
+	phaseVerify    = "verify"
+	phaseAfterSwap = "after swap"
+)
+
+const (
+	// The progress table records the phase in batch 0 and one row per copied batch, with
+	// the last key and the checksum of its rows, in the transaction that copies it.
+	CreateProgressQuery = `
+		CREATE TABLE %[1]s (
+			batch integer PRIMARY KEY,
+			phase text,
+			last_key text[],
+			rows bigint NOT NULL DEFAULT 0,
+			checksum text,
+			updated_at timestamptz NOT NULL DEFAULT now()
+		);
+		INSERT INTO %[1]s (batch, phase) VALUES (0, 'copy');`
+
+	ProgressExistsQuery = `SELECT to_regclass(%s) IS NOT NULL;`
+
+	PhaseQuery = `SELECT phase FROM %s WHERE batch = 0;`
+
+	SetPhaseQuery = `UPDATE %s SET phase = $1, updated_at = now() WHERE batch = 0;`
+
+	BatchesQuery = `SELECT batch, last_key, rows, checksum FROM %s WHERE batch > 0 ORDER BY batch;`
+
+	RecordBatchQuery = `INSERT INTO %s (batch, last_key, rows, checksum) VALUES ($1, $2, $3, $4);`
+
+	EstimatedRowsQuery = `SELECT GREATEST(reltuples, 0)::bigint FROM pg_class WHERE oid = %s::regclass;`
+
+	RowCountsQuery = `SELECT (SELECT count(*) FROM %s), (SELECT count(*) FROM %s);`
+
+	NewTableSizesQuery = `SELECT pg_table_size(%[1]s::regclass), pg_indexes_size(%[1]s::regclass);`
+
+	ReplicationLagQuery = `
+		SELECT COALESCE(max(pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)), 0)::bigint
+		FROM pg_stat_replication;`
+
+	OldestTransactionQuery = `
+		SELECT pid, extract(epoch FROM now() - xact_start)
+		FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid()
+			AND backend_type = 'client backend'
+			AND xact_start IS NOT NULL
+		ORDER BY xact_start
+		LIMIT 1;`
+)
+
+// Options bound what a run may do to the server. A zero MaxReplicationLag or
+// MaxTransactionAge disables that check. The rates the copy and the index builds ran at
+// are saved to ThroughputFile when it is set.
+type Options struct {
+	LockTimeout       string
+	StatementTimeout  string
+	MaxReplicationLag int64
+	MaxTransactionAge time.Duration
+	ThroughputFile    string
+}
+
+type batch struct {
+	number   int
+	lastKey  []string
+	rows     int64
+	checksum string
+}
+
+type runner struct {
+	conn    *sql.Conn
+	steps   migration.Steps
+	options Options
+	out     io.Writer
+
+	// How long the copy and the index builds took, when this run did all of either.
+	copyDuration  time.Duration
+	buildDuration time.Duration
+}
+
+var now = time.Now
+
+// Run applies the steps of a rebuild on conn, resuming from its progress table when an
+// earlier run was interrupted. Every batch is copied in its own transaction, and the
+// tables are only swapped once the row counts and the checksum of every batch match.
+func Run(ctx context.Context, conn *sql.Conn, steps migration.Steps, options Options, out io.Writer) error {
+	if options.LockTimeout == "" {
+		options.LockTimeout = DefaultLockTimeout
+	}
+	if options.StatementTimeout == "" {
+		options.StatementTimeout = DefaultStatementTimeout
+	}
+	r := runner{conn: conn, steps: steps, options: options, out: out}
+
+	for _, setting := range []string{"lock_timeout = " + ddl.QuoteLiteral(options.LockTimeout), "statement_timeout = " + ddl.QuoteLiteral(options.StatementTimeout)} {
+		if _, err := conn.ExecContext(ctx, "SET "+setting); err != nil {
+			return fmt.Errorf("failed to set %s: %w", setting, err)
+		}
+	}
+
+	phase, err := Phase(ctx, conn, steps.Progress)
+	if err != nil {
+		return err
+	}
+
+	if phase == "" {
+		if err := r.prepare(ctx); err != nil {
+			return err
+		}
+		phase = phaseCopy
+	} else {
+		fmt.Fprintf(out, "Resuming the rebuild of %s at the %s phase.\n", steps.Table, phase)
+	}
+
+	if phase == phaseCopy {
+		if err := r.copyRows(ctx); err != nil {
+			return err
+		}
+		phase = phaseBuild
+	}
+
+	if phase == phaseBuild {
+		if err := r.build(ctx); err != nil {
+			return err
+		}
+		if err := r.reportThroughput(ctx); err != nil {
+			return err
+		}
+		phase = phaseVerify
+	}
+
+	if phase == phaseVerify {
+		if err := r.verify(ctx); err != nil {
+			return err
+		}
+		if err := r.checkServer(ctx); err != nil {
+			return err
+		}
+		if err := r.swap(ctx); err != nil {
+			return err
+		}
+	}
+
+	return r.finish(ctx)
+}
+
+// Queryer is satisfied by *sql.DB and *sql.Conn.
+type Queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Phase returns the phase an interrupted rebuild stopped at, read from its progress
+// table, or "" when no rebuild is in progress.
+func Phase(ctx context.Context, q Queryer, progress string) (string, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, fmt.Sprintf(ProgressExistsQuery, ddl.QuoteLiteral(progress))).Scan(&exists); err != nil {
+		return "", fmt.Errorf("failed to look up progress table: %w", err)
+	}
+	if !exists {
+		return "", nil
+	}
+
+	var phase string
+	if err := q.QueryRowContext(ctx, fmt.Sprintf(PhaseQuery, progress)).Scan(&phase); err != nil {
+		return "", fmt.Errorf("failed to read progress: %w", err)
+	}
+	return phase, nil
+}
+
+func (r *runner) prepare(ctx context.Context) error {
+	fmt.Fprintf(r.out, "Creating %s.\n", r.steps.NewTable)
+	return r.inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, r.steps.Prepare); err != nil {
+			return fmt.Errorf("failed to create %s: %w", r.steps.NewTable, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(CreateProgressQuery, r.steps.Progress)); err != nil {
+			return fmt.Errorf("failed to create progress table: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *runner) copyRows(ctx context.Context) error {
+	batches, err := r.batches(ctx)
+	if err != nil {
+		return err
+	}
+
+	var copied int64
+	var lastKey []string
+	for _, b := range batches {
+		copied += b.rows
+		lastKey = b.lastKey
+	}
+
+	var estimate int64
+	if err := r.conn.QueryRowContext(ctx, fmt.Sprintf(EstimatedRowsQuery, ddl.QuoteLiteral(r.steps.Table))).Scan(&estimate); err != nil {
+		return fmt.Errorf("failed to estimate rows of %s: %w", r.steps.Table, err)
+	}
+
+	start := now()
+	for number := len(batches) + 1; ; number++ {
+		if err := r.checkServer(ctx); err != nil {
+			return err
+		}
+
+		var next batch
+		err := r.inTransaction(ctx, func(tx *sql.Tx) error {
+			var err error
+			next, err = r.copyBatch(ctx, tx, number, lastKey)
+			if err != nil {
+				return err
+			}
+			if next.rows == 0 {
+				return setPhase(ctx, tx, r.steps.Progress, phaseBuild)
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(RecordBatchQuery, r.steps.Progress), next.number, pq.Array(next.lastKey), next.rows, next.checksum); err != nil {
+				return fmt.Errorf("failed to record batch %d: %w", number, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if next.rows == 0 {
+			if len(batches) == 0 {
+				r.copyDuration = now().Sub(start)
+			}
+			fmt.Fprintf(r.out, "Copied %d rows into %s.\n", copied, r.steps.NewTable)
+			return nil
+		}
+
+		copied += next.rows
+		lastKey = next.lastKey
+		if estimate > 0 {
+			fmt.Fprintf(r.out, "Batch %d: %d of about %d rows copied (%.0f%%).\n", number, copied, estimate, 100*float64(copied)/float64(estimate))
+		} else {
+			fmt.Fprintf(r.out, "Batch %d: %d rows copied.\n", number, copied)
+		}
+	}
+}
+
+func (r *runner) copyBatch(ctx context.Context, tx *sql.Tx, number int, after []string) (batch, error) {
+	next := batch{number: number}
+	lastKey := make([]sql.NullString, r.steps.KeyLength)
+	dest := []interface{}{&next.rows, &next.checksum}
+	for i := range lastKey {
+		dest = append(dest, &lastKey[i])
+	}
+
+	if err := tx.QueryRowContext(ctx, r.steps.Copy.For(after), r.keyArgs(after)...).Scan(dest...); err != nil {
+		return batch{}, fmt.Errorf("failed to copy batch %d: %w", number, err)
+	}
+	for _, value := range lastKey {
+		next.lastKey = append(next.lastKey, value.String)
+	}
+	return next, nil
+}
+
+func (r *runner) build(ctx context.Context) error {
+	fmt.Fprintf(r.out, "Building indexes and constraints of %s.\n", r.steps.NewTable)
+	start := now()
+	err := r.inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, r.steps.Build); err != nil {
+			return fmt.Errorf("failed to build indexes and constraints: %w", err)
+		}
+		return setPhase(ctx, tx, r.steps.Progress, phaseVerify)
+	})
+	if err == nil {
+		r.buildDuration = now().Sub(start)
+	}
+	return err
+}
+
+// reportThroughput prints the rates the copy and the index builds ran at and saves them
+// to the throughput file, where the maintenance estimate of the report takes them from. A
+// resumed copy has no meaningful rate, so nothing is measured then.
+func (r *runner) reportThroughput(ctx context.Context) error {
+	if r.copyDuration <= 0 || r.buildDuration <= 0 {
+		return nil
+	}
+
+	var tableSize, indexesSize int64
+	if err := r.conn.QueryRowContext(ctx, fmt.Sprintf(NewTableSizesQuery, ddl.QuoteLiteral(r.steps.NewTable))).Scan(&tableSize, &indexesSize); err != nil {
+		return fmt.Errorf("failed to fetch size of %s: %w", r.steps.NewTable, err)
+	}
+
+	throughput := estimate.Throughput{
+		Copy:       float64(tableSize) / r.copyDuration.Seconds(),
+		IndexBuild: float64(indexesSize) / r.buildDuration.Seconds(),
+	}
+	fmt.Fprintf(r.out, "The copy ran at %.1f MiB/s and the index builds at %.1f MiB/s.\n", throughput.Copy/estimate.MiB, throughput.IndexBuild/estimate.MiB)
+
+	// An empty table or index measures nothing to estimate from.
+	if r.options.ThroughputFile == "" || throughput.Copy <= 0 || throughput.IndexBuild <= 0 {
+		return nil
+	}
+	if err := estimate.SaveThroughput(r.options.ThroughputFile, throughput); err != nil {
+		return fmt.Errorf("failed to save throughput: %w", err)
+	}
+	fmt.Fprintf(r.out, "Saved the rates to %s for the maintenance estimate of the report.\n", r.options.ThroughputFile)
+	return nil
+}
+
+// verify compares both tables in one snapshot: the total row counts, then the rows and
+// checksum of every batch as recorded when it was copied.
+func (r *runner) verify(ctx context.Context) error {
+	batches, err := r.batches(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var copied, sourceRows, targetRows int64
+	for _, b := range batches {
+		copied += b.rows
+	}
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(RowCountsQuery, r.steps.Table, r.steps.NewTable)).Scan(&sourceRows, &targetRows); err != nil {
+		return fmt.Errorf("failed to count rows: %w", err)
+	}
+	if sourceRows != copied || targetRows != copied {
+		return fmt.Errorf("row counts differ: %s has %d rows, %s has %d, %d were copied; were writes stopped?", r.steps.Table, sourceRows, r.steps.NewTable, targetRows, copied)
+	}
+
+	var after []string
+	for _, b := range batches {
+		args := append(r.keyArgs(after), r.keyArgs(b.lastKey)...)
+		for _, check := range []struct {
+			table     string
+			statement migration.BatchStatement
+		}{{r.steps.Table, r.steps.SourceChecksum}, {r.steps.NewTable, r.steps.TargetChecksum}} {
+			var rows int64
+			var checksum string
+			if err := tx.QueryRowContext(ctx, check.statement.For(after), args...).Scan(&rows, &checksum); err != nil {
+				return fmt.Errorf("failed to checksum batch %d of %s: %w", b.number, check.table, err)
+			}
+			if rows != b.rows || checksum != b.checksum {
+				return fmt.Errorf("batch %d of %s no longer matches the rows copied: %d rows with checksum %s, expected %d with checksum %s", b.number, check.table, rows, checksum, b.rows, b.checksum)
+			}
+		}
+		after = b.lastKey
+	}
+
+	fmt.Fprintf(r.out, "Verified %d rows in %d batches.\n", copied, len(batches))
+	return tx.Commit()
+}
+
+func (r *runner) swap(ctx context.Context) error {
+	fmt.Fprintf(r.out, "Swapping %s and %s.\n", r.steps.Table, r.steps.NewTable)
+	return r.inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, r.steps.Swap); err != nil {
+			return fmt.Errorf("failed to swap tables: %w", err)
+		}
+		return setPhase(ctx, tx, r.steps.Progress, phaseAfterSwap)
+	})
+}
+
+// finish validates the foreign keys and refreshes the materialized views after the swap,
+// and only then drops the progress table, so that a rerun never starts over on a table
+// that has already been swapped.
+func (r *runner) finish(ctx context.Context) error {
+	if r.steps.AfterSwap != "" {
+		if _, err := r.conn.ExecContext(ctx, r.steps.AfterSwap); err != nil {
+			return fmt.Errorf("failed to validate foreign keys and refresh materialized views: %w", err)
+		}
+	}
+	if _, err := r.conn.ExecContext(ctx, "DROP TABLE "+r.steps.Progress); err != nil {
+		return fmt.Errorf("failed to drop progress table: %w", err)
+	}
+
+	fmt.Fprintf(r.out, "Table %s rebuilt.\n", r.steps.Table)
+	return nil
+}
+
+// checkServer aborts the run while replicas lag too far behind or a transaction has been
+// open too long, since the copy adds to the former and the swap would queue behind the
+// latter.
+func (r *runner) checkServer(ctx context.Context) error {
+	if r.options.MaxReplicationLag > 0 {
+		var lag int64
+		if err := r.conn.QueryRowContext(ctx, ReplicationLagQuery).Scan(&lag); err != nil {
+			return fmt.Errorf("failed to check replication lag: %w", err)
+		}
+		if lag > r.options.MaxReplicationLag {
+			return fmt.Errorf("replication lag of %d bytes exceeds the limit of %d bytes", lag, r.options.MaxReplicationLag)
+		}
+	}
+
+	if r.options.MaxTransactionAge > 0 {
+		var pid int
+		var seconds float64
+		err := r.conn.QueryRowContext(ctx, OldestTransactionQuery).Scan(&pid, &seconds)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check for long running transactions: %w", err)
+		}
+		age := time.Duration(seconds * float64(time.Second))
+		if err == nil && age > r.options.MaxTransactionAge {
+			return fmt.Errorf("transaction of backend %d has been open for %s, longer than %s", pid, age.Round(time.Second), r.options.MaxTransactionAge)
+		}
+	}
+
+	return nil
+}
+
+func (r *runner) batches(ctx context.Context) ([]batch, error) {
+	rows, err := r.conn.QueryContext(ctx, fmt.Sprintf(BatchesQuery, r.steps.Progress))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read copied batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []batch
+	for rows.Next() {
+		var b batch
+		if err := rows.Scan(&b.number, pq.Array(&b.lastKey), &b.rows, &b.checksum); err != nil {
+			return nil, fmt.Errorf("failed to scan batch: %w", err)
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+// keyArgs binds a key to the parameters of a statement, none before the first batch.
+func (r *runner) keyArgs(key []string) []interface{} {
+	if key == nil {
+		return nil
+	}
+	args := make([]interface{}, r.steps.KeyLength)
+	for i := range key {
+		args[i] = key[i]
+	}
+	return args
+}
+
+func (r *runner) inTransaction(ctx context.Context, do func(tx *sql.Tx) error) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := do(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+func setPhase(ctx context.Context, tx *sql.Tx, progress string, phase string) error {
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(SetPhaseQuery, progress), phase); err != nil {
+		return fmt.Errorf("failed to record %s phase: %w", phase, err)
+	}
+	return nil
+}
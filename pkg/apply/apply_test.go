@@ -0,0 +1,225 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/estimate"
+	"main/pkg/migration"
+)
+
+var steps = migration.Steps{
+	Table:     "public.orders",
+	NewTable:  "public.orders_new",
+	Progress:  "public.orders_progress",
+	KeyLength: 1,
+	Prepare:   "CREATE TABLE public.orders_new (id bigint);",
+	Copy: migration.BatchStatement{
+		First: "WITH batch AS (INSERT INTO public.orders_new SELECT * FROM public.orders ORDER BY id",
+		Next:  "WITH batch AS (INSERT INTO public.orders_new SELECT * FROM public.orders WHERE (id) > ($1::bigint)",
+	},
+	SourceChecksum: migration.BatchStatement{
+		First: "SELECT count(*) FROM public.orders WHERE (id) <= ($1::bigint)",
+		Next:  "SELECT count(*) FROM public.orders WHERE (id) > ($1::bigint) AND (id) <= ($2::bigint)",
+	},
+	TargetChecksum: migration.BatchStatement{
+		First: "SELECT count(*) FROM public.orders_new WHERE (id) <= ($1::bigint)",
+		Next:  "SELECT count(*) FROM public.orders_new WHERE (id) > ($1::bigint) AND (id) <= ($2::bigint)",
+	},
+	Build:     "ALTER TABLE public.orders_new ADD CONSTRAINT orders_pkey_new PRIMARY KEY (id);",
+	Swap:      "ALTER TABLE public.orders RENAME TO orders_old;",
+	AfterSwap: "ALTER TABLE public.line_items VALIDATE CONSTRAINT line_items_order_id_fkey;",
+}
+
+func newConn(t *testing.T) (*sql.Conn, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectExec(regexp.QuoteMeta("SET lock_timeout = '5s'")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("SET statement_timeout = '1h'")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Conn failed: %v", err)
+	}
+	return conn, mock
+}
+
+func expectVerify(mock sqlmock.Sqlmock, batches *sqlmock.Rows, sourceChecksum string) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT batch, last_key, rows, checksum FROM public.orders_progress")).WillReturnRows(batches)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT (SELECT count(*) FROM public.orders), (SELECT count(*) FROM public.orders_new)")).
+		WillReturnRows(sqlmock.NewRows([]string{"source", "target"}).AddRow(3, 3))
+	mock.ExpectQuery(regexp.QuoteMeta(steps.SourceChecksum.First)).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "checksum"}).AddRow(2, sourceChecksum))
+}
+
+func TestRun(t *testing.T) {
+	conn, mock := newConn(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT to_regclass('public.orders_progress') IS NOT NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(steps.Prepare)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE public.orders_progress (")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT batch, last_key, rows, checksum FROM public.orders_progress")).
+		WillReturnRows(sqlmock.NewRows([]string{"batch", "last_key", "rows", "checksum"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT GREATEST(reltuples, 0)::bigint FROM pg_class WHERE oid = 'public.orders'::regclass")).
+		WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(4))
+
+	mock.ExpectQuery(regexp.QuoteMeta("pg_stat_replication")).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(steps.Copy.First)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "checksum", "id"}).AddRow(2, "aaa", "2"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO public.orders_progress (batch, last_key, rows, checksum)")).
+		WithArgs(1, "{\"2\"}", 2, "aaa").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(regexp.QuoteMeta("pg_stat_replication")).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(steps.Copy.Next)).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "checksum", "id"}).AddRow(1, "bbb", "3"))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO public.orders_progress (batch, last_key, rows, checksum)")).
+		WithArgs(2, "{\"3\"}", 1, "bbb").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(regexp.QuoteMeta("pg_stat_replication")).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(steps.Copy.Next)).WithArgs("3").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "checksum", "id"}).AddRow(0, "", nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE public.orders_progress SET phase = $1")).WithArgs("build").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(steps.Build)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE public.orders_progress SET phase = $1")).WithArgs("verify").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_table_size('public.orders_new'::regclass), pg_indexes_size('public.orders_new'::regclass)")).
+		WillReturnRows(sqlmock.NewRows([]string{"table", "indexes"}).AddRow(20<<20, 10<<20))
+
+	expectVerify(mock, sqlmock.NewRows([]string{"batch", "last_key", "rows", "checksum"}).AddRow(1, "{2}", 2, "aaa").AddRow(2, "{3}", 1, "bbb"), "aaa")
+	mock.ExpectQuery(regexp.QuoteMeta(steps.TargetChecksum.First)).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "checksum"}).AddRow(2, "aaa"))
+	mock.ExpectQuery(regexp.QuoteMeta(steps.SourceChecksum.Next)).WithArgs("2", "3").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "checksum"}).AddRow(1, "bbb"))
+	mock.ExpectQuery(regexp.QuoteMeta(steps.TargetChecksum.Next)).WithArgs("2", "3").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "checksum"}).AddRow(1, "bbb"))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(regexp.QuoteMeta("pg_stat_replication")).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(steps.Swap)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE public.orders_progress SET phase = $1")).WithArgs("after swap").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(steps.AfterSwap)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE public.orders_progress")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// The copy takes 10 seconds and the index builds 5.
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := []time.Time{start, start.Add(10 * time.Second), start.Add(10 * time.Second), start.Add(15 * time.Second)}
+	now = func() time.Time {
+		next := clock[0]
+		clock = clock[1:]
+		return next
+	}
+	defer func() { now = time.Now }()
+
+	throughputFile := filepath.Join(t.TempDir(), "throughput.json")
+	var out bytes.Buffer
+	err := Run(context.Background(), conn, steps, Options{MaxReplicationLag: 1 << 20, ThroughputFile: throughputFile}, &out)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "Creating public.orders_new.\n"+
+		"Batch 1: 2 of about 4 rows copied (50%).\n"+
+		"Batch 2: 3 of about 4 rows copied (75%).\n"+
+		"Copied 3 rows into public.orders_new.\n"+
+		"Building indexes and constraints of public.orders_new.\n"+
+		"The copy ran at 2.0 MiB/s and the index builds at 2.0 MiB/s.\n"+
+		"Saved the rates to "+throughputFile+" for the maintenance estimate of the report.\n"+
+		"Verified 3 rows in 2 batches.\n"+
+		"Swapping public.orders and public.orders_new.\n"+
+		"Table public.orders rebuilt.\n", out.String())
+
+	throughput, err := estimate.LoadThroughput(throughputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, estimate.Throughput{Copy: 2 * estimate.MiB, IndexBuild: 2 * estimate.MiB}, throughput)
+}
+
+func TestRun_ReplicationLag(t *testing.T) {
+	conn, mock := newConn(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass")).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT phase FROM public.orders_progress WHERE batch = 0")).
+		WillReturnRows(sqlmock.NewRows([]string{"phase"}).AddRow("copy"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT batch, last_key, rows, checksum FROM public.orders_progress")).
+		WillReturnRows(sqlmock.NewRows([]string{"batch", "last_key", "rows", "checksum"}).AddRow(1, "{2}", 2, "aaa"))
+	mock.ExpectQuery(regexp.QuoteMeta("reltuples")).WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta("pg_stat_replication")).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(2048))
+
+	var out bytes.Buffer
+	err := Run(context.Background(), conn, steps, Options{MaxReplicationLag: 1024}, &out)
+
+	assert.EqualError(t, err, "replication lag of 2048 bytes exceeds the limit of 1024 bytes")
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "Resuming the rebuild of public.orders at the copy phase.\n", out.String())
+}
+
+func TestRun_LongTransaction(t *testing.T) {
+	conn, mock := newConn(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass")).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT phase")).WillReturnRows(sqlmock.NewRows([]string{"phase"}).AddRow("copy"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT batch, last_key")).WillReturnRows(sqlmock.NewRows([]string{"batch", "last_key", "rows", "checksum"}))
+	mock.ExpectQuery(regexp.QuoteMeta("reltuples")).WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_stat_activity")).WillReturnRows(sqlmock.NewRows([]string{"pid", "age"}).AddRow(4242, 900.2))
+
+	err := Run(context.Background(), conn, steps, Options{MaxTransactionAge: 10 * time.Minute}, &bytes.Buffer{})
+
+	assert.EqualError(t, err, "transaction of backend 4242 has been open for 15m0s, longer than 10m0s")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_ChecksumMismatch(t *testing.T) {
+	conn, mock := newConn(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass")).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT phase")).WillReturnRows(sqlmock.NewRows([]string{"phase"}).AddRow("verify"))
+	expectVerify(mock, sqlmock.NewRows([]string{"batch", "last_key", "rows", "checksum"}).AddRow(1, "{2}", 2, "aaa").AddRow(2, "{3}", 1, "bbb"), "ccc")
+	mock.ExpectRollback()
+
+	err := Run(context.Background(), conn, steps, Options{}, &bytes.Buffer{})
+
+	assert.EqualError(t, err, "batch 1 of public.orders no longer matches the rows copied: 2 rows with checksum ccc, expected 2 with checksum aaa")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRun_ResumeAfterSwap(t *testing.T) {
+	conn, mock := newConn(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass")).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT phase")).WillReturnRows(sqlmock.NewRows([]string{"phase"}).AddRow("after swap"))
+	mock.ExpectExec(regexp.QuoteMeta(steps.AfterSwap)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE public.orders_progress")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var out bytes.Buffer
+	err := Run(context.Background(), conn, steps, Options{}, &out)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "Resuming the rebuild of public.orders at the after swap phase.\n"+
+		"Table public.orders rebuilt.\n", out.String())
+}
@@ -0,0 +1,167 @@
+package blame
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"main/pkg/common"
+	"main/pkg/layout"
+)
+
+const (
+	Created = "created"
+	Altered = "altered"
+	Dropped = "dropped"
+)
+
+// Snapshot is the columns of every table, keyed by qualified name, as they stand after
+// a step: a migration, or a commit of a schema file.
+type Snapshot struct {
+	Step   string
+	Tables map[string][]common.ColumnInfo
+}
+
+// Change is a step that changed the layout of a table. Padding and TupleSize are those
+// of a row without NULLs after the step, as the report computes them in the current
+// order. Columns are the columns whose padding the step increased, which a new column
+// starts from none.
+type Change struct {
+	Step      string
+	Kind      string
+	Padding   int
+	TupleSize int
+	Delta     int
+	Columns   []string
+}
+
+// Timeline is the changes of one table in step order.
+type Timeline struct {
+	Table   string
+	Changes []Change
+}
+
+// Grew reports whether a step of the timeline increased the table's padding.
+func (t Timeline) Grew() bool {
+	for _, change := range t.Changes {
+		if change.Delta > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Trace computes the layout of every table after each snapshot and records, per table,
+// the steps that changed it. Tables are returned in the order they first appear.
+func Trace(snapshots []Snapshot) []Timeline {
+	var timelines []*Timeline
+	var names []string
+	byTable := make(map[string]*Timeline)
+	previous := make(map[string][]common.ColumnInfo)
+
+	for _, snapshot := range snapshots {
+		// Tables a step creates join the order by name, as a map has no order of its own.
+		var created []string
+		for name := range snapshot.Tables {
+			if !slices.Contains(names, name) {
+				created = append(created, name)
+			}
+		}
+		sort.Strings(created)
+		names = append(names, created...)
+
+		for _, name := range names {
+			before, existed := previous[name]
+			after, exists := snapshot.Tables[name]
+			if (!existed && !exists) || (existed && exists && sameLayout(before, after)) {
+				continue
+			}
+
+			timeline := byTable[name]
+			if timeline == nil {
+				timeline = &Timeline{Table: name}
+				byTable[name] = timeline
+				timelines = append(timelines, timeline)
+			}
+
+			change := Change{Step: snapshot.Step, Kind: Altered}
+			switch {
+			case !existed:
+				change.Kind = Created
+			case !exists:
+				change.Kind = Dropped
+			}
+
+			paddingBefore := paddingByColumn(before)
+			if exists {
+				tupleLayout := layout.Compute(after)
+				change.Padding = tupleLayout.Padding
+				change.TupleSize = layout.Estimate(after).NoNulls.TupleSize
+				for i, col := range after {
+					if tupleLayout.Columns[i].Padding > paddingBefore[col.ColumnName] {
+						change.Columns = append(change.Columns, col.ColumnName)
+					}
+				}
+			}
+			if existed {
+				change.Delta = change.Padding - layout.Compute(before).Padding
+			} else {
+				change.Delta = change.Padding
+			}
+			timeline.Changes = append(timeline.Changes, change)
+		}
+
+		previous = snapshot.Tables
+	}
+
+	result := make([]Timeline, len(timelines))
+	for i, timeline := range timelines {
+		result[i] = *timeline
+	}
+	return result
+}
+
+// sameLayout reports whether two column lists lay a tuple out alike.
+func sameLayout(a, b []common.ColumnInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ColumnName != b[i].ColumnName || a[i].TypLen != b[i].TypLen || a[i].TypAlign != b[i].TypAlign ||
+			a[i].AvgWidth != b[i].AvgWidth || a[i].Storage != b[i].Storage {
+			return false
+		}
+	}
+	return true
+}
+
+func paddingByColumn(columnList []common.ColumnInfo) map[string]int {
+	padding := make(map[string]int)
+	tupleLayout := layout.Compute(columnList)
+	for i, col := range columnList {
+		padding[col.ColumnName] = tupleLayout.Columns[i].Padding
+	}
+	return padding
+}
+
+// Write renders timelines as a table per table, one line per change.
+func Write(w io.Writer, timelines []Timeline) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, timeline := range timelines {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "Table %s\n", timeline.Table)
+		for _, change := range timeline.Changes {
+			fmt.Fprintf(tw, "  %s\t%s\tpadding %d B (%+d B)\ttuple %d B", change.Step, change.Kind, change.Padding, change.Delta, change.TupleSize)
+			if change.Delta > 0 && len(change.Columns) > 0 {
+				fmt.Fprintf(tw, "\tpadding before %s", strings.Join(change.Columns, ", "))
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	return tw.Flush()
+}
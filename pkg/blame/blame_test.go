@@ -0,0 +1,60 @@
+package blame
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func column(name string, typLen, typAlign int) common.ColumnInfo {
+	return common.ColumnInfo{ColumnName: name, TypLen: typLen, TypAlign: typAlign, Storage: "p", IsNullable: "NO"}
+}
+
+func TestTrace(t *testing.T) {
+	id, flag, amount, created := column("id", 8, 8), column("flag", 1, 1), column("amount", 8, 8), column("created_at", 4, 4)
+	snapshots := []Snapshot{
+		{Step: "001_init.sql", Tables: map[string][]common.ColumnInfo{
+			"public.orders": {id, created},
+			"public.tags":   {column("tag", 2, 2)},
+		}},
+		{Step: "002_flag.sql", Tables: map[string][]common.ColumnInfo{
+			"public.orders": {id, created, flag},
+			"public.tags":   {column("tag", 2, 2)},
+		}},
+		{Step: "003_amount.sql", Tables: map[string][]common.ColumnInfo{
+			"public.orders": {id, created, flag, amount},
+		}},
+		{Step: "004_drop_flag.sql", Tables: map[string][]common.ColumnInfo{
+			"public.orders": {id, created, amount},
+		}},
+	}
+
+	timelines := Trace(snapshots)
+	assert.Equal(t, []Timeline{
+		{Table: "public.orders", Changes: []Change{
+			{Step: "001_init.sql", Kind: Created, Padding: 0, TupleSize: 40, Delta: 0},
+			{Step: "002_flag.sql", Kind: Altered, Padding: 0, TupleSize: 40, Delta: 0},
+			{Step: "003_amount.sql", Kind: Altered, Padding: 3, TupleSize: 48, Delta: 3, Columns: []string{"amount"}},
+			{Step: "004_drop_flag.sql", Kind: Altered, Padding: 4, TupleSize: 48, Delta: 1, Columns: []string{"amount"}},
+		}},
+		{Table: "public.tags", Changes: []Change{
+			{Step: "001_init.sql", Kind: Created, Padding: 0, TupleSize: 32, Delta: 0},
+			{Step: "003_amount.sql", Kind: Dropped, Padding: 0, TupleSize: 0, Delta: 0},
+		}},
+	}, timelines)
+	assert.True(t, timelines[0].Grew())
+	assert.False(t, timelines[1].Grew())
+
+	var out strings.Builder
+	if err := Write(&out, timelines[:1]); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	assert.Equal(t, "Table public.orders\n"+
+		"  001_init.sql       created  padding 0 B (+0 B)  tuple 40 B\n"+
+		"  002_flag.sql       altered  padding 0 B (+0 B)  tuple 40 B\n"+
+		"  003_amount.sql     altered  padding 3 B (+3 B)  tuple 48 B  padding before amount\n"+
+		"  004_drop_flag.sql  altered  padding 4 B (+1 B)  tuple 48 B  padding before amount\n", out.String())
+}
@@ -1,11 +1,110 @@
 package common
 
 type ColumnInfo struct {
-	OrdinalPosition int
-	ColumnName      string
-	DataType        string
-	IsNullable      string
-	EntryCount      int
-	TypLen          int
-	TypAlign        int
+	OrdinalPosition int     `json:"ordinalPosition"`
+	ColumnName      string  `json:"columnName"`
+	DataType        string  `json:"dataType"`
+	IsNullable      string  `json:"isNullable"`
+	EntryCount      int     `json:"entryCount"`
+	TypLen          int     `json:"typLen"`
+	TypAlign        int     `json:"typAlign"`
+	NullFrac        float64 `json:"nullFrac"`
+	AvgWidth        int     `json:"avgWidth"`
+	Storage         string  `json:"storage"`
+	Comment         string  `json:"comment"`
+
+	FormattedType string `json:"formattedType"`
+	Default       string `json:"default"`
+	NotNull       bool   `json:"notNull"`
+	Identity      string `json:"identity"`
+	Generated     string `json:"generated"`
+	Collation     string `json:"collation"`
+	TypStorage    string `json:"typStorage"`
+}
+
+type TableInfo struct {
+	Name              string `json:"name"`
+	RowCount          int    `json:"rowCount"`
+	TotalRelationSize int64  `json:"totalRelationSize"`
+	HeapSize          int64  `json:"heapSize"`
+	ToastSize         int64  `json:"toastSize"`
+	IndexesSize       int64  `json:"indexesSize"`
+
+	Unlogged    bool             `json:"unlogged"`
+	Options     string           `json:"options"`
+	Comment     string           `json:"comment"`
+	Constraints []ConstraintInfo `json:"constraints"`
+
+	Owner            string           `json:"owner"`
+	RowSecurity      bool             `json:"rowSecurity"`
+	ForceRowSecurity bool             `json:"forceRowSecurity"`
+	Indexes          []IndexInfo      `json:"indexes"`
+	Grants           []GrantInfo      `json:"grants"`
+	Policies         []PolicyInfo     `json:"policies"`
+	Triggers         []TriggerInfo    `json:"triggers"`
+	Sequences        []SequenceInfo   `json:"sequences"`
+	ReferencedBy     []ConstraintInfo `json:"referencedBy"`
+	Dependencies     []DependencyInfo `json:"dependencies"`
+}
+
+// ConstraintInfo describes a constraint as pg_get_constraintdef renders it. Table is the
+// qualified name of the table the constraint is on, set for foreign keys referencing
+// another table.
+type ConstraintInfo struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Definition string   `json:"definition"`
+	Columns    []string `json:"columns"`
+	Table      string   `json:"table"`
+}
+
+// IndexInfo describes an index that does not back a constraint.
+type IndexInfo struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// GrantInfo is one privilege granted on the table, or on one of its columns when Column
+// is set. An empty Grantee stands for PUBLIC.
+type GrantInfo struct {
+	Grantee   string `json:"grantee"`
+	Privilege string `json:"privilege"`
+	Grantable bool   `json:"grantable"`
+	Column    string `json:"column"`
+}
+
+type PolicyInfo struct {
+	Name       string   `json:"name"`
+	Permissive bool     `json:"permissive"`
+	Command    string   `json:"command"`
+	Roles      []string `json:"roles"`
+	Using      string   `json:"using"`
+	WithCheck  string   `json:"withCheck"`
+}
+
+type TriggerInfo struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// SequenceInfo is a sequence owned by a column, either through OWNED BY for serial
+// columns or as the sequence behind an identity column.
+type SequenceInfo struct {
+	Name     string `json:"name"`
+	Column   string `json:"column"`
+	Identity bool   `json:"identity"`
+}
+
+// DependencyInfo is an object that depends on the table beyond its foreign keys, as found
+// through pg_depend and pg_rewrite. Name is the SQL name of the object: qualified for
+// relations, with argument types for functions and with its table for rules. Depth counts
+// the views between the table and a view that depends on it indirectly.
+type DependencyInfo struct {
+	Kind       string      `json:"kind"`
+	Name       string      `json:"name"`
+	Definition string      `json:"definition"`
+	Owner      string      `json:"owner"`
+	Options    string      `json:"options"`
+	Depth      int         `json:"depth"`
+	Grants     []GrantInfo `json:"grants"`
 }
@@ -0,0 +1,279 @@
+package constraint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"main/pkg/common"
+	"main/pkg/layout"
+)
+
+// Pin scopes a layout.Pin to a table. An empty Table applies the pin to every table that
+// has the column.
+type Pin struct {
+	Table string
+	layout.Pin
+}
+
+// Group scopes a layout.Group to a table. An empty Table applies the group to every table
+// that has at least two of its columns.
+type Group struct {
+	Table string
+	layout.Group
+}
+
+// pinFile is a pin as a config file writes it, with its position as "first", "last", a
+// 1-based position, or a negative position counting back from the end.
+type pinFile struct {
+	Table    string `json:"table,omitempty"`
+	Column   string `json:"column"`
+	Position string `json:"position"`
+}
+
+type groupFile struct {
+	Table   string   `json:"table,omitempty"`
+	Columns []string `json:"columns"`
+	Ordered bool     `json:"ordered,omitempty"`
+}
+
+func (p *Pin) UnmarshalJSON(data []byte) error {
+	var file pinFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	position, err := parsePosition(file.Position)
+	if err != nil {
+		return fmt.Errorf("invalid pin for column %s: %w", file.Column, err)
+	}
+	*p = Pin{Table: file.Table, Pin: layout.Pin{Column: file.Column, Position: position}}
+	return nil
+}
+
+func (g *Group) UnmarshalJSON(data []byte) error {
+	var file groupFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	*g = Group{Table: file.Table, Group: layout.Group{Columns: file.Columns, Ordered: file.Ordered}}
+	return nil
+}
+
+// Set holds ordering constraints gathered from the CLI, a config file or column comments.
+type Set struct {
+	Pins   []Pin   `json:"pins,omitempty"`
+	Groups []Group `json:"groups,omitempty"`
+}
+
+var (
+	pinAnnotation   = regexp.MustCompile(`@pin:(first|last|-?\d+)`)
+	groupAnnotation = regexp.MustCompile(`@group:(\w+)(:ordered)?`)
+)
+
+// Load reads a constraint set from a JSON config file.
+func Load(path string) (Set, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Set{}, fmt.Errorf("unable to read constraints file %s: %w", path, err)
+	}
+
+	var set Set
+	if err := json.Unmarshal(content, &set); err != nil {
+		return Set{}, fmt.Errorf("unable to parse constraints file %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// ParsePin parses a pin flag of the form [table.]column=position.
+func ParsePin(spec string) (Pin, error) {
+	name, position, found := strings.Cut(spec, "=")
+	if !found || name == "" {
+		return Pin{}, fmt.Errorf("invalid pin %q, expected [table.]column=position", spec)
+	}
+	value, err := parsePosition(position)
+	if err != nil {
+		return Pin{}, fmt.Errorf("invalid pin %q: %w", spec, err)
+	}
+
+	table, column := splitQualifiedName(name)
+	return Pin{Table: table, Pin: layout.Pin{Column: column, Position: value}}, nil
+}
+
+// ParseGroup parses a group flag of the form [table.]column,[table.]column,... where
+// any qualified columns must all name the same table.
+func ParseGroup(spec string, ordered bool) (Group, error) {
+	names := strings.Split(spec, ",")
+	if len(names) < 2 {
+		return Group{}, fmt.Errorf("invalid group %q, expected at least two comma-separated columns", spec)
+	}
+
+	group := Group{Group: layout.Group{Ordered: ordered}}
+	for _, name := range names {
+		table, column := splitQualifiedName(strings.TrimSpace(name))
+		if table != "" {
+			if group.Table != "" && group.Table != table {
+				return Group{}, fmt.Errorf("invalid group %q, columns belong to different tables", spec)
+			}
+			group.Table = table
+		}
+		group.Columns = append(group.Columns, column)
+	}
+	return group, nil
+}
+
+// FromComments collects @pin:<position> and @group:<name>[:ordered] annotations from
+// the column comments of a table. Columns sharing a group name are kept adjacent, in
+// their current order if any of them is marked ordered.
+func FromComments(table string, columnList []common.ColumnInfo) Set {
+	var set Set
+	groups := make(map[string]*Group)
+
+	for _, col := range columnList {
+		if match := pinAnnotation.FindStringSubmatch(col.Comment); match != nil {
+			// @pin:0 parses as position 0, which the layout rejects as out of range.
+			position, _ := parsePosition(match[1])
+			set.Pins = append(set.Pins, Pin{Table: table, Pin: layout.Pin{Column: col.ColumnName, Position: position}})
+		}
+
+		if match := groupAnnotation.FindStringSubmatch(col.Comment); match != nil {
+			group, exists := groups[match[1]]
+			if !exists {
+				group = &Group{Table: table}
+				groups[match[1]] = group
+			}
+			group.Columns = append(group.Columns, col.ColumnName)
+			group.Ordered = group.Ordered || match[2] != ""
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(groups[name].Columns) > 1 {
+			set.Groups = append(set.Groups, *groups[name])
+		}
+	}
+
+	return set
+}
+
+// Merge layers other over s. A pin in other replaces any pin of the same column in s,
+// and a group in other replaces the groups in s it shares a column with.
+func (s Set) Merge(other Set) Set {
+	var merged Set
+
+	for _, pin := range s.Pins {
+		if !overridesPin(other.Pins, pin) {
+			merged.Pins = append(merged.Pins, pin)
+		}
+	}
+	merged.Pins = append(merged.Pins, other.Pins...)
+
+	for _, group := range s.Groups {
+		if !overridesGroup(other.Groups, group) {
+			merged.Groups = append(merged.Groups, group)
+		}
+	}
+	merged.Groups = append(merged.Groups, other.Groups...)
+
+	return merged
+}
+
+// ForTable resolves the constraints that apply to a table. Unqualified rules are skipped
+// for columns the table does not have; rules naming the table must match its columns.
+func (s Set) ForTable(table string, columnList []common.ColumnInfo) (layout.Constraints, error) {
+	exists := make(map[string]bool, len(columnList))
+	for _, col := range columnList {
+		exists[col.ColumnName] = true
+	}
+
+	var constraints layout.Constraints
+
+	for _, pin := range s.Pins {
+		if pin.Table != "" && pin.Table != table {
+			continue
+		}
+		if !exists[pin.Column] {
+			if pin.Table != "" {
+				return layout.Constraints{}, fmt.Errorf("pinned column %s does not exist in table %s", pin.Column, table)
+			}
+			continue
+		}
+
+		constraints.Pins = append(constraints.Pins, pin.Pin)
+	}
+
+	for _, group := range s.Groups {
+		if group.Table != "" && group.Table != table {
+			continue
+		}
+
+		var columns []string
+		for _, column := range group.Columns {
+			if exists[column] {
+				columns = append(columns, column)
+			} else if group.Table != "" {
+				return layout.Constraints{}, fmt.Errorf("grouped column %s does not exist in table %s", column, table)
+			}
+		}
+		if len(columns) > 1 {
+			constraints.Groups = append(constraints.Groups, layout.Group{Columns: columns, Ordered: group.Ordered})
+		}
+	}
+
+	return constraints, nil
+}
+
+func parsePosition(position string) (int, error) {
+	switch position {
+	case "first":
+		return 1, nil
+	case "last":
+		return -1, nil
+	}
+
+	value, err := strconv.Atoi(position)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("position %q must be first, last or a non-zero integer", position)
+	}
+	return value, nil
+}
+
+func splitQualifiedName(name string) (string, string) {
+	if table, column, found := strings.Cut(name, "."); found {
+		return table, column
+	}
+	return "", name
+}
+
+func overridesPin(pins []Pin, pin Pin) bool {
+	for _, other := range pins {
+		if other.Column == pin.Column && (other.Table == "" || other.Table == pin.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+func overridesGroup(groups []Group, group Group) bool {
+	for _, other := range groups {
+		if other.Table != "" && group.Table != "" && other.Table != group.Table {
+			continue
+		}
+		for _, column := range other.Columns {
+			for _, existing := range group.Columns {
+				if column == existing {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
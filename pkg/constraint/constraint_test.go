@@ -0,0 +1,129 @@
+package constraint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/layout"
+)
+
+var columnList = []common.ColumnInfo{
+	{OrdinalPosition: 1, ColumnName: "id"},
+	{OrdinalPosition: 2, ColumnName: "name"},
+	{OrdinalPosition: 3, ColumnName: "created_at", Comment: "Row creation time @group:audit:ordered"},
+	{OrdinalPosition: 4, ColumnName: "updated_at", Comment: "@group:audit @pin:last"},
+}
+
+func TestParsePin(t *testing.T) {
+	pin, err := ParsePin("orders.id=first")
+	assert.NoError(t, err)
+	assert.Equal(t, Pin{Table: "orders", Pin: layout.Pin{Column: "id", Position: 1}}, pin)
+
+	pin, err = ParsePin("updated_at=-1")
+	assert.NoError(t, err)
+	assert.Equal(t, Pin{Pin: layout.Pin{Column: "updated_at", Position: -1}}, pin)
+
+	for _, spec := range []string{"id", "=first", "id=middle", "id=0"} {
+		_, err := ParsePin(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseGroup(t *testing.T) {
+	group, err := ParseGroup("created_at, updated_at", true)
+	assert.NoError(t, err)
+	assert.Equal(t, Group{Group: layout.Group{Columns: []string{"created_at", "updated_at"}, Ordered: true}}, group)
+
+	group, err = ParseGroup("orders.created_at,updated_at", false)
+	assert.NoError(t, err)
+	assert.Equal(t, Group{Table: "orders", Group: layout.Group{Columns: []string{"created_at", "updated_at"}}}, group)
+
+	_, err = ParseGroup("created_at", false)
+	assert.Error(t, err)
+
+	_, err = ParseGroup("orders.created_at,users.updated_at", false)
+	assert.Error(t, err)
+}
+
+func TestFromComments(t *testing.T) {
+	set := FromComments("orders", columnList)
+
+	assert.Equal(t, []Pin{{Table: "orders", Pin: layout.Pin{Column: "updated_at", Position: -1}}}, set.Pins)
+	assert.Equal(t, []Group{{Table: "orders", Group: layout.Group{Columns: []string{"created_at", "updated_at"}, Ordered: true}}}, set.Groups)
+}
+
+func TestMerge(t *testing.T) {
+	base := Set{
+		Pins:   []Pin{{Pin: layout.Pin{Column: "id", Position: 2}}, {Pin: layout.Pin{Column: "name", Position: 3}}},
+		Groups: []Group{{Group: layout.Group{Columns: []string{"created_at", "updated_at"}}}, {Group: layout.Group{Columns: []string{"id", "name"}}}},
+	}
+	override := Set{
+		Pins:   []Pin{{Pin: layout.Pin{Column: "id", Position: 1}}},
+		Groups: []Group{{Group: layout.Group{Columns: []string{"updated_at", "deleted_at"}, Ordered: true}}},
+	}
+
+	merged := base.Merge(override)
+
+	assert.Equal(t, []Pin{{Pin: layout.Pin{Column: "name", Position: 3}}, {Pin: layout.Pin{Column: "id", Position: 1}}}, merged.Pins)
+	assert.Equal(t, []Group{{Group: layout.Group{Columns: []string{"id", "name"}}}, {Group: layout.Group{Columns: []string{"updated_at", "deleted_at"}, Ordered: true}}}, merged.Groups)
+}
+
+func TestForTable(t *testing.T) {
+	set := Set{
+		Pins: []Pin{
+			{Pin: layout.Pin{Column: "id", Position: 1}},
+			{Pin: layout.Pin{Column: "deleted_at", Position: -1}},
+			{Table: "users", Pin: layout.Pin{Column: "email", Position: 2}},
+		},
+		Groups: []Group{
+			{Group: layout.Group{Columns: []string{"created_at", "updated_at", "deleted_at"}, Ordered: true}},
+			{Group: layout.Group{Columns: []string{"name", "archived"}}},
+		},
+	}
+
+	constraints, err := set.ForTable("orders", columnList)
+
+	assert.NoError(t, err)
+	assert.Equal(t, layout.Constraints{
+		Pins:   []layout.Pin{{Column: "id", Position: 1}},
+		Groups: []layout.Group{{Columns: []string{"created_at", "updated_at"}, Ordered: true}},
+	}, constraints)
+}
+
+func TestForTable_QualifiedColumnMissing(t *testing.T) {
+	set := Set{Pins: []Pin{{Table: "orders", Pin: layout.Pin{Column: "email", Position: 2}}}}
+
+	_, err := set.ForTable("orders", columnList)
+
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "constraints.json")
+	content := `{
+		"pins": [{"column": "id", "position": "first"}, {"table": "orders", "column": "updated_at", "position": "last"}],
+		"groups": [{"columns": ["created_at", "updated_at"], "ordered": true}]
+	}`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	set, err := Load(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Set{
+		Pins:   []Pin{{Pin: layout.Pin{Column: "id", Position: 1}}, {Table: "orders", Pin: layout.Pin{Column: "updated_at", Position: -1}}},
+		Groups: []Group{{Group: layout.Group{Columns: []string{"created_at", "updated_at"}, Ordered: true}}},
+	}, set)
+}
+
+func TestLoad_InvalidPosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "constraints.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"pins": [{"column": "id", "position": "start"}]}`), 0o644))
+
+	_, err := Load(path)
+
+	assert.Error(t, err)
+}
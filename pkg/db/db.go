@@ -18,8 +18,23 @@ type Config struct {
 
 var sqlOpen = sql.Open
 
+// Connect opens a session whose transactions are read only, which is all the reports and
+// plans need.
 func Connect(config Config) (*sql.DB, error) {
+	return open(config, "default_transaction_read_only=on")
+}
+
+// ConnectForWrites opens a session that can change the database. Only commands that
+// apply a migration use it.
+func ConnectForWrites(config Config) (*sql.DB, error) {
+	return open(config, "")
+}
+
+func open(config Config, options string) (*sql.DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=disable", config.Host, config.Port, config.DBName, config.UserName, config.Password)
+	if options != "" {
+		connStr += " " + options
+	}
 
 	db, err := sqlOpen("postgres", connStr)
 	if err != nil {
@@ -35,6 +35,31 @@ func TestConnectSuccess(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestConnectReadOnly(t *testing.T) {
+	config := Config{DBName: "testdb", UserName: "testuser", Password: "testpass", Host: "localhost", Port: "5432"}
+
+	var dataSources []string
+	sqlOpen = func(driverName, dataSourceName string) (*sql.DB, error) {
+		dataSources = append(dataSources, dataSourceName)
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			return nil, err
+		}
+		mock.ExpectPing()
+		return db, nil
+	}
+
+	_, err := Connect(config)
+	assert.NoError(t, err)
+	_, err = ConnectForWrites(config)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"host=localhost port=5432 dbname=testdb user=testuser password=testpass sslmode=disable default_transaction_read_only=on",
+		"host=localhost port=5432 dbname=testdb user=testuser password=testpass sslmode=disable",
+	}, dataSources)
+}
+
 func TestMain(m *testing.M) {
 	defer func() {
 		sqlOpen = sql.Open
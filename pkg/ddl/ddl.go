@@ -0,0 +1,113 @@
+package ddl
+
+import (
+	"fmt"
+	"strings"
+
+	"main/pkg/common"
+)
+
+var storageNames = map[string]string{
+	"p": "PLAIN",
+	"e": "EXTERNAL",
+	"m": "MAIN",
+	"x": "EXTENDED",
+}
+
+// CreateTable renders table as a CREATE TABLE statement with its columns in the order of
+// columnList, followed by the storage settings and comments that CREATE TABLE cannot
+// carry. Indexes other than those backing constraints, triggers, policies and grants are
+// not part of the definition.
+func CreateTable(schemaName string, table common.TableInfo, columnList []common.ColumnInfo) string {
+	name := QualifiedName(schemaName, table.Name)
+
+	var elements []string
+	for _, col := range columnList {
+		elements = append(elements, columnDefinition(col))
+	}
+	for _, constraint := range table.Constraints {
+		elements = append(elements, fmt.Sprintf("CONSTRAINT %s %s", QuoteIdent(constraint.Name), constraint.Definition))
+	}
+
+	var statement strings.Builder
+	statement.WriteString("CREATE ")
+	if table.Unlogged {
+		statement.WriteString("UNLOGGED ")
+	}
+	fmt.Fprintf(&statement, "TABLE %s (\n    %s\n)", name, strings.Join(elements, ",\n    "))
+	if table.Options != "" {
+		fmt.Fprintf(&statement, "\nWITH (%s)", table.Options)
+	}
+	statement.WriteString(";\n")
+
+	for _, col := range columnList {
+		if col.Storage != "" && col.TypStorage != "" && col.Storage != col.TypStorage {
+			fmt.Fprintf(&statement, "ALTER TABLE ONLY %s ALTER COLUMN %s SET STORAGE %s;\n", name, QuoteIdent(col.ColumnName), storageNames[col.Storage])
+		}
+	}
+
+	if table.Comment != "" {
+		fmt.Fprintf(&statement, "COMMENT ON TABLE %s IS %s;\n", name, QuoteLiteral(table.Comment))
+	}
+	for _, col := range columnList {
+		if col.Comment != "" {
+			fmt.Fprintf(&statement, "COMMENT ON COLUMN %s.%s IS %s;\n", name, QuoteIdent(col.ColumnName), QuoteLiteral(col.Comment))
+		}
+	}
+
+	return statement.String()
+}
+
+func columnDefinition(col common.ColumnInfo) string {
+	dataType := col.FormattedType
+	if dataType == "" {
+		dataType = col.DataType
+	}
+
+	definition := []string{QuoteIdent(col.ColumnName), dataType}
+	if col.Collation != "" {
+		definition = append(definition, "COLLATE "+col.Collation)
+	}
+
+	switch {
+	case col.Generated == "s":
+		definition = append(definition, fmt.Sprintf("GENERATED ALWAYS AS (%s) STORED", col.Default))
+	case col.Generated == "v":
+		definition = append(definition, fmt.Sprintf("GENERATED ALWAYS AS (%s) VIRTUAL", col.Default))
+	case col.Identity == "a":
+		definition = append(definition, "GENERATED ALWAYS AS IDENTITY")
+	case col.Identity == "d":
+		definition = append(definition, "GENERATED BY DEFAULT AS IDENTITY")
+	case col.Default != "":
+		definition = append(definition, "DEFAULT "+col.Default)
+	}
+
+	if col.NotNull || col.IsNullable == "NO" {
+		definition = append(definition, "NOT NULL")
+	}
+
+	return strings.Join(definition, " ")
+}
+
+// ReorderByName returns the columns in the order of names. Columns missing from names
+// keep their relative order after the named ones.
+func ReorderByName(columnList []common.ColumnInfo, names []string) []common.ColumnInfo {
+	byName := make(map[string]common.ColumnInfo, len(columnList))
+	for _, col := range columnList {
+		byName[col.ColumnName] = col
+	}
+
+	reordered := make([]common.ColumnInfo, 0, len(columnList))
+	for _, name := range names {
+		if col, exists := byName[name]; exists {
+			reordered = append(reordered, col)
+			delete(byName, name)
+		}
+	}
+	for _, col := range columnList {
+		if _, remaining := byName[col.ColumnName]; remaining {
+			reordered = append(reordered, col)
+		}
+	}
+	return reordered
+}
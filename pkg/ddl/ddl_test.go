@@ -0,0 +1,68 @@
+package ddl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func TestCreateTable(t *testing.T) {
+	table := common.TableInfo{
+		Name:    "orders",
+		Options: "fillfactor=70",
+		Comment: "Customer's orders",
+		Constraints: []common.ConstraintInfo{
+			{Name: "orders_pkey", Type: "p", Definition: "PRIMARY KEY (id)"},
+			{Name: "orders_total_check", Type: "c", Definition: "CHECK ((total >= (0)::numeric))"},
+			{Name: "orders_customer_id_fkey", Type: "f", Definition: "FOREIGN KEY (customer_id) REFERENCES customers(id)"},
+		},
+	}
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", FormattedType: "bigint", IsNullable: "NO", NotNull: true, Identity: "a", Storage: "p", TypStorage: "p"},
+		{ColumnName: "customer_id", FormattedType: "integer", IsNullable: "NO", NotNull: true, Storage: "p", TypStorage: "p"},
+		{ColumnName: "total", FormattedType: "numeric(10,2)", IsNullable: "YES", Default: "0", Storage: "m", TypStorage: "m"},
+		{ColumnName: "total_with_tax", FormattedType: "numeric(10,2)", IsNullable: "YES", Default: "(total * 1.2)", Generated: "s", Storage: "m", TypStorage: "m"},
+		{ColumnName: "Note", FormattedType: "character varying(200)", IsNullable: "YES", Collation: `pg_catalog."C"`, Storage: "e", TypStorage: "x", Comment: "free text"},
+	}
+
+	expected := `CREATE TABLE public.orders (
+    id bigint GENERATED ALWAYS AS IDENTITY NOT NULL,
+    customer_id integer NOT NULL,
+    total numeric(10,2) DEFAULT 0,
+    total_with_tax numeric(10,2) GENERATED ALWAYS AS ((total * 1.2)) STORED,
+    "Note" character varying(200) COLLATE pg_catalog."C",
+    CONSTRAINT orders_pkey PRIMARY KEY (id),
+    CONSTRAINT orders_total_check CHECK ((total >= (0)::numeric)),
+    CONSTRAINT orders_customer_id_fkey FOREIGN KEY (customer_id) REFERENCES customers(id)
+)
+WITH (fillfactor=70);
+ALTER TABLE ONLY public.orders ALTER COLUMN "Note" SET STORAGE EXTERNAL;
+COMMENT ON TABLE public.orders IS 'Customer''s orders';
+COMMENT ON COLUMN public.orders."Note" IS 'free text';
+`
+	assert.Equal(t, expected, CreateTable("public", table, columnList))
+}
+
+func TestCreateTable_Unlogged(t *testing.T) {
+	table := common.TableInfo{Name: "events", Unlogged: true}
+	columnList := []common.ColumnInfo{
+		{ColumnName: "payload", DataType: "jsonb", IsNullable: "YES", Identity: "", Default: ""},
+		{ColumnName: "seen", FormattedType: "integer", IsNullable: "NO", Identity: "d"},
+	}
+
+	expected := `CREATE UNLOGGED TABLE public.events (
+    payload jsonb,
+    seen integer GENERATED BY DEFAULT AS IDENTITY NOT NULL
+);
+`
+	assert.Equal(t, expected, CreateTable("public", table, columnList))
+}
+
+func TestReorderByName(t *testing.T) {
+	columnList := []common.ColumnInfo{{ColumnName: "a"}, {ColumnName: "b"}, {ColumnName: "c"}, {ColumnName: "d"}}
+
+	reordered := ReorderByName(columnList, []string{"c", "a"})
+	assert.Equal(t, []common.ColumnInfo{{ColumnName: "c"}, {ColumnName: "a"}, {ColumnName: "b"}, {ColumnName: "d"}}, reordered)
+}
@@ -0,0 +1,57 @@
+package ddl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// plainIdentifier matches the names quote_ident leaves unquoted, keywords aside: it quotes
+// any other character, $ included, although $ is valid in an unquoted identifier.
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// keywords lists the reserved, type and function name, and column name keywords of
+// PostgreSQL: every keyword quote_ident would quote.
+var keywords = map[string]bool{}
+
+func init() {
+	for _, keyword := range strings.Fields(`
+		all analyse analyze and any array as asc asymmetric both case cast check collate column
+		constraint create current_catalog current_date current_role current_time current_timestamp
+		current_user default deferrable desc distinct do else end except false fetch for foreign
+		from grant group having in initially intersect into lateral leading limit localtime
+		localtimestamp not null offset on only or order placing primary references returning
+		select session_user some symmetric system_user table then to trailing true union unique
+		user using variadic when where window with
+
+		authorization binary collation concurrently cross current_schema freeze full ilike inner
+		is isnull join left like natural notnull outer overlaps right similar tablesample verbose
+
+		between bigint bit boolean char character coalesce dec decimal exists extract float
+		greatest grouping inout int integer interval json json_array json_arrayagg json_exists
+		json_object json_objectagg json_query json_scalar json_serialize json_table json_value
+		least merge_action national nchar none normalize nullif numeric out overlay position
+		precision real row setof smallint substring time timestamp treat trim values varchar
+		xmlattributes xmlconcat xmlelement xmlexists xmlforest xmlnamespaces xmlparse xmlpi
+		xmlroot xmlserialize xmltable`) {
+		keywords[keyword] = true
+	}
+}
+
+// QuoteIdent quotes an identifier the way quote_ident does: only when it is not a plain
+// lower-case name or clashes with a keyword.
+func QuoteIdent(name string) string {
+	if plainIdentifier.MatchString(name) && !keywords[name] {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteLiteral quotes a string constant, assuming standard_conforming_strings is on.
+func QuoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// QualifiedName quotes a schema-qualified name.
+func QualifiedName(schemaName, name string) string {
+	return QuoteIdent(schemaName) + "." + QuoteIdent(name)
+}
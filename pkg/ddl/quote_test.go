@@ -0,0 +1,24 @@
+package ddl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	assert.Equal(t, "created_at", QuoteIdent("created_at"))
+	assert.Equal(t, `"price$"`, QuoteIdent("price$"))
+	assert.Equal(t, `"CreatedAt"`, QuoteIdent("CreatedAt"))
+	assert.Equal(t, `"user"`, QuoteIdent("user"))
+	assert.Equal(t, `"1st"`, QuoteIdent("1st"))
+	assert.Equal(t, `"say ""hi"""`, QuoteIdent(`say "hi"`))
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	assert.Equal(t, "'it''s'", QuoteLiteral("it's"))
+}
+
+func TestQualifiedName(t *testing.T) {
+	assert.Equal(t, `public."Order"`, QualifiedName("public", "Order"))
+}
@@ -0,0 +1,115 @@
+package dependency
+
+import (
+	"fmt"
+	"strings"
+
+	"main/pkg/common"
+)
+
+// Kinds of dependent objects, as reported by the catalog queries.
+const (
+	KindView             = "view"
+	KindMaterializedView = "materialized view"
+	KindRule             = "rule"
+	KindFunction         = "function"
+	KindStarFunction     = "function using *"
+	KindInheritanceChild = "inheritance child"
+	KindPartition        = "partition"
+	KindPublication      = "publication"
+	KindForeignKey       = "foreign key"
+)
+
+// Action is what a rebuild of the table has to do about a dependent object.
+type Action string
+
+const (
+	// Recreate objects are bound to the table itself rather than to its name, so they are
+	// dropped before the swap and created again afterwards.
+	Recreate Action = "recreate"
+	// Retarget objects are pointed at the rebuilt table without being dropped.
+	Retarget Action = "retarget"
+	// Review objects are left alone, but what they return follows the column order.
+	Review Action = "review"
+	// Manual objects cannot be carried over by a rebuild.
+	Manual Action = "manual"
+)
+
+var actions = map[string]Action{
+	KindView:             Recreate,
+	KindMaterializedView: Recreate,
+	KindRule:             Recreate,
+	KindFunction:         Recreate,
+	KindStarFunction:     Review,
+	KindInheritanceChild: Manual,
+	KindPartition:        Manual,
+	KindPublication:      Retarget,
+	KindForeignKey:       Retarget,
+}
+
+type Dependency struct {
+	common.DependencyInfo
+	Action Action
+}
+
+// Analyze lists the objects that depend on a table together with what a rebuild has to do
+// about each of them. Foreign keys of other tables referencing it are listed last.
+func Analyze(table common.TableInfo) []Dependency {
+	recreated := make(map[string]bool)
+	for _, info := range table.Dependencies {
+		if info.Kind == KindFunction {
+			recreated[info.Name] = true
+		}
+	}
+
+	var dependencies []Dependency
+	for _, info := range table.Dependencies {
+		// A function bound to the table is recreated whether or not it also uses *.
+		if info.Kind == KindStarFunction && recreated[info.Name] {
+			continue
+		}
+
+		action, exists := actions[info.Kind]
+		if !exists {
+			action = Manual
+		}
+		dependencies = append(dependencies, Dependency{DependencyInfo: info, Action: action})
+	}
+
+	for _, constraint := range table.ReferencedBy {
+		dependencies = append(dependencies, Dependency{
+			DependencyInfo: common.DependencyInfo{
+				Kind:       KindForeignKey,
+				Name:       constraint.Name + " ON " + constraint.Table,
+				Definition: constraint.Definition,
+			},
+			Action: Retarget,
+		})
+	}
+	return dependencies
+}
+
+// Count returns how many dependencies call for the given action.
+func Count(dependencies []Dependency, action Action) int {
+	count := 0
+	for _, dependency := range dependencies {
+		if dependency.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Blocking returns an error naming the dependencies a rebuild cannot carry over, if any.
+func Blocking(tableName string, dependencies []Dependency) error {
+	var names []string
+	for _, dependency := range dependencies {
+		if dependency.Action == Manual {
+			names = append(names, fmt.Sprintf("%s %s", dependency.Kind, dependency.Name))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("table %s cannot be rebuilt while it has dependent objects that need manual work: %s", tableName, strings.Join(names, ", "))
+}
@@ -0,0 +1,57 @@
+package dependency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func TestAnalyze(t *testing.T) {
+	table := common.TableInfo{
+		Name: "orders",
+		Dependencies: []common.DependencyInfo{
+			{Kind: KindView, Name: "public.order_totals", Depth: 1},
+			{Kind: KindFunction, Name: "public.recent_orders(integer)"},
+			{Kind: KindStarFunction, Name: "public.recent_orders(integer)"},
+			{Kind: KindStarFunction, Name: "public.export_orders()"},
+			{Kind: KindPublication, Name: "orders_pub"},
+		},
+		ReferencedBy: []common.ConstraintInfo{
+			{Name: "line_items_order_id_fkey", Type: "f", Definition: "FOREIGN KEY (order_id) REFERENCES orders(id)", Table: "public.line_items"},
+		},
+	}
+
+	dependencies := Analyze(table)
+
+	var got []string
+	for _, dependency := range dependencies {
+		got = append(got, string(dependency.Action)+" "+dependency.Kind+" "+dependency.Name)
+	}
+	assert.Equal(t, []string{
+		"recreate view public.order_totals",
+		"recreate function public.recent_orders(integer)",
+		"review function using * public.export_orders()",
+		"retarget publication orders_pub",
+		"retarget foreign key line_items_order_id_fkey ON public.line_items",
+	}, got)
+
+	assert.Equal(t, 2, Count(dependencies, Recreate))
+	assert.Equal(t, 2, Count(dependencies, Retarget))
+	assert.NoError(t, Blocking("orders", dependencies))
+}
+
+func TestBlocking(t *testing.T) {
+	dependencies := Analyze(common.TableInfo{
+		Name: "events",
+		Dependencies: []common.DependencyInfo{
+			{Kind: KindInheritanceChild, Name: "public.events_2023"},
+			{Kind: KindView, Name: "public.recent_events", Depth: 1},
+			{Kind: KindPartition, Name: "public.events_2024"},
+		},
+	})
+
+	err := Blocking("events", dependencies)
+	assert.EqualError(t, err, "table events cannot be rebuilt while it has dependent objects that need manual work: inheritance child public.events_2023, partition public.events_2024")
+}
@@ -0,0 +1,93 @@
+package estimate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"main/pkg/common"
+	"main/pkg/layout"
+)
+
+const MiB = 1 << 20
+
+// Throughput is how many bytes per second a rebuild copies into the new table and
+// builds indexes from.
+type Throughput struct {
+	Copy       float64 `json:"copy"`
+	IndexBuild float64 `json:"indexBuild"`
+}
+
+// DefaultThroughput is a conservative guess for a server under normal load, to be
+// replaced by what apply measures on the actual server.
+var DefaultThroughput = Throughput{Copy: 50 * MiB, IndexBuild: 20 * MiB}
+
+// SaveThroughput writes the throughput apply measured to path, for LoadThroughput.
+func SaveThroughput(path string, throughput Throughput) error {
+	content, err := json.MarshalIndent(throughput, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// LoadThroughput reads the throughput SaveThroughput wrote. A missing file is reported
+// as an error satisfying errors.Is(err, fs.ErrNotExist).
+func LoadThroughput(path string) (Throughput, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Throughput{}, err
+	}
+
+	var throughput Throughput
+	if err := json.Unmarshal(content, &throughput); err != nil {
+		return Throughput{}, fmt.Errorf("failed to decode throughput %s: %w", path, err)
+	}
+	if throughput.Copy <= 0 || throughput.IndexBuild <= 0 {
+		return Throughput{}, fmt.Errorf("throughput %s must be positive", path)
+	}
+	return throughput, nil
+}
+
+// Rebuild estimates what rebuilding a table in a new order costs.
+//
+// RewriteBytes is what the rebuild writes: the heap in the new order, its TOAST data and
+// its indexes. TemporaryBytes is the disk needed on top of the current table while both
+// exist: the rewritten relations plus as much WAL again, which a logged table writes for
+// them before the next checkpoint can recycle it.
+type Rebuild struct {
+	NewHeapSize       int64
+	RewriteBytes      int64
+	TemporaryBytes    int64
+	CopySeconds       float64
+	IndexBuildSeconds float64
+}
+
+func (r Rebuild) Hours() float64 {
+	return (r.CopySeconds + r.IndexBuildSeconds) / 3600
+}
+
+// ForRebuild estimates a rebuild of table with the given expected tuple size in its new
+// order. Indexes are assumed to come out as large as they are now, which overestimates
+// bloated ones.
+func ForRebuild(table common.TableInfo, tupleSize float64, throughput Throughput) Rebuild {
+	if throughput.Copy <= 0 {
+		throughput.Copy = DefaultThroughput.Copy
+	}
+	if throughput.IndexBuild <= 0 {
+		throughput.IndexBuild = DefaultThroughput.IndexBuild
+	}
+
+	rebuild := Rebuild{NewHeapSize: layout.HeapSize(int64(table.RowCount), tupleSize, layout.FillFactor(table.Options))}
+	copied := rebuild.NewHeapSize + table.ToastSize
+
+	rebuild.RewriteBytes = copied + table.IndexesSize
+	rebuild.TemporaryBytes = rebuild.RewriteBytes
+	if !table.Unlogged {
+		rebuild.TemporaryBytes += rebuild.RewriteBytes
+	}
+	rebuild.CopySeconds = float64(copied) / throughput.Copy
+	rebuild.IndexBuildSeconds = float64(table.IndexesSize) / throughput.IndexBuild
+
+	return rebuild
+}
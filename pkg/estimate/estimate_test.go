@@ -0,0 +1,56 @@
+package estimate
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/layout"
+)
+
+func TestForRebuild(t *testing.T) {
+	table := common.TableInfo{RowCount: 204000, HeapSize: 1200 * layout.BlockSize, ToastSize: 10 * MiB, IndexesSize: 40 * MiB}
+
+	rebuild := ForRebuild(table, 36, Throughput{Copy: 10 * MiB, IndexBuild: 4 * MiB})
+
+	// 204 tuples of 36 bytes fit on a page.
+	assert.Equal(t, int64(1000*layout.BlockSize), rebuild.NewHeapSize)
+	assert.Equal(t, int64(1000*layout.BlockSize+50*MiB), rebuild.RewriteBytes)
+	assert.Equal(t, 2*rebuild.RewriteBytes, rebuild.TemporaryBytes)
+	assert.InDelta(t, float64(1000*layout.BlockSize+10*MiB)/(10*MiB), rebuild.CopySeconds, 1e-9)
+	assert.InDelta(t, 10, rebuild.IndexBuildSeconds, 1e-9)
+	assert.InDelta(t, (rebuild.CopySeconds+10)/3600, rebuild.Hours(), 1e-9)
+}
+
+func TestForRebuild_Unlogged(t *testing.T) {
+	table := common.TableInfo{RowCount: 204, Unlogged: true, Options: "fillfactor=50"}
+
+	rebuild := ForRebuild(table, 36, Throughput{})
+
+	// At fillfactor 50 a page holds 101 tuples of 36 bytes, and no WAL is written.
+	assert.Equal(t, int64(3*layout.BlockSize), rebuild.NewHeapSize)
+	assert.Equal(t, rebuild.RewriteBytes, rebuild.TemporaryBytes)
+	assert.InDelta(t, float64(3*layout.BlockSize)/DefaultThroughput.Copy, rebuild.CopySeconds, 1e-9)
+}
+
+func TestSaveThroughput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "throughput.json")
+	measured := Throughput{Copy: 12.5 * MiB, IndexBuild: 3 * MiB}
+
+	assert.NoError(t, SaveThroughput(path, measured))
+	loaded, err := LoadThroughput(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, measured, loaded)
+
+	_, err = LoadThroughput(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"copy": 0, "indexBuild": 1}`), 0o644))
+	_, err = LoadThroughput(path)
+	assert.EqualError(t, err, "throughput "+path+" must be positive")
+}
@@ -0,0 +1,208 @@
+package layout
+
+import (
+	"fmt"
+
+	"main/pkg/common"
+)
+
+// Pin fixes a column to a position. Positive positions count from the start, 1 being
+// first; negative positions count back from the end, -1 being last.
+type Pin struct {
+	Column   string
+	Position int
+}
+
+// Group keeps its columns adjacent. When Ordered is set they also keep the order they
+// are listed in.
+type Group struct {
+	Columns []string
+	Ordered bool
+}
+
+type Constraints struct {
+	Pins   []Pin
+	Groups []Group
+}
+
+func (c Constraints) Empty() bool {
+	return len(c.Pins) == 0 && len(c.Groups) == 0
+}
+
+// constraintState tracks which columns the next position may take while an order is
+// built up one column at a time.
+type constraintState struct {
+	pinAt   []int
+	pinOf   []int
+	groupOf []int
+	groups  [][]int
+	ordered []bool
+
+	placed []int
+	open   int
+}
+
+func resolveConstraints(columnList []common.ColumnInfo, constraints Constraints) (*constraintState, error) {
+	n := len(columnList)
+	state := &constraintState{
+		pinAt:   make([]int, n),
+		pinOf:   make([]int, n),
+		groupOf: make([]int, n),
+		open:    -1,
+	}
+	for i := range columnList {
+		state.pinAt[i], state.pinOf[i], state.groupOf[i] = -1, -1, -1
+	}
+
+	indexOf := make(map[string]int, n)
+	for i, col := range columnList {
+		indexOf[col.ColumnName] = i
+	}
+
+	for _, pin := range constraints.Pins {
+		index, exists := indexOf[pin.Column]
+		if !exists {
+			return nil, fmt.Errorf("pinned column %s does not exist", pin.Column)
+		}
+
+		position := pin.Position - 1
+		if pin.Position < 0 {
+			position = n + pin.Position
+		}
+		if pin.Position == 0 || position < 0 || position >= n {
+			return nil, fmt.Errorf("column %s is pinned to position %d, which is outside 1..%d", pin.Column, pin.Position, n)
+		}
+
+		if state.pinOf[index] != -1 && state.pinOf[index] != position {
+			return nil, fmt.Errorf("column %s is pinned to more than one position", pin.Column)
+		}
+		if state.pinAt[position] != -1 && state.pinAt[position] != index {
+			return nil, fmt.Errorf("columns %s and %s are pinned to the same position", columnList[state.pinAt[position]].ColumnName, pin.Column)
+		}
+		state.pinOf[index] = position
+		state.pinAt[position] = index
+	}
+
+	for _, group := range constraints.Groups {
+		members := make([]int, 0, len(group.Columns))
+		for _, column := range group.Columns {
+			index, exists := indexOf[column]
+			if !exists {
+				return nil, fmt.Errorf("grouped column %s does not exist", column)
+			}
+			if state.groupOf[index] != -1 {
+				return nil, fmt.Errorf("column %s belongs to more than one group", column)
+			}
+			state.groupOf[index] = len(state.groups)
+			members = append(members, index)
+		}
+
+		state.groups = append(state.groups, members)
+		state.ordered = append(state.ordered, group.Ordered)
+	}
+	state.placed = make([]int, len(state.groups))
+
+	return state, nil
+}
+
+// constrained reports whether a column is pinned or grouped, in which case it cannot be
+// swapped with an otherwise identical column.
+func (state *constraintState) constrained(index int) bool {
+	return state.pinOf[index] != -1 || state.groupOf[index] != -1
+}
+
+// allows reports whether the column may be placed at the 0-based position, given the
+// columns placed so far.
+func (state *constraintState) allows(index, position int) bool {
+	if state.pinAt[position] != -1 && state.pinAt[position] != index {
+		return false
+	}
+	if state.pinOf[index] != -1 && state.pinOf[index] != position {
+		return false
+	}
+
+	group := state.groupOf[index]
+	if state.open != -1 {
+		return group == state.open && (!state.ordered[group] || state.groups[group][state.placed[group]] == index)
+	}
+	if group == -1 {
+		return true
+	}
+
+	if state.ordered[group] && state.groups[group][0] != index {
+		return false
+	}
+	return state.fits(group, position)
+}
+
+// fits reports whether a group starting at the 0-based position can be laid out without
+// clashing with the pins of its own columns or of any other column.
+func (state *constraintState) fits(group, start int) bool {
+	members := state.groups[group]
+	end := start + len(members)
+	if end > len(state.pinAt) {
+		return false
+	}
+
+	for position := start; position < end; position++ {
+		if pinned := state.pinAt[position]; pinned != -1 && state.groupOf[pinned] != group {
+			return false
+		}
+	}
+
+	for offset, index := range members {
+		pin := state.pinOf[index]
+		if pin == -1 {
+			continue
+		}
+		if pin < start || pin >= end || state.ordered[group] && pin != start+offset {
+			return false
+		}
+	}
+	return true
+}
+
+func (state *constraintState) place(index int) {
+	group := state.groupOf[index]
+	if group == -1 {
+		return
+	}
+
+	state.placed[group]++
+	state.open = group
+	if state.placed[group] == len(state.groups[group]) {
+		state.open = -1
+	}
+}
+
+func (state *constraintState) unplace(index int) {
+	group := state.groupOf[index]
+	if group == -1 {
+		return
+	}
+
+	state.placed[group]--
+	state.open = group
+	if state.placed[group] == 0 {
+		state.open = -1
+	}
+}
+
+// satisfies reports whether a complete order meets every constraint.
+func (state *constraintState) satisfies(order []int) bool {
+	valid := true
+	placed := 0
+	for position, index := range order {
+		if !state.allows(index, position) {
+			valid = false
+			break
+		}
+		state.place(index)
+		placed++
+	}
+
+	for i := placed - 1; i >= 0; i-- {
+		state.unplace(order[i])
+	}
+	return valid
+}
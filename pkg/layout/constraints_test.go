@@ -0,0 +1,129 @@
+package layout
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+var auditTable = []common.ColumnInfo{
+	{ColumnName: "created_at", TypLen: 8, TypAlign: 8},
+	{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+	{ColumnName: "id", TypLen: 8, TypAlign: 8},
+	{ColumnName: "count", TypLen: 4, TypAlign: 4},
+	{ColumnName: "updated_at", TypLen: 8, TypAlign: 8},
+	{ColumnName: "small", TypLen: 2, TypAlign: 2},
+}
+
+func TestOptimizeWithConstraints_Conventions(t *testing.T) {
+	constraints := Constraints{
+		Pins:   []Pin{{Column: "id", Position: 1}, {Column: "updated_at", Position: -1}},
+		Groups: []Group{{Columns: []string{"created_at", "updated_at"}, Ordered: true}},
+	}
+
+	ordering, err := OptimizeWithOptions(auditTable, Options{Constraints: constraints})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1, 5, 3, 0, 4}, ordering.Order)
+	assert.Equal(t, 24.0+32.0, ordering.TupleSize)
+	assert.True(t, ordering.Optimal())
+}
+
+func TestOptimizeWithConstraints_CostOfConventions(t *testing.T) {
+	constraints := Constraints{
+		Pins: []Pin{{Column: "flag", Position: 1}, {Column: "created_at", Position: 2}},
+	}
+
+	unconstrained := Optimize(auditTable)
+	constrained, err := OptimizeWithOptions(auditTable, Options{Constraints: constraints})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 0}, constrained.Order[:2])
+	assert.Greater(t, constrained.TupleSize, unconstrained.TupleSize)
+}
+
+func TestOptimizeWithConstraints_UnorderedGroup(t *testing.T) {
+	constraints := Constraints{
+		Groups: []Group{{Columns: []string{"updated_at", "flag"}}},
+	}
+
+	ordering, err := OptimizeWithOptions(auditTable, Options{Constraints: constraints})
+
+	assert.NoError(t, err)
+	assert.True(t, adjacent(ordering.Order, 1, 4))
+}
+
+func TestOptimizeWithConstraints_Invalid(t *testing.T) {
+	tests := map[string]Constraints{
+		"pinned column does not exist":       {Pins: []Pin{{Column: "missing", Position: 1}}},
+		"pinned outside the table":           {Pins: []Pin{{Column: "id", Position: 7}}},
+		"pinned to position zero":            {Pins: []Pin{{Column: "id", Position: 0}}},
+		"two columns pinned to one position": {Pins: []Pin{{Column: "id", Position: 1}, {Column: "flag", Position: -6}}},
+		"column pinned twice":                {Pins: []Pin{{Column: "id", Position: 1}, {Column: "id", Position: 2}}},
+		"grouped column does not exist":      {Groups: []Group{{Columns: []string{"id", "missing"}}}},
+		"column in two groups":               {Groups: []Group{{Columns: []string{"id", "flag"}}, {Columns: []string{"id", "count"}}}},
+	}
+
+	for name, constraints := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := OptimizeWithOptions(auditTable, Options{Constraints: constraints})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOptimizeWithConstraints_Unsatisfiable(t *testing.T) {
+	constraints := Constraints{
+		Pins:   []Pin{{Column: "id", Position: 1}, {Column: "flag", Position: 2}},
+		Groups: []Group{{Columns: []string{"id", "count"}}},
+	}
+
+	_, err := OptimizeWithOptions(auditTable, Options{Constraints: constraints})
+
+	assert.EqualError(t, err, "no column order satisfies the constraints")
+}
+
+func TestOptimizeWithConstraints_MatchesExhaustiveSearch(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+
+	for trial := 0; trial < 50; trial++ {
+		constraints := Constraints{}
+		if random.Intn(2) == 0 {
+			constraints.Pins = append(constraints.Pins, Pin{Column: auditTable[random.Intn(6)].ColumnName, Position: random.Intn(6) + 1})
+		}
+		first, second := random.Intn(6), random.Intn(6)
+		if first != second {
+			constraints.Groups = append(constraints.Groups, Group{
+				Columns: []string{auditTable[first].ColumnName, auditTable[second].ColumnName},
+				Ordered: random.Intn(2) == 0,
+			})
+		}
+
+		state, err := resolveConstraints(auditTable, constraints)
+		assert.NoError(t, err)
+
+		bestOrder, bestSize := exhaustiveSearchWith(auditTable, state.satisfies, 0)
+		ordering, err := OptimizeWithOptions(auditTable, Options{Constraints: constraints})
+
+		if bestOrder == nil {
+			assert.Error(t, err, "trial %d", trial)
+			continue
+		}
+		assert.NoError(t, err, "trial %d", trial)
+		assert.InDelta(t, bestSize, ordering.TupleSize, 1e-6, "trial %d: %v", trial, constraints)
+		assert.Equal(t, bestOrder, ordering.Order, fmt.Sprintf("trial %d: %v", trial, constraints))
+	}
+}
+
+func adjacent(order []int, a, b int) bool {
+	for i := 1; i < len(order); i++ {
+		if order[i-1] == a && order[i] == b || order[i-1] == b && order[i] == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package layout
+
+import "main/pkg/common"
+
+// CacheableOffsets reports, for each column, whether slot_deform_heap_tuple can take its
+// offset from attcacheoff instead of walking the columns before it. That holds for every
+// column up to and including the first one that is variable-length or nullable, since
+// the offsets of the columns after it depend on the contents of the row.
+func CacheableOffsets(columnList []common.ColumnInfo) []bool {
+	cacheable := make([]bool, len(columnList))
+	for i, col := range columnList {
+		cacheable[i] = true
+		if breaksCacheableRun(col) {
+			break
+		}
+	}
+	return cacheable
+}
+
+// DeformScore counts the columns with cacheable offsets.
+func DeformScore(columnList []common.ColumnInfo) int {
+	score := 0
+	for _, cacheable := range CacheableOffsets(columnList) {
+		if cacheable {
+			score++
+		}
+	}
+	return score
+}
+
+func breaksCacheableRun(col common.ColumnInfo) bool {
+	return col.TypLen <= 0 || col.IsNullable == "YES"
+}
@@ -0,0 +1,73 @@
+package layout
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+var deformTable = []common.ColumnInfo{
+	{ColumnName: "body", IsNullable: "NO", TypLen: -1, TypAlign: 4, AvgWidth: 12, Storage: "p"},
+	{ColumnName: "id", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+	{ColumnName: "count", IsNullable: "NO", TypLen: 4, TypAlign: 4},
+}
+
+func TestCacheableOffsets(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+		{ColumnName: "note", IsNullable: "YES", TypLen: 4, TypAlign: 4},
+		{ColumnName: "count", IsNullable: "NO", TypLen: 4, TypAlign: 4},
+	}
+
+	assert.Equal(t, []bool{true, true, false}, CacheableOffsets(columnList))
+	assert.Equal(t, 2, DeformScore(columnList))
+	assert.Equal(t, 1, DeformScore(deformTable))
+	assert.Equal(t, 0, DeformScore(nil))
+}
+
+func TestOptimizeWithOptions_DeformWeight(t *testing.T) {
+	bySize, err := OptimizeWithOptions(deformTable, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 2, 1}, bySize.Order)
+	assert.Equal(t, 1, bySize.CacheableOffsets)
+
+	byDeform, err := OptimizeWithOptions(deformTable, Options{DeformWeight: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 0}, byDeform.Order)
+	assert.Equal(t, 3, byDeform.CacheableOffsets)
+	assert.Equal(t, bySize.TupleSize, byDeform.TupleSize)
+	assert.Equal(t, byDeform.TupleSize-3, byDeform.Objective)
+	assert.Equal(t, []bool{true, true, true}, byDeform.Cacheable(deformTable))
+}
+
+func TestOptimizeWithOptions_DeformMatchesExhaustiveSearch(t *testing.T) {
+	types := []common.ColumnInfo{
+		{TypLen: 1, TypAlign: 1},
+		{TypLen: 4, TypAlign: 4},
+		{TypLen: 8, TypAlign: 8},
+		{TypLen: -1, TypAlign: 4, AvgWidth: 20, Storage: "x"},
+		{TypLen: 2, TypAlign: 2, IsNullable: "YES", NullFrac: 0.3},
+	}
+	random := rand.New(rand.NewSource(4))
+
+	for trial := 0; trial < 40; trial++ {
+		columnList := make([]common.ColumnInfo, 2+random.Intn(5))
+		for i := range columnList {
+			columnList[i] = types[random.Intn(len(types))]
+			columnList[i].ColumnName = fmt.Sprintf("c%d", i)
+		}
+		weight := float64(random.Intn(8))
+
+		bestOrder, bestObjective := exhaustiveSearchWith(columnList, func([]int) bool { return true }, weight)
+		ordering, err := OptimizeWithOptions(columnList, Options{DeformWeight: weight})
+
+		assert.NoError(t, err)
+		assert.InDelta(t, bestObjective, ordering.Objective, 1e-6, "trial %d", trial)
+		assert.Equal(t, bestOrder, ordering.Order, "trial %d", trial)
+		assert.True(t, ordering.Optimal(), "trial %d", trial)
+	}
+}
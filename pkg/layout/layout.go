@@ -0,0 +1,223 @@
+package layout
+
+import "main/pkg/common"
+
+const (
+	// MaxAlign is MAXIMUM_ALIGNOF on the 64-bit platforms PostgreSQL is normally built for.
+	MaxAlign = 8
+
+	// VarHdrSz is the size of the 4-byte header carried by a varlena in its long format.
+	VarHdrSz = 4
+
+	// HeapTupleHeaderSize is SizeofHeapTupleHeader, the fixed part of every heap tuple
+	// header before the null bitmap.
+	HeapTupleHeaderSize = 23
+)
+
+type ColumnLayout struct {
+	Offset  int
+	Padding int
+	Size    int
+}
+
+type TupleLayout struct {
+	Columns     []ColumnLayout
+	Padding     int
+	DataSize    int
+	AlignedSize int
+}
+
+type RowEstimate struct {
+	HeaderSize int
+	DataSize   int
+	TupleSize  int
+}
+
+type TableEstimate struct {
+	NoNulls   RowEstimate
+	WithNulls RowEstimate
+}
+
+type ExpectedLayout struct {
+	Padding      []float64
+	TotalPadding float64
+	TailPadding  float64
+	DataSize     float64
+	TupleSize    float64
+}
+
+// Compute walks the columns in order the same way heap_fill_tuple does: each attribute
+// is aligned to its typalign from the running offset, after which its length is added.
+// The padding reported for a column is the gap inserted before it.
+func Compute(columnList []common.ColumnInfo) TupleLayout {
+	return computeWithNulls(columnList, make([]bool, len(columnList)))
+}
+
+// computeWithNulls is Compute for a row in which the columns flagged in isNull are NULL.
+// Those columns are skipped entirely, as they only occupy a bit in the null bitmap.
+func computeWithNulls(columnList []common.ColumnInfo, isNull []bool) TupleLayout {
+	layout := TupleLayout{Columns: make([]ColumnLayout, len(columnList))}
+
+	offset := 0
+	for i, col := range columnList {
+		if isNull[i] {
+			layout.Columns[i] = ColumnLayout{Offset: offset}
+			continue
+		}
+
+		form := likelyForm(col)
+		aligned := AlignOffset(offset, form.align)
+		size := form.size
+
+		layout.Columns[i] = ColumnLayout{
+			Offset:  aligned,
+			Padding: aligned - offset,
+			Size:    size,
+		}
+		layout.Padding += aligned - offset
+		offset = aligned + size
+	}
+
+	layout.DataSize = offset
+	layout.AlignedSize = AlignOffset(offset, MaxAlign)
+
+	return layout
+}
+
+// Estimate sizes a row both without NULLs and with every nullable column NULL. The
+// latter is the smallest data area a row can have, but it carries the null bitmap. When
+// no column is nullable, the null bitmap can never appear and both estimates are equal.
+func Estimate(columnList []common.ColumnInfo) TableEstimate {
+	isNull := make([]bool, len(columnList))
+	hasNullable := false
+	for i, col := range columnList {
+		if col.IsNullable == "YES" {
+			isNull[i] = true
+			hasNullable = true
+		}
+	}
+
+	noNulls := rowEstimate(HeaderSize(len(columnList), false), Compute(columnList))
+	if !hasNullable {
+		return TableEstimate{NoNulls: noNulls, WithNulls: noNulls}
+	}
+
+	return TableEstimate{
+		NoNulls:   noNulls,
+		WithNulls: rowEstimate(HeaderSize(len(columnList), true), computeWithNulls(columnList, isNull)),
+	}
+}
+
+// HeaderSize returns t_hoff: the fixed header plus the null bitmap, if present, rounded
+// up to MAXALIGN so that the data area starts aligned.
+func HeaderSize(columnCount int, hasNulls bool) int {
+	size := HeapTupleHeaderSize
+	if hasNulls {
+		size += (columnCount + 7) / 8
+	}
+	return AlignOffset(size, MaxAlign)
+}
+
+func rowEstimate(headerSize int, tupleLayout TupleLayout) RowEstimate {
+	return RowEstimate{
+		HeaderSize: headerSize,
+		DataSize:   tupleLayout.DataSize,
+		TupleSize:  AlignOffset(headerSize+tupleLayout.DataSize, MaxAlign),
+	}
+}
+
+// Expected computes the mean padding and row size over the NULL distribution described
+// by each column's NullFrac, and over the header forms a varlena may take, treating
+// columns as independent. Every typalign divides MaxAlign, so the offset modulo MaxAlign
+// is all that decides the padding of the columns after it; tracking the probability of
+// each residue keeps this exact without enumerating every combination of NULLs.
+func Expected(columnList []common.ColumnInfo) ExpectedLayout {
+	expected := ExpectedLayout{Padding: make([]float64, len(columnList))}
+
+	residues := residueDistribution{1}
+	for i, col := range columnList {
+		var data float64
+		residues, expected.Padding[i], data = placeColumn(residues, presence(col), storageForms(col))
+
+		expected.TotalPadding += expected.Padding[i]
+		expected.DataSize += data
+	}
+
+	expected.TailPadding = residues.tailPadding()
+	expected.TupleSize = expectedHeaderSize(columnList) + expected.DataSize + expected.TailPadding
+
+	return expected
+}
+
+// residueDistribution holds the probability of the running offset being at each residue
+// modulo MaxAlign.
+type residueDistribution [MaxAlign]float64
+
+// placeColumn appends a column to a row whose offset is distributed as residues. It
+// returns the new distribution along with the expected padding before the column and the
+// expected bytes it adds to the data area, padding included.
+func placeColumn(residues residueDistribution, present float64, forms []storageForm) (residueDistribution, float64, float64) {
+	var next residueDistribution
+	var padding, data float64
+
+	for offset, probability := range residues {
+		if probability == 0 {
+			continue
+		}
+		next[offset] += probability * (1 - present)
+
+		for _, form := range forms {
+			weight := probability * present * form.probability
+			aligned := AlignOffset(offset, form.align)
+			padding += weight * float64(aligned-offset)
+			data += weight * float64(aligned-offset+form.size)
+			next[(aligned+form.size)%MaxAlign] += weight
+		}
+	}
+
+	return next, padding, data
+}
+
+// tailPadding is the expected padding needed to round the data area up to MaxAlign.
+func (residues residueDistribution) tailPadding() float64 {
+	padding := 0.0
+	for offset, probability := range residues {
+		padding += probability * float64(AlignOffset(offset, MaxAlign)-offset)
+	}
+	return padding
+}
+
+// expectedHeaderSize weighs the header with and without a null bitmap by how likely a row
+// is to contain a NULL. It does not depend on the column order.
+func expectedHeaderSize(columnList []common.ColumnInfo) float64 {
+	noNulls := 1.0
+	for _, col := range columnList {
+		noNulls *= presence(col)
+	}
+
+	return noNulls*float64(HeaderSize(len(columnList), false)) +
+		(1-noNulls)*float64(HeaderSize(len(columnList), true))
+}
+
+func presence(col common.ColumnInfo) float64 {
+	return 1 - clampFraction(col.NullFrac)
+}
+
+func clampFraction(fraction float64) float64 {
+	switch {
+	case fraction < 0:
+		return 0
+	case fraction > 1:
+		return 1
+	default:
+		return fraction
+	}
+}
+
+// AlignOffset rounds offset up to the next multiple of alignment, mirroring TYPEALIGN.
+func AlignOffset(offset, alignment int) int {
+	if alignment <= 1 {
+		return offset
+	}
+	return (offset + alignment - 1) / alignment * alignment
+}
@@ -0,0 +1,143 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func TestCompute(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+		{ColumnName: "count", TypLen: 4, TypAlign: 4},
+		{ColumnName: "tag", TypLen: 1, TypAlign: 1},
+		{ColumnName: "id", TypLen: 8, TypAlign: 8},
+	}
+
+	result := Compute(columnList)
+
+	assert.Equal(t, []ColumnLayout{
+		{Offset: 0, Padding: 0, Size: 1},
+		{Offset: 4, Padding: 3, Size: 4},
+		{Offset: 8, Padding: 0, Size: 1},
+		{Offset: 16, Padding: 7, Size: 8},
+	}, result.Columns)
+	assert.Equal(t, 10, result.Padding)
+	assert.Equal(t, 24, result.DataSize)
+	assert.Equal(t, 24, result.AlignedSize)
+}
+
+func TestCompute_RunningOffset(t *testing.T) {
+	// macaddr is 6 bytes wide but int-aligned, so it leaves the offset at 6 and the
+	// following integer needs 2 bytes of padding.
+	columnList := []common.ColumnInfo{
+		{ColumnName: "mac", TypLen: 6, TypAlign: 4},
+		{ColumnName: "count", TypLen: 4, TypAlign: 4},
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+	}
+
+	result := Compute(columnList)
+
+	assert.Equal(t, 2, result.Columns[1].Padding)
+	assert.Equal(t, 13, result.DataSize)
+	assert.Equal(t, 16, result.AlignedSize)
+}
+
+func TestCompute_Varlena(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+		{ColumnName: "body", TypLen: -1, TypAlign: 4},
+	}
+
+	result := Compute(columnList)
+
+	// Without statistics the value most likely has a 1-byte header, which is not aligned.
+	assert.Equal(t, ColumnLayout{Offset: 1, Padding: 0, Size: 1}, result.Columns[1])
+	assert.Equal(t, 2, result.DataSize)
+}
+
+func TestAlignOffset(t *testing.T) {
+	assert.Equal(t, 0, AlignOffset(0, 8))
+	assert.Equal(t, 8, AlignOffset(1, 8))
+	assert.Equal(t, 6, AlignOffset(5, 2))
+	assert.Equal(t, 5, AlignOffset(5, 1))
+	assert.Equal(t, 5, AlignOffset(5, -1))
+}
+
+func TestHeaderSize(t *testing.T) {
+	assert.Equal(t, 24, HeaderSize(3, false))
+	assert.Equal(t, 24, HeaderSize(8, true))
+	assert.Equal(t, 32, HeaderSize(9, true))
+	assert.Equal(t, 32, HeaderSize(72, true))
+	assert.Equal(t, 40, HeaderSize(73, true))
+}
+
+func TestEstimate(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+		{ColumnName: "flag", IsNullable: "YES", TypLen: 1, TypAlign: 1},
+		{ColumnName: "count", IsNullable: "NO", TypLen: 4, TypAlign: 4},
+	}
+
+	estimate := Estimate(columnList)
+
+	assert.Equal(t, RowEstimate{HeaderSize: 24, DataSize: 16, TupleSize: 40}, estimate.NoNulls)
+	assert.Equal(t, RowEstimate{HeaderSize: 24, DataSize: 12, TupleSize: 40}, estimate.WithNulls)
+}
+
+func TestEstimate_NoNullableColumns(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+		{ColumnName: "flag", IsNullable: "NO", TypLen: 1, TypAlign: 1},
+	}
+
+	estimate := Estimate(columnList)
+
+	assert.Equal(t, RowEstimate{HeaderSize: 24, DataSize: 9, TupleSize: 40}, estimate.NoNulls)
+	assert.Equal(t, estimate.NoNulls, estimate.WithNulls)
+}
+
+func TestExpected_NoNulls(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "flag", IsNullable: "NO", TypLen: 1, TypAlign: 1},
+		{ColumnName: "count", IsNullable: "NO", TypLen: 4, TypAlign: 4},
+		{ColumnName: "id", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+	}
+
+	expected := Expected(columnList)
+
+	assert.Equal(t, []float64{0, 3, 0}, expected.Padding)
+	assert.Equal(t, 3.0, expected.TotalPadding)
+	assert.Equal(t, 16.0, expected.DataSize)
+	assert.Equal(t, float64(Estimate(columnList).NoNulls.TupleSize), expected.TupleSize)
+}
+
+func TestExpected_NullFraction(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "count", IsNullable: "YES", TypLen: 4, TypAlign: 4, NullFrac: 0.5},
+		{ColumnName: "id", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+	}
+
+	expected := Expected(columnList)
+
+	// The bigint only needs padding when the integer before it is present.
+	assert.Equal(t, []float64{0, 2}, expected.Padding)
+	assert.Equal(t, 12.0, expected.DataSize)
+	assert.Equal(t, 36.0, expected.TupleSize)
+}
+
+func TestExpected_AlwaysNull(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+		{ColumnName: "flag", IsNullable: "YES", TypLen: 1, TypAlign: 1, NullFrac: 1},
+		{ColumnName: "count", IsNullable: "NO", TypLen: 4, TypAlign: 4},
+	}
+
+	expected := Expected(columnList)
+	estimate := Estimate(columnList)
+
+	assert.Equal(t, float64(estimate.WithNulls.DataSize), expected.DataSize)
+	assert.Equal(t, float64(estimate.WithNulls.TupleSize), expected.TupleSize)
+}
@@ -0,0 +1,480 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"main/pkg/common"
+)
+
+const (
+	// searchBudget caps the number of nodes the branch-and-bound search expands. When it
+	// runs out, the best order found so far is returned along with a lower bound that
+	// still holds for every order.
+	searchBudget = 250_000
+
+	epsilon = 1e-9
+)
+
+type Ordering struct {
+	// Order lists indices into the column list in the recommended order.
+	Order            []int
+	TupleSize        float64
+	CacheableOffsets int
+	// Objective is the value the search minimised: the expected tuple size less the
+	// deform weight for every cacheable offset. LowerBound is a bound on it.
+	Objective  float64
+	LowerBound float64
+}
+
+// Options tunes what Optimize searches for.
+type Options struct {
+	Constraints Constraints
+	// DeformWeight is how many bytes of expected tuple size one more cacheable offset is
+	// worth. Zero optimises for size alone.
+	DeformWeight float64
+}
+
+// Optimal reports whether the search proved that no order has a smaller objective.
+func (o Ordering) Optimal() bool {
+	return o.Objective-o.LowerBound < epsilon
+}
+
+// Positions returns the recommended 1-based position of each column, indexed by its
+// position in the original column list.
+func (o Ordering) Positions() []int {
+	positions := make([]int, len(o.Order))
+	for position, index := range o.Order {
+		positions[index] = position + 1
+	}
+	return positions
+}
+
+// Cacheable reports whether each column, indexed by its position in the original column
+// list, has a cacheable offset in the recommended order.
+func (o Ordering) Cacheable(columnList []common.ColumnInfo) []bool {
+	cacheable := make([]bool, len(o.Order))
+	for position, value := range CacheableOffsets(Reorder(columnList, o.Order)) {
+		cacheable[o.Order[position]] = value
+	}
+	return cacheable
+}
+
+// Optimize searches for the column order with the smallest expected tuple size, as
+// computed by Expected. Among orders of equal size it returns the one that is
+// lexicographically smallest in terms of original positions, so columns only move when
+// doing so saves space and the current order is kept when it is already optimal. The one
+// exception is varlenas without statistics, which are ranked after every other column:
+// their length is unknown, so they are kept after the columns whose offsets they would
+// otherwise leave to chance.
+//
+// The search is a depth-first branch and bound over column classes: columns that are
+// laid out identically are interchangeable, so only the order of the classes is
+// searched and columns within a class keep their original relative order.
+func Optimize(columnList []common.ColumnInfo) Ordering {
+	// Without constraints every order is valid, so this cannot fail.
+	ordering, _ := OptimizeWithOptions(columnList, Options{})
+	return ordering
+}
+
+// OptimizeWithOptions is Optimize restricted to the orders that satisfy the constraints,
+// optionally trading tuple size for cacheable offsets. It fails if the constraints are
+// invalid for the column list or cannot all be met.
+func OptimizeWithOptions(columnList []common.ColumnInfo, options Options) (Ordering, error) {
+	state, err := resolveConstraints(columnList, options.Constraints)
+	if err != nil {
+		return Ordering{}, err
+	}
+
+	s := newSolver(columnList, state, options.DeformWeight)
+
+	seed, seedCost := s.seed()
+	if seed == nil {
+		// Neither the current nor the sorted order is valid, so take the first valid
+		// order the search comes across as the seed.
+		s.bestCost, s.firstOnly = math.Inf(1), true
+		s.search(residueDistribution{1}, 0)
+		if s.best == nil {
+			return Ordering{}, s.infeasible()
+		}
+		seed, seedCost = s.best, s.bestCost
+		s.nodes, s.firstOnly = 0, false
+	}
+	seed, seedCost = s.improve(seed, seedCost)
+
+	s.best, s.bestCost, s.fromSeed = seed, seedCost, true
+	s.frontier = math.Inf(1)
+	s.search(residueDistribution{1}, 0)
+
+	header := expectedHeaderSize(columnList)
+	return Ordering{
+		Order:            s.best,
+		TupleSize:        header + s.size(s.best),
+		CacheableOffsets: DeformScore(Reorder(columnList, s.best)),
+		Objective:        header + s.bestCost,
+		LowerBound:       header + math.Min(s.bestCost, s.frontier),
+	}, nil
+}
+
+type solver struct {
+	columns     []common.ColumnInfo
+	present     []float64
+	forms       [][]storageForm
+	breaks      []bool
+	deferred    []bool
+	constraints *constraintState
+
+	deformWeight float64
+
+	// classes groups column indices that are laid out identically, in ascending order,
+	// and used counts how many columns of each class have been placed.
+	classes [][]int
+	used    []int
+
+	minRemaining  int
+	meanRemaining float64
+
+	// cacheable counts the placed columns with cacheable offsets, which stops growing
+	// once broken is set. steadyRemaining and breakingRemaining count the unplaced
+	// columns that do not and do end the cacheable run.
+	cacheable         int
+	broken            bool
+	steadyRemaining   int
+	breakingRemaining int
+
+	prefix   []int
+	best     []int
+	bestCost float64
+	// fromSeed is set while best is still the seed order. Orders that merely tie with it
+	// are accepted until the search finds one of its own, since they come first.
+	fromSeed bool
+
+	// firstOnly stops the search at the first complete order.
+	firstOnly bool
+
+	nodes    int
+	frontier float64
+}
+
+func newSolver(columnList []common.ColumnInfo, constraints *constraintState, deformWeight float64) *solver {
+	s := &solver{
+		columns:      columnList,
+		present:      make([]float64, len(columnList)),
+		forms:        make([][]storageForm, len(columnList)),
+		breaks:       make([]bool, len(columnList)),
+		deferred:     make([]bool, len(columnList)),
+		constraints:  constraints,
+		deformWeight: deformWeight,
+		prefix:       make([]int, 0, len(columnList)),
+	}
+
+	for i, col := range columnList {
+		s.present[i] = presence(col)
+		s.forms[i] = storageForms(col)
+		s.breaks[i] = breaksCacheableRun(col)
+		s.deferred[i] = unknownLength(col)
+		s.minRemaining += minSize(s.present[i], s.forms[i])
+		s.meanRemaining += meanSize(s.present[i], s.forms[i])
+		if s.breaks[i] {
+			s.breakingRemaining++
+		} else {
+			s.steadyRemaining++
+		}
+
+		class := -1
+		for c, members := range s.classes {
+			first := members[0]
+			if constraints.constrained(i) || constraints.constrained(first) {
+				continue
+			}
+			if s.present[first] == s.present[i] && s.breaks[first] == s.breaks[i] && reflect.DeepEqual(s.forms[first], s.forms[i]) {
+				class = c
+				break
+			}
+		}
+		if class == -1 {
+			s.classes = append(s.classes, nil)
+			class = len(s.classes) - 1
+		}
+		s.classes[class] = append(s.classes[class], i)
+	}
+	s.used = make([]int, len(s.classes))
+
+	return s
+}
+
+// seed returns the cheaper of the current order and the order sorted by alignment,
+// skipping either if it breaks the constraints. It returns nil if both do.
+func (s *solver) seed() ([]int, float64) {
+	var seed []int
+	seedCost := math.Inf(1)
+
+	for _, order := range [][]int{identityOrder(len(s.columns)), alignmentOrder(s.columns)} {
+		if !s.constraints.satisfies(order) {
+			continue
+		}
+		if cost := s.cost(order); cost < seedCost-epsilon {
+			seed, seedCost = order, cost
+		}
+	}
+	return seed, seedCost
+}
+
+func (s *solver) infeasible() error {
+	if s.nodes >= searchBudget {
+		return fmt.Errorf("no column order satisfying the constraints was found within the search budget")
+	}
+	return fmt.Errorf("no column order satisfies the constraints")
+}
+
+// cost returns the objective of a complete order: the expected size of its data area,
+// MAXALIGN included, less the deform weight for each cacheable offset.
+func (s *solver) cost(order []int) float64 {
+	return s.size(order) - s.deformWeight*float64(DeformScore(Reorder(s.columns, order)))
+}
+
+// size returns the expected size of the data area of a complete order, MAXALIGN included.
+func (s *solver) size(order []int) float64 {
+	residues := residueDistribution{1}
+	total := 0.0
+	for _, index := range order {
+		var data float64
+		residues, _, data = placeColumn(residues, s.present[index], s.forms[index])
+		total += data
+	}
+	return total + residues.tailPadding()
+}
+
+func (s *solver) search(residues residueDistribution, data float64) {
+	bound := data + s.remainingBound(residues) - s.deformWeight*float64(s.cacheableBound())
+
+	if len(s.prefix) == len(s.columns) {
+		s.accept(bound)
+		return
+	}
+
+	if s.firstOnly && s.best != nil || s.fromSeed && bound > s.bestCost+epsilon || !s.fromSeed && bound >= s.bestCost-epsilon {
+		return
+	}
+
+	if s.nodes >= searchBudget {
+		s.frontier = math.Min(s.frontier, bound)
+		return
+	}
+	s.nodes++
+
+	for _, class := range s.candidateClasses() {
+		index := s.classes[class][s.used[class]]
+		if !s.constraints.allows(index, len(s.prefix)) {
+			continue
+		}
+		next, _, added := placeColumn(residues, s.present[index], s.forms[index])
+
+		cacheable, broken := s.cacheable, s.broken
+		s.constraints.place(index)
+		s.used[class]++
+		s.prefix = append(s.prefix, index)
+		s.minRemaining -= minSize(s.present[index], s.forms[index])
+		s.meanRemaining -= meanSize(s.present[index], s.forms[index])
+		s.placeDeform(index)
+
+		s.search(next, data+added)
+
+		s.unplaceDeform(index)
+		s.cacheable, s.broken = cacheable, broken
+		s.meanRemaining += meanSize(s.present[index], s.forms[index])
+		s.minRemaining += minSize(s.present[index], s.forms[index])
+		s.prefix = s.prefix[:len(s.prefix)-1]
+		s.used[class]--
+		s.constraints.unplace(index)
+	}
+}
+
+// improve runs a local search over single-column moves until no move makes the order
+// smaller. A tighter seed lets the search prune far more of the tree.
+func (s *solver) improve(order []int, cost float64) ([]int, float64) {
+	candidate := make([]int, len(order))
+
+	for improved := true; improved; {
+		improved = false
+		for from := range order {
+			for to := range order {
+				if from == to {
+					continue
+				}
+				moveColumn(candidate, order, from, to)
+				if !s.constraints.satisfies(candidate) {
+					continue
+				}
+				if candidateCost := s.cost(candidate); candidateCost < cost-epsilon {
+					order, candidate = candidate, order
+					cost = candidateCost
+					improved = true
+				}
+			}
+		}
+	}
+
+	return order, cost
+}
+
+// moveColumn writes order into dst with the element at position from moved to position to.
+func moveColumn(dst, order []int, from, to int) {
+	moved := order[from]
+	j := 0
+	for i, index := range order {
+		if i == from {
+			continue
+		}
+		if j == to {
+			dst[j] = moved
+			j++
+		}
+		dst[j] = index
+		j++
+	}
+	if j == to {
+		dst[j] = moved
+	}
+}
+
+// remainingBound is a lower bound on the expected bytes the unplaced columns add to the
+// data area, tail padding included. They add at least their mean size, and from any
+// residue the data area grows by at least their minimum size rounded up to MAXALIGN.
+func (s *solver) remainingBound(residues residueDistribution) float64 {
+	aligned := 0.0
+	for offset, probability := range residues {
+		aligned += probability * float64(AlignOffset(offset+s.minRemaining, MaxAlign)-offset)
+	}
+
+	if len(s.prefix) == len(s.columns) {
+		return aligned
+	}
+	return math.Max(s.meanRemaining, aligned)
+}
+
+// cacheableBound is the most cacheable offsets any completion of the current prefix
+// can have: every remaining column that keeps the run going, plus one that ends it.
+func (s *solver) cacheableBound() int {
+	if s.broken {
+		return s.cacheable
+	}
+
+	bound := s.cacheable + s.steadyRemaining
+	if s.breakingRemaining > 0 {
+		bound++
+	}
+	return bound
+}
+
+func (s *solver) placeDeform(index int) {
+	if s.breaks[index] {
+		s.breakingRemaining--
+	} else {
+		s.steadyRemaining--
+	}
+
+	if !s.broken {
+		s.cacheable++
+		s.broken = s.breaks[index]
+	}
+}
+
+// unplaceDeform restores the remaining counts; the caller restores cacheable and broken.
+func (s *solver) unplaceDeform(index int) {
+	if s.breaks[index] {
+		s.breakingRemaining++
+	} else {
+		s.steadyRemaining++
+	}
+}
+
+func (s *solver) accept(cost float64) {
+	if s.fromSeed && cost <= s.bestCost+epsilon || cost < s.bestCost-epsilon {
+		s.best = append([]int(nil), s.prefix...)
+		s.bestCost = cost
+		s.fromSeed = false
+	}
+}
+
+// candidateClasses returns the classes with columns left to place, ordered by the
+// original position of the column each would place next, so orders are visited
+// lexicographically, deferred columns last.
+func (s *solver) candidateClasses() []int {
+	candidates := make([]int, 0, len(s.classes))
+	for class, members := range s.classes {
+		if s.used[class] == len(members) {
+			continue
+		}
+
+		next := members[s.used[class]]
+		position := len(candidates)
+		candidates = append(candidates, class)
+		for position > 0 && s.ranksAfter(s.classes[candidates[position-1]][s.used[candidates[position-1]]], next) {
+			candidates[position] = candidates[position-1]
+			position--
+		}
+		candidates[position] = class
+	}
+	return candidates
+}
+
+// ranksAfter reports whether column a comes after column b in the order the search visits
+// columns in.
+func (s *solver) ranksAfter(a, b int) bool {
+	if s.deferred[a] != s.deferred[b] {
+		return s.deferred[a]
+	}
+	return a > b
+}
+
+func minSize(present float64, forms []storageForm) int {
+	if present < 1 {
+		return 0
+	}
+
+	size := forms[0].size
+	for _, form := range forms[1:] {
+		if form.size < size {
+			size = form.size
+		}
+	}
+	return size
+}
+
+func meanSize(present float64, forms []storageForm) float64 {
+	size := 0.0
+	for _, form := range forms {
+		size += form.probability * float64(form.size)
+	}
+	return present * size
+}
+
+func identityOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// alignmentOrder is the classic heuristic of sorting by descending alignment, used to
+// seed the search with a good upper bound.
+func alignmentOrder(columnList []common.ColumnInfo) []int {
+	order := identityOrder(len(columnList))
+	sort.SliceStable(order, func(i, j int) bool {
+		return likelyForm(columnList[order[i]]).align > likelyForm(columnList[order[j]]).align
+	})
+	return order
+}
+
+// Reorder returns the columns in the given order of indexes into columnList.
+func Reorder(columnList []common.ColumnInfo, order []int) []common.ColumnInfo {
+	reordered := make([]common.ColumnInfo, len(order))
+	for i, index := range order {
+		reordered[i] = columnList[index]
+	}
+	return reordered
+}
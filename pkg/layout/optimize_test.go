@@ -0,0 +1,167 @@
+package layout
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func TestOptimize_KeepsOptimalOrder(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", TypLen: 8, TypAlign: 8},
+		{ColumnName: "count", TypLen: 4, TypAlign: 4},
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+	}
+
+	ordering := Optimize(columnList)
+
+	assert.Equal(t, []int{0, 1, 2}, ordering.Order)
+	assert.True(t, ordering.Optimal())
+}
+
+func TestOptimize_MovesOnlyWhenItSaves(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "a", TypLen: 1, TypAlign: 1},
+		{ColumnName: "b", TypLen: 8, TypAlign: 8},
+		{ColumnName: "c", TypLen: 1, TypAlign: 1},
+		{ColumnName: "d", TypLen: 8, TypAlign: 8},
+	}
+
+	ordering := Optimize(columnList)
+
+	// Pairing the booleans is enough; leading with them still fits in 24 bytes.
+	assert.Equal(t, []int{0, 2, 1, 3}, ordering.Order)
+	assert.Equal(t, []int{1, 3, 2, 4}, ordering.Positions())
+	assert.Equal(t, 24.0+24.0, ordering.TupleSize)
+	assert.True(t, ordering.Optimal())
+}
+
+func TestOptimize_LengthNotMultipleOfAlignment(t *testing.T) {
+	// Sorting by alignment keeps the 6-byte macaddr next to the integers and pads each
+	// of them. Following it with the smallint instead fills the gap.
+	columnList := []common.ColumnInfo{
+		{ColumnName: "mac", TypLen: 6, TypAlign: 4},
+		{ColumnName: "count", TypLen: 4, TypAlign: 4},
+		{ColumnName: "small", TypLen: 2, TypAlign: 2},
+		{ColumnName: "total", TypLen: 4, TypAlign: 4},
+	}
+
+	ordering := Optimize(columnList)
+
+	assert.Equal(t, []int{0, 2, 1, 3}, ordering.Order)
+	assert.Equal(t, 24.0+16.0, ordering.TupleSize)
+	assert.True(t, ordering.Optimal())
+}
+
+func TestOptimize_VarlenaWithoutStatistics(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "note", TypLen: -1, TypAlign: 4, Storage: "x"},
+		{ColumnName: "id", TypLen: 8, TypAlign: 8},
+		{ColumnName: "created_at", TypLen: 8, TypAlign: 8},
+	}
+
+	ordering := Optimize(columnList)
+
+	// The note may end at any offset, so it goes after the columns it could misalign.
+	assert.Equal(t, []int{1, 2, 0}, ordering.Order)
+	assert.Equal(t, Expected(columnList).TupleSize, ordering.TupleSize)
+	assert.True(t, ordering.Optimal())
+
+	// Before a column that is aligned anyway, a short value only fills the padding.
+	withFlag := append([]common.ColumnInfo{{ColumnName: "flag", TypLen: 1, TypAlign: 1}}, columnList[:2]...)
+	assert.Equal(t, []int{0, 1, 2}, Optimize(withFlag).Order)
+}
+
+func TestOptimize_MatchesExhaustiveSearch(t *testing.T) {
+	types := []common.ColumnInfo{
+		{DataType: "boolean", TypLen: 1, TypAlign: 1},
+		{DataType: "smallint", TypLen: 2, TypAlign: 2},
+		{DataType: "integer", TypLen: 4, TypAlign: 4},
+		{DataType: "bigint", TypLen: 8, TypAlign: 8},
+		{DataType: "macaddr", TypLen: 6, TypAlign: 4},
+		{DataType: "text", TypLen: -1, TypAlign: 4, AvgWidth: 90, Storage: "x"},
+	}
+	random := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 50; trial++ {
+		columnList := make([]common.ColumnInfo, 2+random.Intn(5))
+		for i := range columnList {
+			columnList[i] = types[random.Intn(len(types))]
+			columnList[i].ColumnName = fmt.Sprintf("c%d", i)
+			if random.Intn(3) == 0 {
+				columnList[i].IsNullable = "YES"
+				columnList[i].NullFrac = float64(random.Intn(10)) / 10
+			}
+		}
+
+		bestOrder, bestSize := exhaustiveSearch(columnList)
+		ordering := Optimize(columnList)
+
+		assert.InDelta(t, bestSize, ordering.TupleSize, 1e-6, "trial %d", trial)
+		assert.Equal(t, bestOrder, ordering.Order, "trial %d", trial)
+		assert.True(t, ordering.Optimal(), "trial %d", trial)
+	}
+}
+
+func TestOptimize_WideTable(t *testing.T) {
+	types := []common.ColumnInfo{
+		{TypLen: 1, TypAlign: 1},
+		{TypLen: 2, TypAlign: 2},
+		{TypLen: 4, TypAlign: 4},
+		{TypLen: 8, TypAlign: 8},
+	}
+
+	columnList := make([]common.ColumnInfo, 60)
+	for i := range columnList {
+		columnList[i] = types[(i*7)%len(types)]
+		columnList[i].ColumnName = fmt.Sprintf("c%d", i)
+	}
+
+	ordering := Optimize(columnList)
+
+	assert.Len(t, ordering.Order, len(columnList))
+	assert.LessOrEqual(t, ordering.LowerBound, ordering.TupleSize)
+	assert.Equal(t, Expected(Reorder(columnList, ordering.Order)).TupleSize, ordering.TupleSize)
+}
+
+// exhaustiveSearch returns the lexicographically smallest order with the smallest
+// expected tuple size by trying every permutation.
+func exhaustiveSearch(columnList []common.ColumnInfo) ([]int, float64) {
+	return exhaustiveSearchWith(columnList, func([]int) bool { return true }, 0)
+}
+
+// exhaustiveSearchWith is exhaustiveSearch over the permutations accepted by valid, with
+// each cacheable offset worth deformWeight bytes.
+func exhaustiveSearchWith(columnList []common.ColumnInfo, valid func([]int) bool, deformWeight float64) ([]int, float64) {
+	var bestOrder []int
+	bestSize := 0.0
+
+	var permute func(order []int, used []bool)
+	permute = func(order []int, used []bool) {
+		if len(order) == len(columnList) {
+			if !valid(order) {
+				return
+			}
+			reordered := Reorder(columnList, order)
+			size := Expected(reordered).TupleSize - deformWeight*float64(DeformScore(reordered))
+			if bestOrder == nil || size < bestSize-1e-9 {
+				bestOrder, bestSize = append([]int(nil), order...), size
+			}
+			return
+		}
+		for i := range columnList {
+			if !used[i] {
+				used[i] = true
+				permute(append(order, i), used)
+				used[i] = false
+			}
+		}
+	}
+	permute(nil, make([]bool, len(columnList)))
+
+	return bestOrder, bestSize
+}
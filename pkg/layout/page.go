@@ -0,0 +1,56 @@
+package layout
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// BlockSize is BLCKSZ, the size of a heap page in the default build.
+	BlockSize = 8192
+
+	// PageHeaderSize is SizeOfPageHeaderData, the header at the start of every page.
+	PageHeaderSize = 24
+
+	// ItemIDSize is the line pointer each tuple takes in its page's item array.
+	ItemIDSize = 4
+
+	// MaxHeapTuplesPerPage caps the line pointers on a page however small its tuples are.
+	MaxHeapTuplesPerPage = 291
+
+	DefaultFillFactor = 100
+)
+
+// HeapSize estimates the main fork of a table freshly loaded with rows tuples of
+// tupleSize bytes on average. Inserts move on to a new page once the free space left
+// would drop below what the fill factor reserves, so each page holds as many tuples and
+// line pointers as fit in its fill factor share after the page header.
+func HeapSize(rows int64, tupleSize float64, fillFactor int) int64 {
+	if rows <= 0 {
+		return 0
+	}
+	if fillFactor <= 0 || fillFactor > 100 {
+		fillFactor = DefaultFillFactor
+	}
+
+	usable := float64(BlockSize*fillFactor/100 - PageHeaderSize)
+	perPage := math.Floor(usable / (tupleSize + ItemIDSize))
+	perPage = math.Max(1, math.Min(perPage, MaxHeapTuplesPerPage))
+
+	return int64(math.Ceil(float64(rows)/perPage)) * BlockSize
+}
+
+// FillFactor reads fillfactor from reloptions as rendered by array_to_string, falling
+// back to the default for heap tables.
+func FillFactor(options string) int {
+	for _, option := range strings.Split(options, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(option), "=")
+		if found && name == "fillfactor" {
+			if factor, err := strconv.Atoi(value); err == nil {
+				return factor
+			}
+		}
+	}
+	return DefaultFillFactor
+}
@@ -0,0 +1,32 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeapSize(t *testing.T) {
+	// 8168 usable bytes hold 204 tuples of 36 bytes with their line pointers.
+	assert.Equal(t, int64(5*BlockSize), HeapSize(1000, 36, 100))
+	assert.Equal(t, int64(BlockSize), HeapSize(204, 36, 100))
+	assert.Equal(t, int64(2*BlockSize), HeapSize(205, 36, 100))
+}
+
+func TestHeapSize_FillFactor(t *testing.T) {
+	// At fillfactor 50, 4072 usable bytes hold 101 tuples of 36 bytes.
+	assert.Equal(t, int64(10*BlockSize), HeapSize(1000, 36, 50))
+}
+
+func TestHeapSize_Limits(t *testing.T) {
+	assert.Equal(t, int64(0), HeapSize(0, 36, 100))
+	assert.Equal(t, int64(BlockSize), HeapSize(291, 24, 0))
+	assert.Equal(t, int64(2*BlockSize), HeapSize(292, 24, 100))
+	assert.Equal(t, int64(3*BlockSize), HeapSize(3, 10000, 100))
+}
+
+func TestFillFactor(t *testing.T) {
+	assert.Equal(t, 100, FillFactor(""))
+	assert.Equal(t, 70, FillFactor("autovacuum_enabled=false, fillfactor=70"))
+	assert.Equal(t, 100, FillFactor("toast.fillfactor=50"))
+}
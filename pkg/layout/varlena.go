@@ -0,0 +1,124 @@
+package layout
+
+import (
+	"math"
+
+	"main/pkg/common"
+)
+
+const (
+	// VarattShortMax is VARATT_SHORT_MAX, the largest varlena, header included, that can
+	// be stored with a 1-byte header.
+	VarattShortMax = 127
+
+	// storagePlain is the attstorage value that forbids converting a varlena to the
+	// short format.
+	storagePlain = "p"
+)
+
+// storageForm is one way a non-NULL value of a column can be laid out in the data area.
+type storageForm struct {
+	probability float64
+	align       int
+	size        int
+}
+
+// storageForms lists the forms a non-NULL value of the column can take, along with how
+// likely each is. Fixed-length types only ever have one.
+func storageForms(col common.ColumnInfo) []storageForm {
+	switch {
+	case col.TypLen > 0:
+		return []storageForm{{probability: 1, align: col.TypAlign, size: col.TypLen}}
+	case col.TypLen == -1:
+		return varlenaForms(col)
+	default:
+		// cstring (typlen -2) is char-aligned and at least its terminating NUL byte.
+		return []storageForm{{probability: 1, align: 1, size: 1}}
+	}
+}
+
+// likelyForm returns the most probable form, which is the one used for the layout of a
+// single representative row.
+func likelyForm(col common.ColumnInfo) storageForm {
+	forms := storageForms(col)
+	likely := forms[0]
+	for _, form := range forms[1:] {
+		if form.probability > likely.probability {
+			likely = form
+		}
+	}
+	return likely
+}
+
+// varlenaForms splits a varlena column into its short and long header forms. heap_fill_tuple
+// converts any value that fits in VarattShortMax bytes to a 1-byte header, which is never
+// aligned; larger values keep the 4-byte header and are aligned to typalign.
+//
+// pg_stats only records the average width, so widths are modelled as exponentially
+// distributed around avg_width. That gives the share of values under the short limit and
+// the mean width of each side. Without statistics nothing is known of the length, so a
+// value leaves the columns after it at any offset; see unknownLengthForms.
+func varlenaForms(col common.ColumnInfo) []storageForm {
+	if unknownLength(col) {
+		if col.Storage == storagePlain {
+			return unknownLengthForms(col.TypAlign, VarHdrSz)
+		}
+		return unknownLengthForms(1, 1)
+	}
+
+	if col.Storage == storagePlain {
+		return []storageForm{{probability: 1, align: col.TypAlign, size: col.AvgWidth}}
+	}
+
+	mean := float64(col.AvgWidth)
+	short := ShortHeaderFraction(col)
+	long := 1 - short
+
+	forms := make([]storageForm, 0, 2)
+	if short > 0 {
+		// Mean of an exponential distribution truncated at VarattShortMax.
+		shortWidth := mean - VarattShortMax*long/short
+		forms = append(forms, storageForm{probability: short, align: 1, size: roundWidth(shortWidth)})
+	}
+	if long > 0 {
+		// The exponential distribution is memoryless, so values past the limit exceed it by
+		// the mean on average.
+		forms = append(forms, storageForm{probability: long, align: col.TypAlign, size: roundWidth(VarattShortMax + mean)})
+	}
+	return forms
+}
+
+// unknownLengthForms models a value of unknown length, at least minSize bytes with its
+// header, as equally likely to end at each offset modulo MaxAlign. A value of a column
+// without statistics is most likely short enough for a 1-byte header, which is unaligned,
+// so the fixed-width columns after it are as likely to need padding as not, and belong
+// before it.
+func unknownLengthForms(align, minSize int) []storageForm {
+	forms := make([]storageForm, MaxAlign)
+	for i := range forms {
+		forms[i] = storageForm{probability: 1.0 / MaxAlign, align: align, size: minSize + i}
+	}
+	return forms
+}
+
+// unknownLength reports whether nothing is known of the length of the column's values.
+func unknownLength(col common.ColumnInfo) bool {
+	return col.TypLen == -1 && col.AvgWidth <= 0
+}
+
+// ShortHeaderFraction estimates the share of a varlena column's values stored with a
+// 1-byte header. It is zero for fixed-length columns, for columns without statistics and
+// for columns using plain storage.
+func ShortHeaderFraction(col common.ColumnInfo) float64 {
+	if col.TypLen != -1 || col.AvgWidth <= 0 || col.Storage == storagePlain {
+		return 0
+	}
+	return 1 - math.Exp(-VarattShortMax/float64(col.AvgWidth))
+}
+
+func roundWidth(width float64) int {
+	if width < 1 {
+		return 1
+	}
+	return int(math.Round(width))
+}
@@ -0,0 +1,55 @@
+package layout
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func TestShortHeaderFraction(t *testing.T) {
+	assert.Equal(t, 0.0, ShortHeaderFraction(common.ColumnInfo{TypLen: 8, TypAlign: 8, AvgWidth: 8}))
+	assert.Equal(t, 0.0, ShortHeaderFraction(common.ColumnInfo{TypLen: -1, TypAlign: 4}))
+	assert.Equal(t, 0.0, ShortHeaderFraction(common.ColumnInfo{TypLen: -1, TypAlign: 4, AvgWidth: 10, Storage: "p"}))
+	assert.InDelta(t, 1-math.Exp(-1), ShortHeaderFraction(common.ColumnInfo{TypLen: -1, TypAlign: 4, AvgWidth: 127, Storage: "x"}), 1e-9)
+	assert.Greater(t, ShortHeaderFraction(common.ColumnInfo{TypLen: -1, TypAlign: 4, AvgWidth: 10, Storage: "x"}), 0.99)
+}
+
+func TestCompute_ShortVarlena(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+		{ColumnName: "name", TypLen: -1, TypAlign: 4, AvgWidth: 10, Storage: "x"},
+		{ColumnName: "count", TypLen: 4, TypAlign: 4},
+	}
+
+	result := Compute(columnList)
+
+	// Short varlenas are not aligned, so the name follows the flag directly.
+	assert.Equal(t, ColumnLayout{Offset: 1, Padding: 0, Size: 10}, result.Columns[1])
+	assert.Equal(t, ColumnLayout{Offset: 12, Padding: 1, Size: 4}, result.Columns[2])
+}
+
+func TestCompute_PlainVarlena(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+		{ColumnName: "name", TypLen: -1, TypAlign: 4, AvgWidth: 10, Storage: "p"},
+	}
+
+	result := Compute(columnList)
+
+	assert.Equal(t, ColumnLayout{Offset: 4, Padding: 3, Size: 10}, result.Columns[1])
+}
+
+func TestExpected_MixedVarlena(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1},
+		{ColumnName: "body", TypLen: -1, TypAlign: 4, AvgWidth: 127, Storage: "x"},
+	}
+
+	expected := Expected(columnList)
+
+	// Only values too long for a 1-byte header are aligned.
+	assert.InDelta(t, 3*math.Exp(-1), expected.Padding[1], 1e-9)
+}
@@ -0,0 +1,310 @@
+package migration
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Framework is a migration tool whose native file layout a plan can be written in.
+type Framework string
+
+const (
+	Goose         Framework = "goose"
+	GolangMigrate Framework = "golang-migrate"
+	Flyway        Framework = "flyway"
+	Sqitch        Framework = "sqitch"
+
+	sqitchPlan = "sqitch.plan"
+
+	// timestampVersion is the layout of versions that tools number migrations by when
+	// they do not count them, as goose create and migrate create do by default.
+	timestampVersion = "20060102150405"
+)
+
+var Frameworks = []Framework{Goose, GolangMigrate, Flyway, Sqitch}
+
+var (
+	gooseFile         = regexp.MustCompile(`^(\d+)_.+\.(sql|go)$`)
+	golangMigrateFile = regexp.MustCompile(`^(\d+)_.+\.(up|down)\.sql$`)
+	flywayFile        = regexp.MustCompile(`^[VU](\d+)([._]\d+)*__.+\.sql$`)
+	sqitchChange      = regexp.MustCompile(`^([^\s%#@:][^\s]*)\s+(?:\[[^\]]*\]\s+)?\S+\s+(.+?<[^>]*>)`)
+	nonNameCharacter  = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+func ParseFramework(name string) (Framework, error) {
+	for _, framework := range Frameworks {
+		if string(framework) == name {
+			return framework, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported migration framework %q, expected goose, golang-migrate, flyway or sqitch", name)
+}
+
+// SingleStatement reports whether the framework sends a whole migration to the server as
+// one query string, which runs as a single transaction, so plans for it need
+// Options.SingleStatementCopy.
+func (f Framework) SingleStatement() bool {
+	return f == GolangMigrate
+}
+
+// File is a file of a migration, with its path relative to the migrations directory.
+type File struct {
+	Path    string
+	Content string
+}
+
+type ExportOptions struct {
+	// Planner is the "name <email>" sqitch records for the change. The planner of the last
+	// change in sqitch.plan is taken when it is empty.
+	Planner string
+	Now     time.Time
+}
+
+// Export lays out plan as a migration named name in the native files of framework,
+// numbered after the migrations already in dir. Each file runs outside a transaction
+// wrapper, as the copy commits its own batches, and every tool gets the statements in
+// pieces it can run one at a time; sqitch, which runs scripts with psql, gets them as
+// they are. For sqitch, the returned files include sqitch.plan with the change appended.
+func Export(framework Framework, dir fs.FS, name string, plan Plan, options ExportOptions) ([]File, error) {
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+	name = nonNameCharacter.ReplaceAllString(name, "_")
+
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	switch framework {
+	case Goose:
+		version := nextVersion(names, gooseFile, 5, options.Now)
+		content := "-- +goose NO TRANSACTION\n-- +goose Up\n" + gooseStatements(plan.Forward) + "\n-- +goose Down\n" + gooseStatements(plan.Rollback)
+		return []File{{Path: fmt.Sprintf("%s_%s.sql", version, name), Content: content}}, nil
+	case GolangMigrate:
+		version := nextVersion(names, golangMigrateFile, 6, options.Now)
+		return []File{
+			{Path: fmt.Sprintf("%s_%s.up.sql", version, name), Content: withoutMetaCommands(plan.Forward)},
+			{Path: fmt.Sprintf("%s_%s.down.sql", version, name), Content: withoutMetaCommands(plan.Rollback)},
+		}, nil
+	case Flyway:
+		version := nextVersion(names, flywayFile, 1, options.Now)
+		// The undo migration is only run by editions of Flyway that support undo.
+		config := "executeInTransaction=false\n"
+		return []File{
+			{Path: fmt.Sprintf("V%s__%s.sql", version, name), Content: withoutMetaCommands(plan.Forward)},
+			{Path: fmt.Sprintf("V%s__%s.sql.conf", version, name), Content: config},
+			{Path: fmt.Sprintf("U%s__%s.sql", version, name), Content: withoutMetaCommands(plan.Rollback)},
+			{Path: fmt.Sprintf("U%s__%s.sql.conf", version, name), Content: config},
+		}, nil
+	case Sqitch:
+		return sqitchFiles(dir, name, plan, options)
+	}
+	return nil, fmt.Errorf("unsupported migration framework %q", framework)
+}
+
+// nextVersion numbers a migration after the highest version among names, keeping the
+// zero padding of the existing versions. Versions that are timestamps are followed by
+// the current time, and the first migration is numbered 1 padded to width digits.
+func nextVersion(names []string, pattern *regexp.Regexp, width int, now time.Time) string {
+	var highest uint64
+	found := false
+	for _, name := range names {
+		match := pattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if !found || version >= highest {
+			highest = version
+			width = len(match[1])
+			found = true
+		}
+	}
+
+	if found && width == len(timestampVersion) {
+		return now.UTC().Format(timestampVersion)
+	}
+	return fmt.Sprintf("%0*d", width, highest+1)
+}
+
+// gooseStatements annotates every piece of script that holds more than one statement or
+// a body with semicolons of its own, so that goose sends it in one piece instead of
+// splitting it at each semicolon.
+func gooseStatements(script string) string {
+	var annotated strings.Builder
+	for _, statement := range Statements(withoutMetaCommands(script)) {
+		if strings.Count(statement, ";\n") > 1 {
+			body := strings.TrimLeft(statement, "\n")
+			annotated.WriteString(statement[:len(statement)-len(body)])
+			annotated.WriteString("-- +goose StatementBegin\n" + body + "-- +goose StatementEnd\n")
+		} else {
+			annotated.WriteString(statement)
+		}
+	}
+	return annotated.String()
+}
+
+// sqitchFiles writes the deploy, revert and verify scripts of a change and appends the
+// change to sqitch.plan.
+func sqitchFiles(dir fs.FS, name string, plan Plan, options ExportOptions) ([]File, error) {
+	content, err := fs.ReadFile(dir, sqitchPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s, run sqitch init first: %w", sqitchPlan, err)
+	}
+
+	project := ""
+	planner := options.Planner
+	for _, line := range strings.Split(string(content), "\n") {
+		if value, found := strings.CutPrefix(line, "%project="); found {
+			project = strings.TrimSpace(value)
+		}
+		if match := sqitchChange.FindStringSubmatch(line); match != nil {
+			if match[1] == name {
+				return nil, fmt.Errorf("%s already has a change named %s", sqitchPlan, name)
+			}
+			if options.Planner == "" {
+				planner = match[2]
+			}
+		}
+	}
+	if planner == "" {
+		return nil, fmt.Errorf("%s has no change to take the planner from, pass one as \"name <email>\"", sqitchPlan)
+	}
+
+	planned := string(content)
+	if planned != "" && !strings.HasSuffix(planned, "\n") {
+		planned += "\n"
+	}
+	planned += fmt.Sprintf("%s %s %s # Reorder columns\n", name, options.Now.UTC().Format(time.RFC3339), planner)
+
+	script := name + ".sql"
+	return []File{
+		{Path: path.Join("deploy", script), Content: fmt.Sprintf("-- Deploy %s:%s to pg\n\n", project, name) + plan.Forward},
+		{Path: path.Join("revert", script), Content: fmt.Sprintf("-- Revert %s:%s from pg\n\n", project, name) + plan.Rollback},
+		{Path: path.Join("verify", script), Content: fmt.Sprintf("-- Verify %s:%s on pg\n\n", project, name) + plan.Verify},
+		{Path: sqitchPlan, Content: planned},
+	}, nil
+}
+
+// withoutMetaCommands drops the psql meta-commands of a script, which only psql
+// understands.
+func withoutMetaCommands(script string) string {
+	lines := strings.SplitAfter(script, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "\\") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// Statements splits a script into the pieces a client can send one at a time: single
+// statements, with the comments and blank lines before them, and whole transactions from
+// BEGIN to COMMIT, which have to run on one connection. Semicolons in quotes, comments
+// and dollar-quoted bodies do not end a statement.
+func Statements(script string) []string {
+	var pieces []string
+	pieceStart, statementStart, transaction := 0, 0, false
+
+	for i := 0; i < len(script); i++ {
+		switch {
+		case script[i] == '\'' || script[i] == '"':
+			// A doubled quote closes and reopens the quote, which comes to the same.
+			i = skipPast(script, i+1, string(script[i]))
+		case strings.HasPrefix(script[i:], "--"):
+			i = skipPast(script, i, "\n")
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skipPast(script, i+2, "*/")
+		case script[i] == '$' && (i == 0 || !isNameCharacter(script[i-1])):
+			if tag := dollarQuote(script[i:]); tag != "" {
+				i = skipPast(script, i+len(tag), tag)
+			}
+		case script[i] == ';':
+			// The rest of the line after the semicolon stays with the statement.
+			i = skipPast(script, i, "\n")
+			switch keyword := strings.ToUpper(firstWord(script[statementStart : i+1])); {
+			case keyword == "BEGIN" || keyword == "START":
+				transaction = true
+			case keyword == "COMMIT" || keyword == "END" || keyword == "ROLLBACK":
+				transaction = false
+			}
+			statementStart = i + 1
+			if !transaction {
+				pieces = append(pieces, script[pieceStart:statementStart])
+				pieceStart = statementStart
+			}
+		}
+	}
+
+	// Trailing comments and blank lines stay with the last piece.
+	if rest := script[pieceStart:]; firstWord(rest) != "" || len(pieces) == 0 {
+		pieces = append(pieces, rest)
+	} else {
+		pieces[len(pieces)-1] += rest
+	}
+	return pieces
+}
+
+// skipPast returns the index of the last byte of the first closing after from, or the
+// end of s when it is not closed.
+func skipPast(s string, from int, closing string) int {
+	if at := strings.Index(s[from:], closing); at != -1 {
+		return from + at + len(closing) - 1
+	}
+	return len(s) - 1
+}
+
+// firstWord returns the first word of a statement after its leading comments.
+func firstWord(statement string) string {
+	for {
+		statement = strings.TrimSpace(statement)
+		if !strings.HasPrefix(statement, "--") {
+			break
+		}
+		if newline := strings.IndexByte(statement, '\n'); newline != -1 {
+			statement = statement[newline+1:]
+		} else {
+			return ""
+		}
+	}
+
+	end := 0
+	for end < len(statement) && isNameCharacter(statement[end]) {
+		end++
+	}
+	return statement[:end]
+}
+
+// dollarQuote returns the opening $tag$ of a dollar quote at the start of s, or "" when s
+// does not start one.
+func dollarQuote(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1]
+		case !isNameCharacter(s[i]) || (i == 1 && s[i] >= '0' && s[i] <= '9'):
+			return ""
+		}
+	}
+	return ""
+}
+
+func isNameCharacter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
@@ -0,0 +1,133 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var exportTime = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func TestStatements(t *testing.T) {
+	script := "-- Header; not a statement\n\\set ON_ERROR_STOP on\n\n" +
+		"CREATE TABLE t (a text DEFAULT ';');\n" +
+		"DO $copy$\nBEGIN\n    COMMIT;\nEND\n$copy$;\n" +
+		"BEGIN;\nSET LOCAL lock_timeout = '5s';\nALTER TABLE t RENAME TO \"u;\";\nCOMMIT;\n" +
+		"/* trailing; */\n"
+
+	assert.Equal(t, []string{
+		"-- Header; not a statement\n\\set ON_ERROR_STOP on\n\nCREATE TABLE t (a text DEFAULT ';');\n",
+		"DO $copy$\nBEGIN\n    COMMIT;\nEND\n$copy$;\n",
+		"BEGIN;\nSET LOCAL lock_timeout = '5s';\nALTER TABLE t RENAME TO \"u;\";\nCOMMIT;\n/* trailing; */\n",
+	}, Statements(script))
+}
+
+func TestNextVersion(t *testing.T) {
+	assert.Equal(t, "00001", nextVersion(nil, gooseFile, 5, exportTime))
+	assert.Equal(t, "00013", nextVersion([]string{"00002_a.sql", "00012_b.go", "README.md"}, gooseFile, 5, exportTime))
+	assert.Equal(t, "20240301123000", nextVersion([]string{"20230101000000_a.sql"}, gooseFile, 5, exportTime))
+	assert.Equal(t, "004", nextVersion([]string{"003_a.up.sql", "003_a.down.sql"}, golangMigrateFile, 6, exportTime))
+	assert.Equal(t, "8", nextVersion([]string{"V7__a.sql", "V2.1__b.sql", "R__views.sql"}, flywayFile, 1, exportTime))
+}
+
+func TestExport_Goose(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Rebuild("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	files, err := Export(Goose, fstest.MapFS{"00004_init.sql": {}}, "reorder_orders", plan, ExportOptions{Now: exportTime})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	assert.Len(t, files, 1)
+	assert.Equal(t, "00005_reorder_orders.sql", files[0].Path)
+	assertInOrder(t, files[0].Content, []string{
+		"-- +goose NO TRANSACTION\n-- +goose Up\n",
+		"-- +goose StatementBegin\n-- Copy the data in batches",
+		"$copy$;\n-- +goose StatementEnd\n",
+		"-- +goose StatementBegin\n-- Swap the tables\nBEGIN;\nSET LOCAL lock_timeout = '5s';",
+		"COMMIT;\n-- +goose StatementEnd\n",
+		"-- +goose Down\n-- +goose StatementBegin\n-- Roll back the rebuild of public.orders",
+		"BEGIN;\n",
+		"COMMIT;\n-- +goose StatementEnd\n",
+		"DROP TABLE public.orders_new;\n",
+	})
+	assert.NotContains(t, files[0].Content, "\\set")
+	assert.NotContains(t, files[0].Content, "StatementBegin\nCREATE INDEX")
+}
+
+func TestExport_GolangMigrate(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Rebuild("public", table, columnList, Options{SingleStatementCopy: true})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	files, err := Export(GolangMigrate, fstest.MapFS{"000009_init.up.sql": {}, "000009_init.down.sql": {}}, "reorder orders", plan, ExportOptions{Now: exportTime})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	assert.Equal(t, "000010_reorder_orders.up.sql", files[0].Path)
+	assert.Equal(t, "000010_reorder_orders.down.sql", files[1].Path)
+	assert.Contains(t, files[0].Content, "-- Copy the data in a single statement\nINSERT INTO public.orders_new")
+	assert.NotContains(t, files[0].Content, "DO $copy$")
+	assert.NotContains(t, files[1].Content, "\\set")
+}
+
+func TestExport_Flyway(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Rebuild("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	files, err := Export(Flyway, fstest.MapFS{"V2__init.sql": {}, "V3.1__seed.sql": {}}, "reorder_orders", plan, ExportOptions{Now: exportTime})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	assert.Equal(t, []string{"V4__reorder_orders.sql", "V4__reorder_orders.sql.conf", "U4__reorder_orders.sql", "U4__reorder_orders.sql.conf"}, paths)
+	assert.Equal(t, "executeInTransaction=false\n", files[1].Content)
+	assert.True(t, strings.HasPrefix(files[2].Content, "-- Roll back the rebuild of public.orders"))
+}
+
+func TestExport_Sqitch(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Rebuild("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	dir := fstest.MapFS{"sqitch.plan": {Data: []byte("%syntax-version=1.0.0\n%project=shop\n\ninit 2024-01-01T00:00:00Z Ann <ann@example.com> # Init\n")}}
+	files, err := Export(Sqitch, dir, "reorder_orders", plan, ExportOptions{Now: exportTime})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	assert.Equal(t, "deploy/reorder_orders.sql", files[0].Path)
+	assert.Contains(t, files[0].Content, "-- Deploy shop:reorder_orders to pg\n\n-- Rebuild public.orders")
+	assert.Contains(t, files[0].Content, "\\set ON_ERROR_STOP on")
+	assert.Equal(t, "revert/reorder_orders.sql", files[1].Path)
+	assert.Equal(t, "verify/reorder_orders.sql", files[2].Path)
+	assert.Contains(t, files[2].Content, "WHERE attrelid = 'public.orders'::regclass AND attnum > 0 AND NOT attisdropped)\n"+
+		"        IS DISTINCT FROM ARRAY['id', 'created_at', 'total', 'total_cents', 'customer_id', 'parent_id']::name[] THEN")
+	assert.Equal(t, "sqitch.plan", files[3].Path)
+	assert.True(t, strings.HasSuffix(files[3].Content, "# Init\nreorder_orders 2024-03-01T12:30:00Z Ann <ann@example.com> # Reorder columns\n"))
+
+	_, err = Export(Sqitch, fstest.MapFS{"sqitch.plan": {Data: []byte(files[3].Content)}}, "reorder_orders", plan, ExportOptions{})
+	assert.ErrorContains(t, err, "already has a change named reorder_orders")
+
+	_, err = Export(Sqitch, fstest.MapFS{"sqitch.plan": {Data: []byte("%project=shop\n")}}, "reorder_orders", plan, ExportOptions{})
+	assert.ErrorContains(t, err, "no change to take the planner from")
+}
@@ -0,0 +1,296 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"main/pkg/common"
+	"main/pkg/ddl"
+)
+
+const (
+	mirrorSuffix   = "_mirror"
+	truncateSuffix = "_mirror_truncate"
+	progressSuffix = "_progress"
+)
+
+// online carries the names of the objects an online rebuild adds around a rebuild, and
+// the pieces of SQL its statements share.
+type online struct {
+	rebuild
+
+	mirrorName   string
+	truncateName string
+	mirror       string
+	progress     string
+
+	key            []common.ColumnInfo
+	keyColumns     []string
+	keyColumnsList string
+	keyVariables   []string
+	oldKeyValues   []string
+	newKeyValues   []string
+	copiedColumns  []string
+	overriding     string
+}
+
+// Online plans the rebuild of a table with its columns in the order of columnList while
+// the table stays in use. Triggers mirror every change into the new table while it is
+// backfilled in primary key batches, with the last key copied saved as a checkpoint so
+// the backfill can be resumed. Once the two tables are verified to match, they are
+// swapped in the same short transaction as a rebuild. The table needs a primary key.
+func Online(schemaName string, table common.TableInfo, columnList []common.ColumnInfo, options Options) (Plan, error) {
+	r, err := newRebuild(schemaName, table, columnList, options)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	key := r.primaryKey()
+	if key == nil {
+		return Plan{}, fmt.Errorf("table %s needs a primary key to be rebuilt online", table.Name)
+	}
+	if options.SingleStatementCopy {
+		return Plan{}, fmt.Errorf("an online rebuild of table %s commits every batch of its backfill and cannot run as a single statement", table.Name)
+	}
+
+	o := online{
+		rebuild:      r,
+		key:          key,
+		mirrorName:   suffixed(table.Name, mirrorSuffix),
+		truncateName: suffixed(table.Name, truncateSuffix),
+		progress:     ProgressTable(schemaName, table.Name),
+	}
+	o.mirror = ddl.QualifiedName(schemaName, o.mirrorName)
+	o.copiedColumns, o.overriding = r.copiedColumns()
+	for i, col := range key {
+		column := ddl.QuoteIdent(col.ColumnName)
+		o.keyColumns = append(o.keyColumns, column)
+		o.keyVariables = append(o.keyVariables, fmt.Sprintf("_copy_last_%d", i+1))
+		o.newKeyValues = append(o.newKeyValues, "NEW."+column)
+		o.oldKeyValues = append(o.oldKeyValues, "OLD."+column)
+	}
+	o.keyColumnsList = strings.Join(o.keyColumns, ", ")
+
+	forward, err := o.forward()
+	if err != nil {
+		return Plan{}, err
+	}
+
+	cleanup := fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s;\nDROP TRIGGER IF EXISTS %s ON %s;\nDROP FUNCTION IF EXISTS %s();\nDROP TABLE IF EXISTS %s;\n",
+		ddl.QuoteIdent(o.mirrorName), o.name, ddl.QuoteIdent(o.truncateName), o.name, o.mirror, o.progress)
+	note := "-- If the cut-over has not run, only the statements after the swap transaction are needed.\n"
+	return Plan{Forward: forward, Rollback: o.rollback(note, "\n"+cleanup), Verify: o.verifyOrder()}, nil
+}
+
+func (o online) forward() (string, error) {
+	var script strings.Builder
+
+	fmt.Fprintf(&script, "-- Rebuild %s online with its columns in the order: %s.\n", o.name, strings.Join(o.columnNames(), ", "))
+	script.WriteString("--\n")
+	script.WriteString("-- Run with psql outside a transaction block. Writes to the table carry on while it runs:\n")
+	fmt.Fprintf(&script, "-- triggers mirror them into %s until the cut-over swaps the tables.\n", o.newTable)
+	fmt.Fprintf(&script, "-- If the backfill is interrupted, run its DO block again to resume from %s.\n", o.progress)
+	script.WriteString("-- The verification compares every row of both tables and stops the script on a mismatch.\n")
+	fmt.Fprintf(&script, "-- %s is kept for the rollback script; drop it once the rebuilt table has been checked.\n", o.oldTable)
+	script.WriteString(o.dependencyList())
+	script.WriteString("\\set ON_ERROR_STOP on\n\n")
+
+	script.WriteString("-- Create the shadow table with its primary key, which mirrored changes are matched on\n")
+	script.WriteString(o.createTable())
+	if o.table.Owner != "" {
+		fmt.Fprintf(&script, "ALTER TABLE %s OWNER TO %s;\n", o.newTable, ddl.QuoteIdent(o.table.Owner))
+	}
+	for _, constraint := range o.table.Constraints {
+		if constraint.Type == "p" {
+			script.WriteString(o.addConstraint(constraint))
+		}
+	}
+	script.WriteString("\n")
+
+	script.WriteString("-- Backfill checkpoint\n")
+	script.WriteString(o.createProgress())
+	script.WriteString("\n")
+
+	script.WriteString("-- Mirror changes into the shadow table\n")
+	script.WriteString(o.createMirror())
+	script.WriteString("\n")
+
+	script.WriteString(o.backfill())
+	script.WriteString("\n")
+
+	indexes, err := o.buildIndexes(false)
+	if err != nil {
+		return "", err
+	}
+	script.WriteString(indexes)
+
+	script.WriteString("-- Grants, row level security and policies\n")
+	script.WriteString(o.grants())
+	script.WriteString(o.rowSecurity())
+	script.WriteString("\n")
+
+	script.WriteString(o.verify())
+	script.WriteString("\n")
+
+	script.WriteString("-- Cut over\n")
+	script.WriteString(o.swap(fmt.Sprintf("DROP TRIGGER %s ON %s;\nDROP TRIGGER %s ON %s;\n",
+		ddl.QuoteIdent(o.mirrorName), o.name, ddl.QuoteIdent(o.truncateName), o.name)))
+	fmt.Fprintf(&script, "\nDROP FUNCTION %s();\nDROP TABLE %s;\n", o.mirror, o.progress)
+
+	return script.String(), nil
+}
+
+// createProgress creates the single row table the backfill records the last key it
+// copied in.
+func (o online) createProgress() string {
+	var statements strings.Builder
+	fmt.Fprintf(&statements, "CREATE TABLE %s (\n", o.progress)
+	for i, col := range o.key {
+		fmt.Fprintf(&statements, "    %s %s,\n", o.keyColumns[i], col.FormattedType)
+	}
+	statements.WriteString("    rows_copied bigint NOT NULL DEFAULT 0,\n")
+	statements.WriteString("    updated_at timestamp with time zone NOT NULL DEFAULT now()\n);\n")
+	fmt.Fprintf(&statements, "INSERT INTO %s DEFAULT VALUES;\n", o.progress)
+	return statements.String()
+}
+
+// createMirror installs the triggers that apply every change to the table to the shadow
+// table as well. The trigger function runs as its owner so that writers do not need
+// privileges on the shadow table.
+func (o online) createMirror() string {
+	var values, updates []string
+	isKey := make(map[string]bool)
+	for _, column := range o.keyColumns {
+		isKey[column] = true
+	}
+	for _, column := range o.copiedColumns {
+		values = append(values, "NEW."+column)
+		if !isKey[column] {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+		}
+	}
+
+	conflict := "DO NOTHING"
+	if len(updates) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+
+	var function strings.Builder
+	fmt.Fprintf(&function, "CREATE FUNCTION %s() RETURNS trigger\n", o.mirror)
+	function.WriteString("LANGUAGE plpgsql SECURITY DEFINER SET search_path = pg_catalog, pg_temp AS $mirror$\n")
+	function.WriteString("BEGIN\n")
+	function.WriteString("    IF TG_OP = 'TRUNCATE' THEN\n")
+	fmt.Fprintf(&function, "        TRUNCATE %s;\n", o.newTable)
+	function.WriteString("        RETURN NULL;\n")
+	function.WriteString("    END IF;\n")
+	fmt.Fprintf(&function, "    IF TG_OP = 'DELETE' OR (TG_OP = 'UPDATE' AND (%s) IS DISTINCT FROM (%s)) THEN\n",
+		strings.Join(o.oldKeyValues, ", "), strings.Join(o.newKeyValues, ", "))
+	fmt.Fprintf(&function, "        DELETE FROM %s WHERE (%s) = (%s);\n", o.newTable, o.keyColumnsList, strings.Join(o.oldKeyValues, ", "))
+	function.WriteString("    END IF;\n")
+	function.WriteString("    IF TG_OP IN ('INSERT', 'UPDATE') THEN\n")
+	fmt.Fprintf(&function, "        INSERT INTO %s (%s) %s\n", o.newTable, strings.Join(o.copiedColumns, ", "), strings.TrimSpace(o.overriding))
+	fmt.Fprintf(&function, "        VALUES (%s)\n", strings.Join(values, ", "))
+	fmt.Fprintf(&function, "        ON CONFLICT (%s) %s;\n", o.keyColumnsList, conflict)
+	function.WriteString("    END IF;\n")
+	function.WriteString("    RETURN NULL;\n")
+	function.WriteString("END\n$mirror$;\n")
+
+	fmt.Fprintf(&function, "CREATE TRIGGER %s AFTER INSERT OR UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE FUNCTION %s();\n",
+		ddl.QuoteIdent(o.mirrorName), o.name, o.mirror)
+	fmt.Fprintf(&function, "CREATE TRIGGER %s AFTER TRUNCATE ON %s FOR EACH STATEMENT EXECUTE FUNCTION %s();\n",
+		ddl.QuoteIdent(o.truncateName), o.name, o.mirror)
+
+	return strings.ReplaceAll(function.String(), " \n", "\n")
+}
+
+// backfill copies the rows in primary key batches, one per transaction, saving the last
+// key copied after each batch. Source rows are locked while they are copied, so that a
+// row deleted concurrently cannot be copied after its trigger has already run, and rows
+// the triggers already mirrored are left as they are.
+func (o online) backfill() string {
+	columnNames := strings.Join(o.copiedColumns, ", ")
+	variables := strings.Join(o.keyVariables, ", ")
+
+	descending := make([]string, len(o.keyColumns))
+	assignments := make([]string, len(o.keyColumns))
+	for i, column := range o.keyColumns {
+		descending[i] = column + " DESC"
+		assignments[i] = fmt.Sprintf("%s = %s", column, o.keyVariables[i])
+	}
+
+	// The first batch runs on its own when nothing has been copied yet, so that the
+	// statement of the loop stays a range scan of the key even once plpgsql switches it to
+	// a generic plan.
+	writeBatch := func(block *strings.Builder, indent, where string) {
+		fmt.Fprintf(block, "%sWITH source AS (\n", indent)
+		fmt.Fprintf(block, "%s    SELECT %s\n", indent, columnNames)
+		fmt.Fprintf(block, "%s    FROM %s\n", indent, o.name)
+		if where != "" {
+			fmt.Fprintf(block, "%s    WHERE %s\n", indent, where)
+		}
+		fmt.Fprintf(block, "%s    ORDER BY %s\n", indent, o.keyColumnsList)
+		fmt.Fprintf(block, "%s    LIMIT %d\n", indent, o.options.BatchSize)
+		fmt.Fprintf(block, "%s    FOR KEY SHARE\n", indent)
+		fmt.Fprintf(block, "%s), copied AS (\n", indent)
+		fmt.Fprintf(block, "%s    INSERT INTO %s (%s) %s\n", indent, o.newTable, columnNames, strings.TrimSpace(o.overriding))
+		fmt.Fprintf(block, "%s    SELECT %s FROM source\n", indent, columnNames)
+		fmt.Fprintf(block, "%s    ON CONFLICT (%s) DO NOTHING\n", indent, o.keyColumnsList)
+		fmt.Fprintf(block, "%s)\n", indent)
+		fmt.Fprintf(block, "%sSELECT %s, (SELECT count(*) FROM source) INTO %s, _copy_rows\n", indent, o.keyColumnsList, variables)
+		fmt.Fprintf(block, "%sFROM source\n", indent)
+		fmt.Fprintf(block, "%sORDER BY %s\n", indent, strings.Join(descending, ", "))
+		fmt.Fprintf(block, "%sLIMIT 1;\n", indent)
+	}
+	writeProgress := func(block *strings.Builder) {
+		block.WriteString("        _copy_total := _copy_total + _copy_rows;\n")
+		fmt.Fprintf(block, "        UPDATE %s SET %s, rows_copied = _copy_total, updated_at = now();\n", o.progress, strings.Join(assignments, ", "))
+		block.WriteString("        COMMIT;\n")
+		fmt.Fprintf(block, "        RAISE NOTICE '%% rows copied, up to (%%)', _copy_total, concat_ws(', ', %s);\n", variables)
+	}
+
+	var block strings.Builder
+	fmt.Fprintf(&block, "-- Backfill in batches of %d rows by primary key; rerun this block to resume\n", o.options.BatchSize)
+	block.WriteString("DO $backfill$\nDECLARE\n")
+	for i, col := range o.key {
+		fmt.Fprintf(&block, "    %s %s;\n", o.keyVariables[i], col.FormattedType)
+	}
+	block.WriteString("    _copy_rows bigint;\n")
+	block.WriteString("    _copy_total bigint;\n")
+	block.WriteString("BEGIN\n")
+	fmt.Fprintf(&block, "    SELECT %s, rows_copied INTO %s, _copy_total FROM %s;\n", o.keyColumnsList, variables, o.progress)
+	fmt.Fprintf(&block, "    IF %s IS NULL THEN\n", o.keyVariables[0])
+	writeBatch(&block, "        ", "")
+	block.WriteString("        IF NOT FOUND THEN\n            RETURN;\n        END IF;\n")
+	writeProgress(&block)
+	block.WriteString("    END IF;\n")
+	block.WriteString("    LOOP\n")
+	writeBatch(&block, "        ", fmt.Sprintf("(%s) > (%s)", o.keyColumnsList, variables))
+	block.WriteString("        EXIT WHEN NOT FOUND;\n")
+	writeProgress(&block)
+	block.WriteString("    END LOOP;\n")
+	block.WriteString("END\n$backfill$;\n")
+
+	return strings.ReplaceAll(block.String(), " \n", "\n")
+}
+
+// verify compares both tables row by row in one snapshot, in which the triggers keep
+// them identical, and raises an error that stops the script if they differ.
+func (o online) verify() string {
+	row := "row(" + strings.Join(o.copiedColumns, ", ") + ")::text"
+
+	var block strings.Builder
+	block.WriteString("-- Verify that the shadow table matches the table\n")
+	block.WriteString("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY;\n")
+	block.WriteString("DO $verify$\nDECLARE\n    _differences bigint;\nBEGIN\n")
+	block.WriteString("    SELECT count(*) INTO _differences FROM (\n")
+	fmt.Fprintf(&block, "        (SELECT %s FROM %s EXCEPT ALL SELECT %s FROM %s)\n", row, o.name, row, o.newTable)
+	block.WriteString("        UNION ALL\n")
+	fmt.Fprintf(&block, "        (SELECT %s FROM %s EXCEPT ALL SELECT %s FROM %s)\n", row, o.newTable, row, o.name)
+	block.WriteString("    ) differences;\n")
+	block.WriteString("    IF _differences > 0 THEN\n")
+	fmt.Fprintf(&block, "        RAISE EXCEPTION '%% rows differ between %s and %s', _differences;\n", strings.ReplaceAll(o.name, "'", "''"), strings.ReplaceAll(o.newTable, "'", "''"))
+	block.WriteString("    END IF;\n")
+	block.WriteString("END\n$verify$;\n")
+	block.WriteString("COMMIT;\n")
+	return block.String()
+}
@@ -0,0 +1,115 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func TestOnline_Forward(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Online("public", table, columnList, Options{BatchSize: 1000})
+	if err != nil {
+		t.Fatalf("Online failed: %v", err)
+	}
+
+	assertInOrder(t, plan.Forward, []string{
+		"-- Rebuild public.orders online with its columns in the order: id, created_at, total, total_cents, customer_id, parent_id.",
+		"CREATE TABLE public.orders_new (",
+		"ALTER TABLE public.orders_new OWNER TO app;",
+		"ALTER TABLE public.orders_new ADD CONSTRAINT orders_pkey_new PRIMARY KEY (id);",
+		"CREATE TABLE public.orders_progress (\n    id bigint,\n    rows_copied bigint NOT NULL DEFAULT 0,",
+		"INSERT INTO public.orders_progress DEFAULT VALUES;",
+		"CREATE FUNCTION public.orders_mirror() RETURNS trigger\nLANGUAGE plpgsql SECURITY DEFINER SET search_path = pg_catalog, pg_temp AS $mirror$",
+		"TRUNCATE public.orders_new;",
+		"IF TG_OP = 'DELETE' OR (TG_OP = 'UPDATE' AND (OLD.id) IS DISTINCT FROM (NEW.id)) THEN\n        DELETE FROM public.orders_new WHERE (id) = (OLD.id);",
+		"INSERT INTO public.orders_new (id, created_at, total, customer_id, parent_id) OVERRIDING SYSTEM VALUE\n" +
+			"        VALUES (NEW.id, NEW.created_at, NEW.total, NEW.customer_id, NEW.parent_id)\n" +
+			"        ON CONFLICT (id) DO UPDATE SET created_at = EXCLUDED.created_at, total = EXCLUDED.total, customer_id = EXCLUDED.customer_id, parent_id = EXCLUDED.parent_id;",
+		"CREATE TRIGGER orders_mirror AFTER INSERT OR UPDATE OR DELETE ON public.orders FOR EACH ROW EXECUTE FUNCTION public.orders_mirror();",
+		"CREATE TRIGGER orders_mirror_truncate AFTER TRUNCATE ON public.orders FOR EACH STATEMENT EXECUTE FUNCTION public.orders_mirror();",
+		"-- Backfill in batches of 1000 rows by primary key; rerun this block to resume",
+		"SELECT id, rows_copied INTO _copy_last_1, _copy_total FROM public.orders_progress;",
+		"    IF _copy_last_1 IS NULL THEN\n        WITH source AS (\n",
+		"            FROM public.orders\n            ORDER BY id\n",
+		"        IF NOT FOUND THEN\n            RETURN;\n        END IF;\n",
+		"    END IF;\n    LOOP\n",
+		"WHERE (id) > (_copy_last_1)",
+		"LIMIT 1000\n            FOR KEY SHARE",
+		"ON CONFLICT (id) DO NOTHING",
+		"UPDATE public.orders_progress SET id = _copy_last_1, rows_copied = _copy_total, updated_at = now();\n        COMMIT;",
+		"CREATE INDEX orders_created_at_idx_new ON public.orders_new USING btree (created_at);",
+		"GRANT SELECT ON TABLE public.orders_new TO reporting;",
+		"BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY;",
+		"(SELECT row(id, created_at, total, customer_id, parent_id)::text FROM public.orders EXCEPT ALL SELECT row(id, created_at, total, customer_id, parent_id)::text FROM public.orders_new)",
+		"RAISE EXCEPTION '% rows differ between public.orders and public.orders_new', _differences;",
+		"-- Cut over\nBEGIN;\nSET LOCAL lock_timeout = '5s';\nLOCK TABLE public.orders IN ACCESS EXCLUSIVE MODE;\n" +
+			"DROP TRIGGER orders_mirror ON public.orders;\nDROP TRIGGER orders_mirror_truncate ON public.orders;",
+		"ALTER TABLE public.orders RENAME TO orders_old;",
+		"ALTER TABLE public.orders_new RENAME TO orders;",
+		"COMMIT;",
+		"DROP FUNCTION public.orders_mirror();\nDROP TABLE public.orders_progress;",
+	})
+
+	// The primary key is built before the backfill rather than after it.
+	assert.Equal(t, 1, strings.Count(plan.Forward, "ADD CONSTRAINT orders_pkey_new"))
+}
+
+func TestOnline_Rollback(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Online("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Online failed: %v", err)
+	}
+
+	assertInOrder(t, plan.Rollback, []string{
+		"-- If the cut-over has not run, only the statements after the swap transaction are needed.",
+		"ALTER TABLE public.orders_old RENAME TO orders;",
+		"COMMIT;",
+		"DROP TRIGGER IF EXISTS orders_mirror ON public.orders;\nDROP TRIGGER IF EXISTS orders_mirror_truncate ON public.orders;\n" +
+			"DROP FUNCTION IF EXISTS public.orders_mirror();\nDROP TABLE IF EXISTS public.orders_progress;",
+		"DROP TABLE public.orders_new;",
+	})
+}
+
+func TestOnline_CompositeKey(t *testing.T) {
+	table := common.TableInfo{
+		Name:        "line_items",
+		Constraints: []common.ConstraintInfo{{Name: "line_items_pkey", Type: "p", Definition: "PRIMARY KEY (order_id, line)", Columns: []string{"order_id", "line"}}},
+	}
+	columnList := []common.ColumnInfo{
+		{ColumnName: "order_id", FormattedType: "bigint", IsNullable: "NO"},
+		{ColumnName: "line", FormattedType: "integer", IsNullable: "NO"},
+	}
+
+	plan, err := Online("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Online failed: %v", err)
+	}
+
+	assertInOrder(t, plan.Forward, []string{
+		"(OLD.order_id, OLD.line) IS DISTINCT FROM (NEW.order_id, NEW.line)",
+		"ON CONFLICT (order_id, line) DO NOTHING;",
+		"    IF _copy_last_1 IS NULL THEN\n",
+		"WHERE (order_id, line) > (_copy_last_1, _copy_last_2)",
+		"ORDER BY order_id DESC, line DESC",
+		"RAISE NOTICE '% rows copied, up to (%)', _copy_total, concat_ws(', ', _copy_last_1, _copy_last_2);",
+	})
+}
+
+func TestOnline_NoPrimaryKey(t *testing.T) {
+	table := common.TableInfo{Name: "events"}
+	columnList := []common.ColumnInfo{{ColumnName: "payload", FormattedType: "jsonb", IsNullable: "YES"}}
+
+	_, err := Online("public", table, columnList, Options{})
+	assert.EqualError(t, err, "table events needs a primary key to be rebuilt online")
+}
+
+func TestOnline_SingleStatementCopy(t *testing.T) {
+	table, columnList := sampleTable()
+	_, err := Online("public", table, columnList, Options{SingleStatementCopy: true})
+	assert.ErrorContains(t, err, "cannot run as a single statement")
+}
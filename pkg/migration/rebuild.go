@@ -0,0 +1,712 @@
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"main/pkg/common"
+	"main/pkg/ddl"
+	"main/pkg/dependency"
+)
+
+const (
+	newSuffix = "_new"
+	oldSuffix = "_old"
+
+	// maxIdentifierLength is NAMEDATALEN - 1, beyond which PostgreSQL truncates names.
+	maxIdentifierLength = 63
+
+	DefaultBatchSize   = 10000
+	DefaultLockTimeout = "5s"
+)
+
+type Options struct {
+	BatchSize   int
+	LockTimeout string
+
+	// SingleStatementCopy copies the rows in one INSERT rather than in committed batches,
+	// for runners that send a whole script as one query string, in which a DO block
+	// cannot commit.
+	SingleStatementCopy bool
+}
+
+// Plan holds the SQL scripts that rebuild a table and that undo the rebuild, and a check
+// that fails unless the table has its columns in the new order.
+type Plan struct {
+	Forward  string
+	Rollback string
+	Verify   string
+}
+
+// rebuild carries the names used throughout the scripts of one table.
+type rebuild struct {
+	schemaName string
+	table      common.TableInfo
+	columnList []common.ColumnInfo
+	options    Options
+
+	dependencies []dependency.Dependency
+
+	name     string
+	newName  string
+	oldName  string
+	newTable string
+	oldTable string
+}
+
+// Rebuild plans the rebuild of a table with its columns in the order of columnList. The
+// new table is created alongside the old one and filled in primary key batches, after
+// which indexes and constraints are built and the two tables are swapped by renaming in
+// one short transaction. The old table is kept so that the rollback can swap it back.
+// Views, rules and functions bound to the table are dropped and recreated in that
+// transaction; dependencies a rebuild cannot carry over, such as inheritance children,
+// are reported as an error.
+func Rebuild(schemaName string, table common.TableInfo, columnList []common.ColumnInfo, options Options) (Plan, error) {
+	r, err := newRebuild(schemaName, table, columnList, options)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	forward, err := r.forward()
+	if err != nil {
+		return Plan{}, err
+	}
+	return Plan{Forward: forward, Rollback: r.rollback("-- If the rebuild stopped before the swap, only the final DROP TABLE is needed.\n", ""), Verify: r.verifyOrder()}, nil
+}
+
+func newRebuild(schemaName string, table common.TableInfo, columnList []common.ColumnInfo, options Options) (rebuild, error) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.LockTimeout == "" {
+		options.LockTimeout = DefaultLockTimeout
+	}
+
+	r := rebuild{
+		schemaName: schemaName,
+		table:      table,
+		columnList: columnList,
+		options:    options,
+
+		dependencies: dependency.Analyze(table),
+
+		name:    ddl.QualifiedName(schemaName, table.Name),
+		newName: suffixed(table.Name, newSuffix),
+		oldName: suffixed(table.Name, oldSuffix),
+	}
+	r.newTable = ddl.QualifiedName(schemaName, r.newName)
+	r.oldTable = ddl.QualifiedName(schemaName, r.oldName)
+
+	if err := dependency.Blocking(table.Name, r.dependencies); err != nil {
+		return rebuild{}, err
+	}
+	return r, nil
+}
+
+func (r rebuild) forward() (string, error) {
+	var script strings.Builder
+
+	fmt.Fprintf(&script, "-- Rebuild %s with its columns in the order: %s.\n", r.name, strings.Join(r.columnNames(), ", "))
+	script.WriteString("--\n")
+	script.WriteString("-- Run with psql outside a transaction block: the copy commits after every batch.\n")
+	fmt.Fprintf(&script, "-- Writes to %s must be stopped until the swap has committed, or they will be lost.\n", r.name)
+	fmt.Fprintf(&script, "-- %s is kept for the rollback script; drop it once the rebuilt table has been checked.\n", r.oldTable)
+	script.WriteString(r.dependencyList())
+	script.WriteString("\\set ON_ERROR_STOP on\n\n")
+
+	script.WriteString("-- Create the new table\n")
+	script.WriteString(r.createTable())
+	if r.table.Owner != "" {
+		fmt.Fprintf(&script, "ALTER TABLE %s OWNER TO %s;\n", r.newTable, ddl.QuoteIdent(r.table.Owner))
+	}
+	script.WriteString("\n")
+
+	script.WriteString(r.copyData())
+	script.WriteString("\n")
+
+	indexes, err := r.buildIndexes(true)
+	if err != nil {
+		return "", err
+	}
+	script.WriteString(indexes)
+
+	script.WriteString("-- Grants, row level security and policies\n")
+	script.WriteString(r.grants())
+	script.WriteString(r.rowSecurity())
+	script.WriteString("\n")
+
+	script.WriteString("-- Swap the tables\n")
+	script.WriteString(r.swap(""))
+
+	return script.String(), nil
+}
+
+// buildIndexes builds the indexes and constraints of the loaded table, leaving out its
+// primary key when primaryKey is false because it was created before the load.
+func (r rebuild) buildIndexes(primaryKey bool) (string, error) {
+	var script strings.Builder
+
+	script.WriteString("-- Build indexes and constraints after the load\n")
+	for _, index := range r.table.Indexes {
+		statement, err := r.createIndex(index)
+		if err != nil {
+			return "", err
+		}
+		script.WriteString(statement)
+	}
+	for _, constraint := range r.table.Constraints {
+		switch {
+		case constraint.Type == "p" && !primaryKey:
+		case indexBacked(constraint):
+			script.WriteString(r.addConstraint(constraint))
+		case constraint.Type == "f" && constraint.Table == "":
+			script.WriteString(addForeignKey(r.newTable, constraint))
+		}
+	}
+	for _, constraint := range r.table.Constraints {
+		if constraint.Type == "f" && constraint.Table == "" && !notValid(constraint) {
+			fmt.Fprintf(&script, "ALTER TABLE %s VALIDATE CONSTRAINT %s;\n", r.newTable, ddl.QuoteIdent(constraint.Name))
+		}
+	}
+	script.WriteString("\n")
+
+	return script.String(), nil
+}
+
+// addConstraint adds an index backed constraint to the new table under a temporary name.
+func (r rebuild) addConstraint(constraint common.ConstraintInfo) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;\n", r.newTable, ddl.QuoteIdent(suffixed(constraint.Name, newSuffix)), constraint.Definition)
+}
+
+// swap renames the new table into place in one transaction, and validates what could
+// not be checked under the lock afterwards.
+func (r rebuild) swap(prelude string) string {
+	return "BEGIN;\n" + r.swapStatements(prelude) + "COMMIT;\n" + r.afterSwap()
+}
+
+// swapStatements are the statements of the swap transaction, which runs prelude as soon
+// as the table is locked.
+func (r rebuild) swapStatements(prelude string) string {
+	var script strings.Builder
+
+	fmt.Fprintf(&script, "SET LOCAL lock_timeout = %s;\n", ddl.QuoteLiteral(r.options.LockTimeout))
+	fmt.Fprintf(&script, "LOCK TABLE %s IN ACCESS EXCLUSIVE MODE;\n", r.name)
+	script.WriteString(prelude)
+	script.WriteString(r.dropDependents())
+	fmt.Fprintf(&script, "ALTER TABLE %s RENAME TO %s;\n", r.name, ddl.QuoteIdent(r.oldName))
+	script.WriteString(r.renameIndexes(r.oldTable, "", oldSuffix))
+	fmt.Fprintf(&script, "ALTER TABLE %s RENAME TO %s;\n", r.newTable, ddl.QuoteIdent(r.table.Name))
+	script.WriteString(r.renameIndexes(r.name, newSuffix, ""))
+	for _, sequence := range r.table.Sequences {
+		column := ddl.QuoteIdent(sequence.Column)
+		if sequence.Identity {
+			fmt.Fprintf(&script, "SELECT setval(pg_get_serial_sequence(%s, %s), last_value, is_called) FROM %s;\n",
+				ddl.QuoteLiteral(r.name), ddl.QuoteLiteral(sequence.Column), sequence.Name)
+		} else {
+			fmt.Fprintf(&script, "ALTER SEQUENCE %s OWNED BY %s.%s;\n", sequence.Name, r.name, column)
+		}
+	}
+	for _, constraint := range r.foreignKeysToTable() {
+		// Self-references were left out of the new table; the old table keeps its own.
+		if constraint.Table != r.name {
+			fmt.Fprintf(&script, "ALTER TABLE %s DROP CONSTRAINT %s;\n", constraint.Table, ddl.QuoteIdent(constraint.Name))
+		}
+		script.WriteString(addForeignKey(constraint.Table, constraint))
+	}
+	for _, trigger := range r.table.Triggers {
+		script.WriteString(trigger.Definition + ";\n")
+	}
+	script.WriteString(r.republish(r.oldTable))
+	script.WriteString(r.recreateDependents())
+
+	return script.String()
+}
+
+func (r rebuild) afterSwap() string {
+	return r.validateForeignKeysToTable() + r.refreshMaterializedViews()
+}
+
+// rollback swaps the old table back in place. note tells what to run when the forward
+// script stopped early, and cleanup runs before the rebuilt table is dropped.
+func (r rebuild) rollback(note string, cleanup string) string {
+	var script strings.Builder
+
+	fmt.Fprintf(&script, "-- Roll back the rebuild of %s by swapping %s back in place.\n", r.name, r.oldTable)
+	script.WriteString("--\n")
+	fmt.Fprintf(&script, "-- Rows written to the rebuilt table after the swap are not carried back to %s.\n", r.oldTable)
+	script.WriteString(note)
+	script.WriteString(r.dependencyList())
+	script.WriteString("\\set ON_ERROR_STOP on\n\n")
+
+	script.WriteString("BEGIN;\n")
+	fmt.Fprintf(&script, "SET LOCAL lock_timeout = %s;\n", ddl.QuoteLiteral(r.options.LockTimeout))
+	fmt.Fprintf(&script, "LOCK TABLE %s, %s IN ACCESS EXCLUSIVE MODE;\n", r.name, r.oldTable)
+	script.WriteString(r.dropDependents())
+	for _, constraint := range r.foreignKeysToTable() {
+		if constraint.Table != r.name {
+			fmt.Fprintf(&script, "ALTER TABLE %s DROP CONSTRAINT %s;\n", constraint.Table, ddl.QuoteIdent(constraint.Name))
+		}
+	}
+	for _, sequence := range r.table.Sequences {
+		if sequence.Identity {
+			column := ddl.QuoteIdent(sequence.Column)
+			fmt.Fprintf(&script, "SELECT setval(%s, max(%s)) FROM %s HAVING max(%s) IS NOT NULL;\n",
+				ddl.QuoteLiteral(sequence.Name), column, r.name, column)
+		}
+	}
+	fmt.Fprintf(&script, "ALTER TABLE %s RENAME TO %s;\n", r.name, ddl.QuoteIdent(r.newName))
+	script.WriteString(r.renameIndexes(r.newTable, "", newSuffix))
+	fmt.Fprintf(&script, "ALTER TABLE %s RENAME TO %s;\n", r.oldTable, ddl.QuoteIdent(r.table.Name))
+	script.WriteString(r.renameIndexes(r.name, oldSuffix, ""))
+	for _, sequence := range r.table.Sequences {
+		if !sequence.Identity {
+			fmt.Fprintf(&script, "ALTER SEQUENCE %s OWNED BY %s.%s;\n", sequence.Name, r.name, ddl.QuoteIdent(sequence.Column))
+		}
+	}
+	for _, constraint := range r.foreignKeysToTable() {
+		if constraint.Table != r.name {
+			script.WriteString(addForeignKey(constraint.Table, constraint))
+		}
+	}
+	script.WriteString(r.republish(r.newTable))
+	script.WriteString(r.recreateDependents())
+	script.WriteString("COMMIT;\n")
+
+	for _, constraint := range r.foreignKeysToTable() {
+		if constraint.Table != r.name && !notValid(constraint) {
+			fmt.Fprintf(&script, "ALTER TABLE %s VALIDATE CONSTRAINT %s;\n", constraint.Table, ddl.QuoteIdent(constraint.Name))
+		}
+	}
+	script.WriteString(r.refreshMaterializedViews())
+	script.WriteString(cleanup)
+	fmt.Fprintf(&script, "\nDROP TABLE %s;\n", r.newTable)
+
+	return script.String()
+}
+
+// verifyOrder raises an error unless the table has its columns in the new order, which
+// holds once the swap has committed.
+func (r rebuild) verifyOrder() string {
+	names := r.columnNames()
+	literals := make([]string, len(names))
+	for i, name := range names {
+		literals[i] = ddl.QuoteLiteral(name)
+	}
+
+	var block strings.Builder
+	fmt.Fprintf(&block, "-- Verify that %s has its columns in the order: %s.\n", r.name, strings.Join(names, ", "))
+	block.WriteString("DO $verify$\nBEGIN\n")
+	block.WriteString("    IF (SELECT array_agg(attname ORDER BY attnum) FROM pg_attribute\n")
+	fmt.Fprintf(&block, "        WHERE attrelid = %s::regclass AND attnum > 0 AND NOT attisdropped)\n", ddl.QuoteLiteral(r.name))
+	fmt.Fprintf(&block, "        IS DISTINCT FROM ARRAY[%s]::name[] THEN\n", strings.Join(literals, ", "))
+	fmt.Fprintf(&block, "        RAISE EXCEPTION '%s does not have its columns in the new order';\n", strings.ReplaceAll(r.name, "'", "''"))
+	block.WriteString("    END IF;\n")
+	block.WriteString("END\n$verify$;\n")
+	return block.String()
+}
+
+func (r rebuild) columnNames() []string {
+	names := make([]string, len(r.columnList))
+	for i, col := range r.columnList {
+		names[i] = col.ColumnName
+	}
+	return names
+}
+
+// createTable defines the new table with only its CHECK constraints, so that the load is
+// not slowed down by index maintenance or foreign key checks.
+func (r rebuild) createTable() string {
+	table := r.table
+	table.Name = r.newName
+	table.Constraints = nil
+	for _, constraint := range r.table.Constraints {
+		if constraint.Type == "c" {
+			table.Constraints = append(table.Constraints, constraint)
+		}
+	}
+	return ddl.CreateTable(r.schemaName, table, r.columnList)
+}
+
+// copyData copies the rows in primary key order, one batch per transaction, resuming
+// each batch after the last key copied. Tables without a primary key are copied in a
+// single statement.
+func (r rebuild) copyData() string {
+	columns, overriding := r.copiedColumns()
+	columnNames := strings.Join(columns, ", ")
+
+	key := r.primaryKey()
+	if key == nil || r.options.SingleStatementCopy {
+		reason := ""
+		if key == nil {
+			reason = fmt.Sprintf(", as %s has no primary key to batch by", r.name)
+		}
+		return fmt.Sprintf("-- Copy the data in a single statement%s\nINSERT INTO %s (%s) %sSELECT %s FROM %s;\n",
+			reason, r.newTable, columnNames, overriding, columnNames, r.name)
+	}
+
+	keyColumns := make([]string, len(key))
+	variables := make([]string, len(key))
+	descending := make([]string, len(key))
+	var declarations strings.Builder
+	for i, col := range key {
+		keyColumns[i] = ddl.QuoteIdent(col.ColumnName)
+		variables[i] = fmt.Sprintf("_copy_last_%d", i+1)
+		descending[i] = keyColumns[i] + " DESC"
+		fmt.Fprintf(&declarations, "    %s %s;\n", variables[i], col.FormattedType)
+	}
+
+	// The first batch runs on its own, so that the statement of the loop stays a range scan
+	// of the key even once plpgsql switches it to a generic plan.
+	writeBatch := func(block *strings.Builder, indent, where string) {
+		fmt.Fprintf(block, "%sWITH batch AS (\n", indent)
+		fmt.Fprintf(block, "%s    INSERT INTO %s (%s) %s\n", indent, r.newTable, columnNames, strings.TrimSpace(overriding))
+		fmt.Fprintf(block, "%s    SELECT %s\n", indent, columnNames)
+		fmt.Fprintf(block, "%s    FROM %s\n", indent, r.name)
+		if where != "" {
+			fmt.Fprintf(block, "%s    WHERE %s\n", indent, where)
+		}
+		fmt.Fprintf(block, "%s    ORDER BY %s\n", indent, strings.Join(keyColumns, ", "))
+		fmt.Fprintf(block, "%s    LIMIT %d\n", indent, r.options.BatchSize)
+		fmt.Fprintf(block, "%s    RETURNING %s\n", indent, strings.Join(keyColumns, ", "))
+		fmt.Fprintf(block, "%s)\n", indent)
+		fmt.Fprintf(block, "%sSELECT %s INTO %s\n", indent, strings.Join(keyColumns, ", "), strings.Join(variables, ", "))
+		fmt.Fprintf(block, "%sFROM batch\n", indent)
+		fmt.Fprintf(block, "%sORDER BY %s\n", indent, strings.Join(descending, ", "))
+		fmt.Fprintf(block, "%sLIMIT 1;\n", indent)
+	}
+
+	var block strings.Builder
+	fmt.Fprintf(&block, "-- Copy the data in batches of %d rows by primary key\n", r.options.BatchSize)
+	block.WriteString("DO $copy$\nDECLARE\n")
+	block.WriteString(declarations.String())
+	block.WriteString("BEGIN\n")
+	writeBatch(&block, "    ", "")
+	block.WriteString("    IF NOT FOUND THEN\n        RETURN;\n    END IF;\n")
+	block.WriteString("    COMMIT;\n    LOOP\n")
+	writeBatch(&block, "        ", fmt.Sprintf("(%s) > (%s)", strings.Join(keyColumns, ", "), strings.Join(variables, ", ")))
+	block.WriteString("        EXIT WHEN NOT FOUND;\n")
+	block.WriteString("        COMMIT;\n")
+	block.WriteString("    END LOOP;\nEND\n$copy$;\n")
+
+	return strings.ReplaceAll(block.String(), " \n", "\n")
+}
+
+// copiedColumns returns the quoted names of the columns that hold data to copy, leaving
+// out generated columns, and the clause an INSERT into the new table needs to write
+// identity columns generated always.
+func (r rebuild) copiedColumns() ([]string, string) {
+	var columns []string
+	overriding := ""
+	for _, col := range r.columnList {
+		if col.Generated != "" {
+			continue
+		}
+		columns = append(columns, ddl.QuoteIdent(col.ColumnName))
+		if col.Identity == "a" {
+			overriding = "OVERRIDING SYSTEM VALUE "
+		}
+	}
+	return columns, overriding
+}
+
+func (r rebuild) primaryKey() []common.ColumnInfo {
+	return PrimaryKey(r.table, r.columnList)
+}
+
+// PrimaryKey returns the columns of the table's primary key in key order, or nil when it
+// has none.
+func PrimaryKey(table common.TableInfo, columnList []common.ColumnInfo) []common.ColumnInfo {
+	for _, constraint := range table.Constraints {
+		if constraint.Type != "p" {
+			continue
+		}
+
+		var key []common.ColumnInfo
+		for _, name := range constraint.Columns {
+			for _, col := range columnList {
+				if col.ColumnName == name {
+					key = append(key, col)
+				}
+			}
+		}
+		if len(key) == len(constraint.Columns) && len(key) > 0 {
+			return key
+		}
+	}
+	return nil
+}
+
+// createIndex retargets an index definition from pg_get_indexdef at the new table under
+// a temporary name.
+func (r rebuild) createIndex(index common.IndexInfo) (string, error) {
+	target := " ON " + r.name + " USING "
+	at := strings.Index(index.Definition, target)
+	if at == -1 {
+		return "", fmt.Errorf("unable to retarget index %s: %s", index.Name, index.Definition)
+	}
+
+	create := "CREATE INDEX"
+	if strings.HasPrefix(index.Definition, "CREATE UNIQUE INDEX") {
+		create = "CREATE UNIQUE INDEX"
+	}
+	return fmt.Sprintf("%s %s ON %s USING %s;\n", create, ddl.QuoteIdent(suffixed(index.Name, newSuffix)), r.newTable, index.Definition[at+len(target):]), nil
+}
+
+// renameIndexes renames the indexes of table, including those backing constraints, from
+// their name with suffix from to their name with suffix to.
+func (r rebuild) renameIndexes(table, from, to string) string {
+	var statements strings.Builder
+	for _, constraint := range r.table.Constraints {
+		if indexBacked(constraint) {
+			fmt.Fprintf(&statements, "ALTER TABLE %s RENAME CONSTRAINT %s TO %s;\n", table,
+				ddl.QuoteIdent(suffixed(constraint.Name, from)), ddl.QuoteIdent(suffixed(constraint.Name, to)))
+		}
+	}
+	for _, index := range r.table.Indexes {
+		fmt.Fprintf(&statements, "ALTER INDEX %s RENAME TO %s;\n",
+			ddl.QualifiedName(r.schemaName, suffixed(index.Name, from)), ddl.QuoteIdent(suffixed(index.Name, to)))
+	}
+	return statements.String()
+}
+
+func (r rebuild) grants() string {
+	return grantStatements("TABLE "+r.newTable, r.table.Grants)
+}
+
+func (r rebuild) rowSecurity() string {
+	var statements strings.Builder
+	if r.table.RowSecurity {
+		fmt.Fprintf(&statements, "ALTER TABLE %s ENABLE ROW LEVEL SECURITY;\n", r.newTable)
+	}
+	if r.table.ForceRowSecurity {
+		fmt.Fprintf(&statements, "ALTER TABLE %s FORCE ROW LEVEL SECURITY;\n", r.newTable)
+	}
+
+	for _, policy := range r.table.Policies {
+		kind := "RESTRICTIVE"
+		if policy.Permissive {
+			kind = "PERMISSIVE"
+		}
+
+		roles := make([]string, len(policy.Roles))
+		for i, role := range policy.Roles {
+			roles[i] = ddl.QuoteIdent(role)
+		}
+
+		fmt.Fprintf(&statements, "CREATE POLICY %s ON %s AS %s FOR %s TO %s", ddl.QuoteIdent(policy.Name), r.newTable, kind, policy.Command, strings.Join(roles, ", "))
+		if policy.Using != "" {
+			fmt.Fprintf(&statements, " USING (%s)", policy.Using)
+		}
+		if policy.WithCheck != "" {
+			fmt.Fprintf(&statements, " WITH CHECK (%s)", policy.WithCheck)
+		}
+		statements.WriteString(";\n")
+	}
+	return statements.String()
+}
+
+// foreignKeysToTable lists the foreign keys that reference the table, including its own
+// self-references, all of which have to be pointed at the rebuilt table.
+func (r rebuild) foreignKeysToTable() []common.ConstraintInfo {
+	var constraints []common.ConstraintInfo
+	for _, constraint := range r.table.Constraints {
+		if constraint.Type == "f" && constraint.Table != "" {
+			constraints = append(constraints, constraint)
+		}
+	}
+	for _, constraint := range r.table.ReferencedBy {
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
+
+func (r rebuild) validateForeignKeysToTable() string {
+	var statements strings.Builder
+	for _, constraint := range r.foreignKeysToTable() {
+		if !notValid(constraint) {
+			fmt.Fprintf(&statements, "ALTER TABLE %s VALIDATE CONSTRAINT %s;\n", constraint.Table, ddl.QuoteIdent(constraint.Name))
+		}
+	}
+	if statements.Len() == 0 {
+		return ""
+	}
+	return "\n-- Validate the foreign keys referencing the rebuilt table\n" + statements.String()
+}
+
+// dependencyList describes the dependent objects in the header of a script.
+func (r rebuild) dependencyList() string {
+	if len(r.dependencies) == 0 {
+		return ""
+	}
+
+	var lines strings.Builder
+	lines.WriteString("--\n-- Dependent objects:\n")
+	for _, dependent := range r.dependencies {
+		fmt.Fprintf(&lines, "--   %-8s  %s %s\n", dependent.Action, dependent.Kind, dependent.Name)
+	}
+	if dependency.Count(r.dependencies, dependency.Recreate) > 0 {
+		lines.WriteString("-- Recreated objects get back their owner and grants, but not their comments or, for\n")
+		lines.WriteString("-- materialized views, their indexes.\n")
+	}
+	if dependency.Count(r.dependencies, dependency.Review) > 0 {
+		lines.WriteString("-- Objects to review use * and return the columns in the new order once the swap commits.\n")
+	}
+	return lines.String()
+}
+
+// recreated returns the dependents to drop and recreate around the swap, views in the
+// order they can be created.
+func (r rebuild) recreated() []dependency.Dependency {
+	var dependents []dependency.Dependency
+	for _, dependent := range r.dependencies {
+		if dependent.Action == dependency.Recreate {
+			dependents = append(dependents, dependent)
+		}
+	}
+
+	rank := map[string]int{dependency.KindFunction: 0, dependency.KindView: 1, dependency.KindMaterializedView: 1, dependency.KindRule: 2}
+	sort.SliceStable(dependents, func(i, j int) bool {
+		if rank[dependents[i].Kind] != rank[dependents[j].Kind] {
+			return rank[dependents[i].Kind] < rank[dependents[j].Kind]
+		}
+		return dependents[i].Depth < dependents[j].Depth
+	})
+	return dependents
+}
+
+func (r rebuild) dropDependents() string {
+	var statements strings.Builder
+	dependents := r.recreated()
+	for i := len(dependents) - 1; i >= 0; i-- {
+		dependent := dependents[i]
+		switch dependent.Kind {
+		case dependency.KindView:
+			fmt.Fprintf(&statements, "DROP VIEW %s;\n", dependent.Name)
+		case dependency.KindMaterializedView:
+			fmt.Fprintf(&statements, "DROP MATERIALIZED VIEW %s;\n", dependent.Name)
+		case dependency.KindRule:
+			fmt.Fprintf(&statements, "DROP RULE %s;\n", dependent.Name)
+		case dependency.KindFunction:
+			fmt.Fprintf(&statements, "DROP ROUTINE %s;\n", dependent.Name)
+		}
+	}
+	return statements.String()
+}
+
+// recreateDependents creates the dropped dependents again, now bound to whichever table
+// carries the name of the table. Materialized views are created empty and refreshed once
+// the swap has committed.
+func (r rebuild) recreateDependents() string {
+	var statements strings.Builder
+	for _, dependent := range r.recreated() {
+		definition := strings.TrimSuffix(strings.TrimSpace(dependent.Definition), ";")
+		options := ""
+		if dependent.Options != "" {
+			options = " WITH (" + dependent.Options + ")"
+		}
+
+		switch dependent.Kind {
+		case dependency.KindView:
+			fmt.Fprintf(&statements, "CREATE VIEW %s%s AS\n%s;\n", dependent.Name, options, definition)
+			if dependent.Owner != "" {
+				fmt.Fprintf(&statements, "ALTER VIEW %s OWNER TO %s;\n", dependent.Name, ddl.QuoteIdent(dependent.Owner))
+			}
+			statements.WriteString(grantStatements("TABLE "+dependent.Name, dependent.Grants))
+		case dependency.KindMaterializedView:
+			fmt.Fprintf(&statements, "CREATE MATERIALIZED VIEW %s%s AS\n%s\nWITH NO DATA;\n", dependent.Name, options, definition)
+			if dependent.Owner != "" {
+				fmt.Fprintf(&statements, "ALTER MATERIALIZED VIEW %s OWNER TO %s;\n", dependent.Name, ddl.QuoteIdent(dependent.Owner))
+			}
+			statements.WriteString(grantStatements("TABLE "+dependent.Name, dependent.Grants))
+		case dependency.KindRule:
+			statements.WriteString(definition + ";\n")
+		case dependency.KindFunction:
+			statements.WriteString(definition + ";\n")
+			if dependent.Owner != "" {
+				fmt.Fprintf(&statements, "ALTER ROUTINE %s OWNER TO %s;\n", dependent.Name, ddl.QuoteIdent(dependent.Owner))
+			}
+			// Grants hold the full privileges of the routine, including those PUBLIC gets by default.
+			fmt.Fprintf(&statements, "REVOKE ALL ON ROUTINE %s FROM PUBLIC;\n", dependent.Name)
+			statements.WriteString(grantStatements("ROUTINE "+dependent.Name, dependent.Grants))
+		}
+	}
+	return statements.String()
+}
+
+func (r rebuild) refreshMaterializedViews() string {
+	var statements strings.Builder
+	for _, dependent := range r.recreated() {
+		if dependent.Kind == dependency.KindMaterializedView {
+			fmt.Fprintf(&statements, "REFRESH MATERIALIZED VIEW %s;\n", dependent.Name)
+		}
+	}
+	if statements.Len() == 0 {
+		return ""
+	}
+	return "\n-- Populate the recreated materialized views\n" + statements.String()
+}
+
+// republish moves the publications of the table from table, the name the swap renamed it
+// to, to the table that now carries its name.
+func (r rebuild) republish(table string) string {
+	var statements strings.Builder
+	for _, dependent := range r.dependencies {
+		if dependent.Kind == dependency.KindPublication {
+			fmt.Fprintf(&statements, "ALTER PUBLICATION %s DROP TABLE %s;\n", dependent.Name, table)
+			fmt.Fprintf(&statements, "ALTER PUBLICATION %s ADD TABLE %s;\n", dependent.Name, r.name)
+		}
+	}
+	return statements.String()
+}
+
+// addForeignKey adds a foreign key without checking existing rows, so that it only holds
+// a brief lock; a separate VALIDATE CONSTRAINT checks them.
+func addForeignKey(table string, constraint common.ConstraintInfo) string {
+	definition := constraint.Definition
+	if !notValid(constraint) {
+		definition += " NOT VALID"
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;\n", table, ddl.QuoteIdent(constraint.Name), definition)
+}
+
+func notValid(constraint common.ConstraintInfo) bool {
+	return strings.HasSuffix(constraint.Definition, " NOT VALID")
+}
+
+func indexBacked(constraint common.ConstraintInfo) bool {
+	return constraint.Type == "p" || constraint.Type == "u" || constraint.Type == "x"
+}
+
+// suffixed appends suffix to name, truncating name so that the result stays within the
+// identifier length PostgreSQL keeps.
+func suffixed(name, suffix string) string {
+	for len(name)+len(suffix) > maxIdentifierLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name + suffix
+}
+
+func grantStatements(object string, grants []common.GrantInfo) string {
+	var statements strings.Builder
+	for _, grant := range grants {
+		grantee := "PUBLIC"
+		if grant.Grantee != "" {
+			grantee = ddl.QuoteIdent(grant.Grantee)
+		}
+
+		privilege := grant.Privilege
+		if grant.Column != "" {
+			privilege += " (" + ddl.QuoteIdent(grant.Column) + ")"
+		}
+
+		option := ""
+		if grant.Grantable {
+			option = " WITH GRANT OPTION"
+		}
+		fmt.Fprintf(&statements, "GRANT %s ON %s TO %s%s;\n", privilege, object, grantee, option)
+	}
+	return statements.String()
+}
@@ -0,0 +1,272 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/dependency"
+)
+
+func sampleTable() (common.TableInfo, []common.ColumnInfo) {
+	table := common.TableInfo{
+		Name:        "orders",
+		Owner:       "app",
+		Comment:     "Orders",
+		RowSecurity: true,
+		Constraints: []common.ConstraintInfo{
+			{Name: "orders_pkey", Type: "p", Definition: "PRIMARY KEY (id)", Columns: []string{"id"}},
+			{Name: "orders_total_check", Type: "c", Definition: "CHECK ((total >= (0)::numeric))", Columns: []string{"total"}},
+			{Name: "orders_customer_id_fkey", Type: "f", Definition: "FOREIGN KEY (customer_id) REFERENCES customers(id)", Columns: []string{"customer_id"}},
+			{Name: "orders_parent_id_fkey", Type: "f", Definition: "FOREIGN KEY (parent_id) REFERENCES orders(id)", Columns: []string{"parent_id"}, Table: "public.orders"},
+		},
+		Indexes:   []common.IndexInfo{{Name: "orders_created_at_idx", Definition: "CREATE INDEX orders_created_at_idx ON public.orders USING btree (created_at)"}},
+		Grants:    []common.GrantInfo{{Grantee: "reporting", Privilege: "SELECT"}, {Privilege: "UPDATE", Column: "total", Grantable: true}},
+		Policies:  []common.PolicyInfo{{Name: "own_orders", Permissive: true, Command: "SELECT", Roles: []string{"public"}, Using: "(customer_id = current_setting('app.customer')::integer)"}},
+		Triggers:  []common.TriggerInfo{{Name: "orders_audit", Definition: "CREATE TRIGGER orders_audit AFTER UPDATE ON public.orders FOR EACH ROW EXECUTE FUNCTION audit()"}},
+		Sequences: []common.SequenceInfo{{Name: "public.orders_id_seq", Column: "id", Identity: true}},
+		ReferencedBy: []common.ConstraintInfo{
+			{Name: "line_items_order_id_fkey", Type: "f", Definition: "FOREIGN KEY (order_id) REFERENCES orders(id)", Table: "public.line_items"},
+		},
+	}
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", FormattedType: "bigint", IsNullable: "NO", Identity: "a"},
+		{ColumnName: "created_at", FormattedType: "timestamp with time zone", IsNullable: "NO", Default: "now()"},
+		{ColumnName: "total", FormattedType: "numeric(10,2)", IsNullable: "YES"},
+		{ColumnName: "total_cents", FormattedType: "bigint", IsNullable: "YES", Generated: "s", Default: "((total * (100)::numeric))::bigint"},
+		{ColumnName: "customer_id", FormattedType: "integer", IsNullable: "NO"},
+		{ColumnName: "parent_id", FormattedType: "bigint", IsNullable: "YES"},
+	}
+	return table, columnList
+}
+
+func TestRebuild_Forward(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Rebuild("public", table, columnList, Options{BatchSize: 5000})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	// Statements in the order they have to run.
+	assertInOrder(t, plan.Forward, []string{
+		"CREATE TABLE public.orders_new (\n    id bigint GENERATED ALWAYS AS IDENTITY NOT NULL,",
+		"    CONSTRAINT orders_total_check CHECK ((total >= (0)::numeric))\n);",
+		"COMMENT ON TABLE public.orders_new IS 'Orders';",
+		"ALTER TABLE public.orders_new OWNER TO app;",
+		"-- Copy the data in batches of 5000 rows by primary key",
+		"INSERT INTO public.orders_new (id, created_at, total, customer_id, parent_id) OVERRIDING SYSTEM VALUE\n",
+		"        FROM public.orders\n        ORDER BY id\n        LIMIT 5000\n",
+		"    IF NOT FOUND THEN\n        RETURN;\n    END IF;\n    COMMIT;\n    LOOP\n",
+		"WHERE (id) > (_copy_last_1)",
+		"LIMIT 5000",
+		"CREATE INDEX orders_created_at_idx_new ON public.orders_new USING btree (created_at);",
+		"ALTER TABLE public.orders_new ADD CONSTRAINT orders_pkey_new PRIMARY KEY (id);",
+		"ALTER TABLE public.orders_new ADD CONSTRAINT orders_customer_id_fkey FOREIGN KEY (customer_id) REFERENCES customers(id) NOT VALID;",
+		"ALTER TABLE public.orders_new VALIDATE CONSTRAINT orders_customer_id_fkey;",
+		"GRANT SELECT ON TABLE public.orders_new TO reporting;",
+		"GRANT UPDATE (total) ON TABLE public.orders_new TO PUBLIC WITH GRANT OPTION;",
+		"ALTER TABLE public.orders_new ENABLE ROW LEVEL SECURITY;",
+		"CREATE POLICY own_orders ON public.orders_new AS PERMISSIVE FOR SELECT TO public USING ((customer_id = current_setting('app.customer')::integer));",
+		"BEGIN;\nSET LOCAL lock_timeout = '5s';\nLOCK TABLE public.orders IN ACCESS EXCLUSIVE MODE;",
+		"ALTER TABLE public.orders RENAME TO orders_old;",
+		"ALTER TABLE public.orders_old RENAME CONSTRAINT orders_pkey TO orders_pkey_old;",
+		"ALTER INDEX public.orders_created_at_idx RENAME TO orders_created_at_idx_old;",
+		"ALTER TABLE public.orders_new RENAME TO orders;",
+		"ALTER TABLE public.orders RENAME CONSTRAINT orders_pkey_new TO orders_pkey;",
+		"ALTER INDEX public.orders_created_at_idx_new RENAME TO orders_created_at_idx;",
+		"SELECT setval(pg_get_serial_sequence('public.orders', 'id'), last_value, is_called) FROM public.orders_id_seq;",
+		"ALTER TABLE public.orders ADD CONSTRAINT orders_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES orders(id) NOT VALID;",
+		"ALTER TABLE public.line_items DROP CONSTRAINT line_items_order_id_fkey;",
+		"ALTER TABLE public.line_items ADD CONSTRAINT line_items_order_id_fkey FOREIGN KEY (order_id) REFERENCES orders(id) NOT VALID;",
+		"CREATE TRIGGER orders_audit AFTER UPDATE ON public.orders FOR EACH ROW EXECUTE FUNCTION audit();",
+		"COMMIT;",
+		"ALTER TABLE public.orders VALIDATE CONSTRAINT orders_parent_id_fkey;",
+		"ALTER TABLE public.line_items VALIDATE CONSTRAINT line_items_order_id_fkey;",
+	})
+
+	// Generated columns are computed by the new table, and the self-reference is only
+	// added once the new table has taken the name it points to.
+	assert.NotContains(t, plan.Forward, "INSERT INTO public.orders_new (id, created_at, total, total_cents")
+	assert.NotContains(t, plan.Forward, "DROP CONSTRAINT orders_parent_id_fkey")
+	assert.Equal(t, 1, strings.Count(plan.Forward, "ADD CONSTRAINT orders_parent_id_fkey"))
+}
+
+func TestRebuild_Rollback(t *testing.T) {
+	table, columnList := sampleTable()
+	plan, err := Rebuild("public", table, columnList, Options{LockTimeout: "2s"})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	assertInOrder(t, plan.Rollback, []string{
+		"BEGIN;\nSET LOCAL lock_timeout = '2s';\nLOCK TABLE public.orders, public.orders_old IN ACCESS EXCLUSIVE MODE;",
+		"ALTER TABLE public.line_items DROP CONSTRAINT line_items_order_id_fkey;",
+		"SELECT setval('public.orders_id_seq', max(id)) FROM public.orders HAVING max(id) IS NOT NULL;",
+		"ALTER TABLE public.orders RENAME TO orders_new;",
+		"ALTER TABLE public.orders_new RENAME CONSTRAINT orders_pkey TO orders_pkey_new;",
+		"ALTER INDEX public.orders_created_at_idx RENAME TO orders_created_at_idx_new;",
+		"ALTER TABLE public.orders_old RENAME TO orders;",
+		"ALTER TABLE public.orders RENAME CONSTRAINT orders_pkey_old TO orders_pkey;",
+		"ALTER INDEX public.orders_created_at_idx_old RENAME TO orders_created_at_idx;",
+		"ALTER TABLE public.line_items ADD CONSTRAINT line_items_order_id_fkey FOREIGN KEY (order_id) REFERENCES orders(id) NOT VALID;",
+		"COMMIT;",
+		"ALTER TABLE public.line_items VALIDATE CONSTRAINT line_items_order_id_fkey;",
+		"DROP TABLE public.orders_new;",
+	})
+	assert.NotContains(t, plan.Rollback, "orders_parent_id_fkey")
+}
+
+func TestRebuild_SerialSequence(t *testing.T) {
+	table := common.TableInfo{
+		Name:        "tags",
+		Constraints: []common.ConstraintInfo{{Name: "tags_pkey", Type: "p", Definition: "PRIMARY KEY (id)", Columns: []string{"id"}}},
+		Sequences:   []common.SequenceInfo{{Name: "public.tags_id_seq", Column: "id"}},
+	}
+	columnList := []common.ColumnInfo{{ColumnName: "id", FormattedType: "integer", IsNullable: "NO", Default: "nextval('tags_id_seq'::regclass)"}}
+
+	plan, err := Rebuild("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	assert.Contains(t, plan.Forward, "id integer DEFAULT nextval('tags_id_seq'::regclass) NOT NULL")
+	assert.Contains(t, plan.Forward, "INSERT INTO public.tags_new (id)\n")
+	assert.Contains(t, plan.Forward, "LIMIT 10000\n")
+	assertInOrder(t, plan.Forward, []string{"ALTER TABLE public.tags_new RENAME TO tags;", "ALTER SEQUENCE public.tags_id_seq OWNED BY public.tags.id;", "COMMIT;"})
+	assertInOrder(t, plan.Rollback, []string{"ALTER TABLE public.tags_old RENAME TO tags;", "ALTER SEQUENCE public.tags_id_seq OWNED BY public.tags.id;", "COMMIT;", "DROP TABLE public.tags_new;"})
+}
+
+func TestRebuild_CompositeKey(t *testing.T) {
+	table := common.TableInfo{
+		Name:        "line_items",
+		Constraints: []common.ConstraintInfo{{Name: "line_items_pkey", Type: "p", Definition: "PRIMARY KEY (order_id, line)", Columns: []string{"order_id", "line"}}},
+	}
+	columnList := []common.ColumnInfo{
+		{ColumnName: "line", FormattedType: "smallint", IsNullable: "NO"},
+		{ColumnName: "order_id", FormattedType: "bigint", IsNullable: "NO"},
+	}
+
+	plan, err := Rebuild("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	assert.Contains(t, plan.Forward, "    _copy_last_1 bigint;\n    _copy_last_2 smallint;\n")
+	assert.Contains(t, plan.Forward, "        FROM public.line_items\n        ORDER BY order_id, line\n")
+	assert.Contains(t, plan.Forward, "WHERE (order_id, line) > (_copy_last_1, _copy_last_2)\n            ORDER BY order_id, line\n")
+	assert.Contains(t, plan.Forward, "SELECT order_id, line INTO _copy_last_1, _copy_last_2\n        FROM batch\n        ORDER BY order_id DESC, line DESC\n")
+}
+
+func TestRebuild_NoPrimaryKey(t *testing.T) {
+	table := common.TableInfo{Name: "events"}
+	columnList := []common.ColumnInfo{{ColumnName: "payload", FormattedType: "jsonb", IsNullable: "YES"}}
+
+	plan, err := Rebuild("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	assert.Contains(t, plan.Forward, "-- Copy the data in a single statement, as public.events has no primary key to batch by\nINSERT INTO public.events_new (payload) SELECT payload FROM public.events;\n")
+	assert.NotContains(t, plan.Forward, "DO $copy$")
+}
+
+func TestRebuild_UnexpectedIndexDefinition(t *testing.T) {
+	table := common.TableInfo{
+		Name:    "events",
+		Indexes: []common.IndexInfo{{Name: "events_idx", Definition: "CREATE INDEX events_idx ON other.events USING btree (id)"}},
+	}
+	columnList := []common.ColumnInfo{{ColumnName: "id", FormattedType: "integer", IsNullable: "NO"}}
+
+	if _, err := Rebuild("public", table, columnList, Options{}); err == nil {
+		t.Errorf("Expected an error for an index that cannot be retargeted")
+	}
+}
+
+func TestRebuild_Dependencies(t *testing.T) {
+	table := common.TableInfo{
+		Name:        "tags",
+		Constraints: []common.ConstraintInfo{{Name: "tags_pkey", Type: "p", Definition: "PRIMARY KEY (id)", Columns: []string{"id"}}},
+		Dependencies: []common.DependencyInfo{
+			{Kind: dependency.KindView, Name: "public.popular_tags", Definition: " SELECT tags.id,\n    tags.name\n   FROM tags;", Owner: "app", Depth: 1,
+				Grants: []common.GrantInfo{{Grantee: "reporting", Privilege: "SELECT"}}},
+			{Kind: dependency.KindMaterializedView, Name: "public.tag_counts", Definition: " SELECT count(*) AS count\n   FROM popular_tags;", Depth: 2},
+			{Kind: dependency.KindFunction, Name: "public.all_tags()", Definition: "CREATE OR REPLACE FUNCTION public.all_tags()\n RETURNS SETOF tags\n LANGUAGE sql\nBEGIN ATOMIC\n SELECT tags.id, tags.name FROM tags;\nEND\n",
+				Grants: []common.GrantInfo{{Grantee: "app", Privilege: "EXECUTE"}}},
+			{Kind: dependency.KindPublication, Name: "tags_pub"},
+		},
+	}
+	columnList := []common.ColumnInfo{
+		{ColumnName: "id", FormattedType: "integer", IsNullable: "NO"},
+		{ColumnName: "name", FormattedType: "text", IsNullable: "NO"},
+	}
+
+	plan, err := Rebuild("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+
+	assertInOrder(t, plan.Forward, []string{
+		"--   recreate  view public.popular_tags\n",
+		"--   retarget  publication tags_pub\n",
+		"LOCK TABLE public.tags IN ACCESS EXCLUSIVE MODE;",
+		"DROP MATERIALIZED VIEW public.tag_counts;\nDROP VIEW public.popular_tags;\nDROP ROUTINE public.all_tags();",
+		"ALTER TABLE public.tags RENAME TO tags_old;",
+		"ALTER TABLE public.tags_new RENAME TO tags;",
+		"ALTER PUBLICATION tags_pub DROP TABLE public.tags_old;\nALTER PUBLICATION tags_pub ADD TABLE public.tags;",
+		"CREATE OR REPLACE FUNCTION public.all_tags()\n RETURNS SETOF tags\n LANGUAGE sql\nBEGIN ATOMIC\n SELECT tags.id, tags.name FROM tags;\nEND;",
+		"REVOKE ALL ON ROUTINE public.all_tags() FROM PUBLIC;\nGRANT EXECUTE ON ROUTINE public.all_tags() TO app;",
+		"CREATE VIEW public.popular_tags AS\nSELECT tags.id,\n    tags.name\n   FROM tags;",
+		"ALTER VIEW public.popular_tags OWNER TO app;\nGRANT SELECT ON TABLE public.popular_tags TO reporting;",
+		"CREATE MATERIALIZED VIEW public.tag_counts AS\nSELECT count(*) AS count\n   FROM popular_tags\nWITH NO DATA;",
+		"COMMIT;",
+		"REFRESH MATERIALIZED VIEW public.tag_counts;",
+	})
+
+	assertInOrder(t, plan.Rollback, []string{
+		"DROP MATERIALIZED VIEW public.tag_counts;",
+		"ALTER TABLE public.tags RENAME TO tags_new;",
+		"ALTER TABLE public.tags_old RENAME TO tags;",
+		"ALTER PUBLICATION tags_pub DROP TABLE public.tags_new;\nALTER PUBLICATION tags_pub ADD TABLE public.tags;",
+		"CREATE VIEW public.popular_tags AS",
+		"COMMIT;",
+		"REFRESH MATERIALIZED VIEW public.tag_counts;",
+		"DROP TABLE public.tags_new;",
+	})
+}
+
+func TestRebuild_BlockingDependency(t *testing.T) {
+	table := common.TableInfo{
+		Name:         "events",
+		Dependencies: []common.DependencyInfo{{Kind: dependency.KindInheritanceChild, Name: "public.events_archive"}},
+	}
+	columnList := []common.ColumnInfo{{ColumnName: "payload", FormattedType: "jsonb", IsNullable: "YES"}}
+
+	_, err := Rebuild("public", table, columnList, Options{})
+	assert.ErrorContains(t, err, "inheritance child public.events_archive")
+}
+
+func TestSuffixed(t *testing.T) {
+	assert.Equal(t, "orders_new", suffixed("orders", newSuffix))
+
+	long := strings.Repeat("a", 62)
+	assert.Equal(t, strings.Repeat("a", 59)+"_new", suffixed(long, newSuffix))
+
+	accented := strings.Repeat("a", 58) + "é"
+	assert.Equal(t, strings.Repeat("a", 58)+"_new", suffixed(accented, newSuffix))
+}
+
+func assertInOrder(t *testing.T, script string, statements []string) {
+	t.Helper()
+
+	from := 0
+	for _, statement := range statements {
+		at := strings.Index(script[from:], statement)
+		if at == -1 {
+			t.Errorf("Expected %q after offset %d in:\n%s", statement, from, script)
+			return
+		}
+		from += at + len(statement)
+	}
+}
@@ -0,0 +1,234 @@
+package migration
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	flywayVersioned  = regexp.MustCompile(`^V(\d+(?:[._]\d+)*)__.+\.sql$`)
+	flywayRepeatable = regexp.MustCompile(`^R__.+\.sql$`)
+	sqitchTag        = regexp.MustCompile(`^@(\S+)`)
+)
+
+// DetectFramework tells the framework whose migrations dir holds by their file names.
+func DetectFramework(dir fs.FS) (Framework, error) {
+	if _, err := fs.Stat(dir, sqitchPlan); err == nil {
+		return Sqitch, nil
+	}
+	names, err := fileNames(dir)
+	if err != nil {
+		return "", err
+	}
+
+	// golang-migrate files match the goose pattern too, so they are looked for first.
+	for _, candidate := range []struct {
+		framework Framework
+		pattern   *regexp.Regexp
+	}{
+		{GolangMigrate, golangMigrateFile},
+		{Flyway, flywayVersioned},
+		{Goose, gooseFile},
+	} {
+		for _, name := range names {
+			if candidate.pattern.MatchString(name) {
+				return candidate.framework, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("found no goose, golang-migrate, Flyway or sqitch migrations")
+}
+
+// Migrations returns the scripts that migrate a schema forward, in the order framework
+// applies them: goose and golang-migrate files by version, with the Up section of goose
+// files, Flyway versioned migrations by version followed by its repeatable ones by name,
+// and sqitch deploy scripts in the order of sqitch.plan. Goose migrations written in Go
+// cannot be read and are returned as skipped.
+func Migrations(framework Framework, dir fs.FS) ([]File, []string, error) {
+	if framework == Sqitch {
+		files, err := sqitchDeployScripts(dir)
+		return files, nil, err
+	}
+
+	names, err := fileNames(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files, skipped []string
+	switch framework {
+	case Goose:
+		files = byVersion(names, gooseFile)
+	case GolangMigrate:
+		for _, name := range byVersion(names, golangMigrateFile) {
+			if strings.HasSuffix(name, ".up.sql") {
+				files = append(files, name)
+			}
+		}
+	case Flyway:
+		files = byVersion(names, flywayVersioned)
+		for _, name := range names {
+			if flywayRepeatable.MatchString(name) {
+				files = append(files, name)
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported migration framework %q", framework)
+	}
+
+	var migrations []File
+	for _, name := range files {
+		if framework == Goose && strings.HasSuffix(name, ".go") {
+			skipped = append(skipped, name)
+			continue
+		}
+		content, err := fs.ReadFile(dir, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		script := string(content)
+		if framework == Goose {
+			if script, err = gooseUp(script); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		migrations = append(migrations, File{Path: name, Content: script})
+	}
+	return migrations, skipped, nil
+}
+
+// fileNames lists the files of dir in name order.
+func fileNames(dir fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// byVersion returns the names that match pattern, whose first group is the version, in
+// version order. Versions are compared part by part as numbers, so 1.10 follows 1.9.
+func byVersion(names []string, pattern *regexp.Regexp) []string {
+	type versioned struct {
+		name    string
+		version []uint64
+	}
+	var matches []versioned
+	for _, name := range names {
+		match := pattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		var version []uint64
+		for _, part := range strings.FieldsFunc(match[1], func(r rune) bool { return r == '.' || r == '_' }) {
+			number, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				break
+			}
+			version = append(version, number)
+		}
+		matches = append(matches, versioned{name: name, version: version})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i].version, matches[j].version
+		for k := 0; k < max(len(a), len(b)); k++ {
+			var x, y uint64
+			if k < len(a) {
+				x = a[k]
+			}
+			if k < len(b) {
+				y = b[k]
+			}
+			if x != y {
+				return x < y
+			}
+		}
+		return false
+	})
+
+	sorted := make([]string, len(matches))
+	for i, match := range matches {
+		sorted[i] = match.name
+	}
+	return sorted
+}
+
+// gooseUp returns the Up section of a goose SQL migration.
+func gooseUp(script string) (string, error) {
+	var up strings.Builder
+	found, inUp := false, false
+	for _, line := range strings.SplitAfter(script, "\n") {
+		switch annotation := strings.TrimSpace(line); {
+		case strings.HasPrefix(annotation, "-- +goose Up"):
+			found, inUp = true, true
+		case strings.HasPrefix(annotation, "-- +goose Down"):
+			inUp = false
+		case inUp:
+			up.WriteString(line)
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("no -- +goose Up annotation")
+	}
+	return up.String(), nil
+}
+
+// sqitchDeployScripts returns the deploy scripts of the changes in sqitch.plan. A change
+// that was reworked appears in the plan more than once; its earlier versions are deployed
+// from the scripts sqitch kept under the first tag that follows them.
+func sqitchDeployScripts(dir fs.FS) ([]File, error) {
+	content, err := fs.ReadFile(dir, sqitchPlan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sqitchPlan, err)
+	}
+
+	type change struct {
+		name string
+		tag  string
+	}
+	var changes []change
+	latest := make(map[string]int)
+	for _, line := range strings.Split(string(content), "\n") {
+		if match := sqitchTag.FindStringSubmatch(line); match != nil {
+			for i := len(changes) - 1; i >= 0 && changes[i].tag == ""; i-- {
+				changes[i].tag = match[1]
+			}
+			continue
+		}
+		if match := sqitchChange.FindStringSubmatch(line); match != nil {
+			latest[match[1]] = len(changes)
+			changes = append(changes, change{name: match[1]})
+		}
+	}
+
+	var files []File
+	for i, change := range changes {
+		script := change.name + ".sql"
+		if latest[change.name] != i {
+			if change.tag == "" {
+				return nil, fmt.Errorf("%s reworks change %s without a tag in between", sqitchPlan, change.name)
+			}
+			script = change.name + "@" + change.tag + ".sql"
+		}
+		script = path.Join("deploy", script)
+
+		content, err := fs.ReadFile(dir, script)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", script, err)
+		}
+		files = append(files, File{Path: script, Content: string(content)})
+	}
+	return files, nil
+}
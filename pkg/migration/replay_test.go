@@ -0,0 +1,91 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFramework(t *testing.T) {
+	for expected, dir := range map[Framework]fstest.MapFS{
+		Goose:         {"00001_init.sql": {}},
+		GolangMigrate: {"1_init.up.sql": {}, "1_init.down.sql": {}},
+		Flyway:        {"V1__init.sql": {}},
+		Sqitch:        {"sqitch.plan": {}, "deploy/init.sql": {}},
+	} {
+		framework, err := DetectFramework(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, framework)
+	}
+
+	_, err := DetectFramework(fstest.MapFS{"schema.sql": {}})
+	assert.Error(t, err)
+}
+
+func TestMigrations_Goose(t *testing.T) {
+	dir := fstest.MapFS{
+		"00010_add_note.sql": {Data: []byte("-- +goose Up\nALTER TABLE t ADD COLUMN note text;\n-- +goose Down\nALTER TABLE t DROP COLUMN note;\n")},
+		"00002_init.sql":     {Data: []byte("-- +goose Up\n-- +goose StatementBegin\nCREATE TABLE t (id int);\n-- +goose StatementEnd\n\n-- +goose Down\nDROP TABLE t;\n")},
+		"00003_backfill.go":  {},
+		"README.md":          {},
+	}
+
+	files, skipped, err := Migrations(Goose, dir)
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	assert.Equal(t, []File{
+		{Path: "00002_init.sql", Content: "-- +goose StatementBegin\nCREATE TABLE t (id int);\n-- +goose StatementEnd\n\n"},
+		{Path: "00010_add_note.sql", Content: "ALTER TABLE t ADD COLUMN note text;\n"},
+	}, files)
+	assert.Equal(t, []string{"00003_backfill.go"}, skipped)
+
+	_, _, err = Migrations(Goose, fstest.MapFS{"00001_init.sql": {Data: []byte("CREATE TABLE t (id int);\n")}})
+	assert.EqualError(t, err, "00001_init.sql: no -- +goose Up annotation")
+}
+
+func TestMigrations_GolangMigrateAndFlyway(t *testing.T) {
+	files, _, err := Migrations(GolangMigrate, fstest.MapFS{
+		"2_b.up.sql": {}, "2_b.down.sql": {}, "10_c.up.sql": {}, "1_a.up.sql": {}, "1_a.down.sql": {},
+	})
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	assert.Equal(t, []string{"1_a.up.sql", "2_b.up.sql", "10_c.up.sql"}, paths(files))
+
+	files, _, err = Migrations(Flyway, fstest.MapFS{
+		"R__views.sql": {}, "V1.10__c.sql": {}, "V1.9__b.sql": {}, "V1__a.sql": {}, "U1.9__b.sql": {}, "V1.9__b.sql.conf": {},
+	})
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	assert.Equal(t, []string{"V1__a.sql", "V1.9__b.sql", "V1.10__c.sql", "R__views.sql"}, paths(files))
+}
+
+func TestMigrations_Sqitch(t *testing.T) {
+	dir := fstest.MapFS{
+		"sqitch.plan": {Data: []byte("%syntax-version=1.0.0\n%project=shop\n\n" +
+			"orders 2024-01-01T00:00:00Z Ann <ann@example.com> # Orders\n" +
+			"items [orders] 2024-01-02T00:00:00Z Ann <ann@example.com> # Items\n" +
+			"@v1.0 2024-01-03T00:00:00Z Ann <ann@example.com> # Tag\n\n" +
+			"orders [orders@v1.0] 2024-02-01T00:00:00Z Ann <ann@example.com> # Rework orders\n")},
+		"deploy/orders@v1.0.sql": {Data: []byte("CREATE TABLE orders (id int);\n")},
+		"deploy/items.sql":       {Data: []byte("CREATE TABLE items (id int);\n")},
+		"deploy/orders.sql":      {Data: []byte("ALTER TABLE orders ADD COLUMN note text;\n")},
+	}
+
+	files, _, err := Migrations(Sqitch, dir)
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	assert.Equal(t, []string{"deploy/orders@v1.0.sql", "deploy/items.sql", "deploy/orders.sql"}, paths(files))
+}
+
+func paths(files []File) []string {
+	result := make([]string, len(files))
+	for i, file := range files {
+		result[i] = file.Path
+	}
+	return result
+}
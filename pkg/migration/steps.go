@@ -0,0 +1,143 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"main/pkg/common"
+	"main/pkg/ddl"
+)
+
+// Steps is a rebuild split into statements that a client runs one at a time, copying and
+// checking the rows batch by batch itself rather than in a DO block.
+//
+// Copy inserts the batch after the key given as its parameters and returns the number of
+// rows copied, their checksum and the last key copied as text. SourceChecksum and
+// TargetChecksum take the key a batch starts after followed by its last key, and return
+// the number of rows in that range and their checksum. The first batch has no key to
+// start after, and leaves those parameters out.
+type Steps struct {
+	Table     string
+	NewTable  string
+	Progress  string
+	KeyLength int
+
+	Prepare        string
+	Copy           BatchStatement
+	SourceChecksum BatchStatement
+	TargetChecksum BatchStatement
+	Build          string
+	Swap           string
+	AfterSwap      string
+	Rollback       string
+}
+
+// BatchStatement is a statement run for every batch, written apart for the first batch so
+// that the one for the batches after it is a range scan of the key even as a generic plan.
+type BatchStatement struct {
+	First string
+	Next  string
+}
+
+// For returns the statement for the batch after the key after, nil for the first batch.
+func (s BatchStatement) For(after []string) string {
+	if after == nil {
+		return s.First
+	}
+	return s.Next
+}
+
+// NewSteps plans the rebuild of a table with its columns in the order of columnList as
+// steps. The table needs a primary key to copy it by.
+func NewSteps(schemaName string, table common.TableInfo, columnList []common.ColumnInfo, options Options) (Steps, error) {
+	r, err := newRebuild(schemaName, table, columnList, options)
+	if err != nil {
+		return Steps{}, err
+	}
+
+	key := r.primaryKey()
+	if key == nil {
+		return Steps{}, fmt.Errorf("table %s needs a primary key to be copied in batches", table.Name)
+	}
+
+	var prepare strings.Builder
+	prepare.WriteString(r.createTable())
+	if r.table.Owner != "" {
+		fmt.Fprintf(&prepare, "ALTER TABLE %s OWNER TO %s;\n", r.newTable, ddl.QuoteIdent(r.table.Owner))
+	}
+
+	build, err := r.buildIndexes(true)
+	if err != nil {
+		return Steps{}, err
+	}
+
+	columns, overriding := r.copiedColumns()
+	columnNames := strings.Join(columns, ", ")
+	row := "row(" + columnNames + ")::text"
+
+	keyColumns := make([]string, len(key))
+	descending := make([]string, len(key))
+	after := make([]string, len(key))
+	upTo := make([]string, len(key))
+	for i, col := range key {
+		keyColumns[i] = ddl.QuoteIdent(col.ColumnName)
+		descending[i] = keyColumns[i] + " DESC"
+		after[i] = fmt.Sprintf("$%d::%s", i+1, col.FormattedType)
+		upTo[i] = fmt.Sprintf("$%d::%s", len(key)+i+1, col.FormattedType)
+	}
+	keyList := strings.Join(keyColumns, ", ")
+	afterKey := fmt.Sprintf("(%s) > (%s)", keyList, strings.Join(after, ", "))
+	checksum := fmt.Sprintf("COALESCE(md5(string_agg(%s, E'\\n' ORDER BY %s)), '')", row, keyList)
+
+	lastKey := make([]string, len(key))
+	for i, column := range keyColumns {
+		lastKey[i] = fmt.Sprintf("(array_agg(%s::text ORDER BY %s))[1]", column, strings.Join(descending, ", "))
+	}
+
+	copyBatch := func(where string) string {
+		var copyBatch strings.Builder
+		copyBatch.WriteString("WITH batch AS (\n")
+		fmt.Fprintf(&copyBatch, "    INSERT INTO %s (%s) %s\n", r.newTable, columnNames, strings.TrimSpace(overriding))
+		fmt.Fprintf(&copyBatch, "    SELECT %s\n", columnNames)
+		fmt.Fprintf(&copyBatch, "    FROM %s\n", r.name)
+		if where != "" {
+			fmt.Fprintf(&copyBatch, "    WHERE %s\n", where)
+		}
+		fmt.Fprintf(&copyBatch, "    ORDER BY %s\n", keyList)
+		fmt.Fprintf(&copyBatch, "    LIMIT %d\n", r.options.BatchSize)
+		fmt.Fprintf(&copyBatch, "    RETURNING %s\n", columnNames)
+		copyBatch.WriteString(")\n")
+		fmt.Fprintf(&copyBatch, "SELECT count(*), %s, %s\n", checksum, strings.Join(lastKey, ", "))
+		copyBatch.WriteString("FROM batch")
+		return strings.ReplaceAll(copyBatch.String(), " \n", "\n")
+	}
+
+	// The checksum of the first batch takes its last key as its only parameters.
+	rangeChecksum := func(table string) BatchStatement {
+		return BatchStatement{
+			First: fmt.Sprintf("SELECT count(*), %s\nFROM %s\nWHERE (%s) <= (%s)", checksum, table, keyList, strings.Join(after, ", ")),
+			Next:  fmt.Sprintf("SELECT count(*), %s\nFROM %s\nWHERE %s\n    AND (%s) <= (%s)", checksum, table, afterKey, keyList, strings.Join(upTo, ", ")),
+		}
+	}
+
+	return Steps{
+		Table:     r.name,
+		NewTable:  r.newTable,
+		Progress:  ProgressTable(schemaName, table.Name),
+		KeyLength: len(key),
+
+		Prepare:        prepare.String(),
+		Copy:           BatchStatement{First: copyBatch(""), Next: copyBatch(afterKey)},
+		SourceChecksum: rangeChecksum(r.name),
+		TargetChecksum: rangeChecksum(r.newTable),
+		Build:          build + r.grants() + r.rowSecurity(),
+		Swap:           r.swapStatements(""),
+		AfterSwap:      r.afterSwap(),
+		Rollback:       r.rollback("-- If the swap has not run, only the final DROP TABLE is needed.\n", ""),
+	}, nil
+}
+
+// ProgressTable names the table a rebuild of tableName records its progress in.
+func ProgressTable(schemaName, tableName string) string {
+	return ddl.QualifiedName(schemaName, suffixed(tableName, progressSuffix))
+}
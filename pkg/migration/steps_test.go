@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+func TestNewSteps(t *testing.T) {
+	table, columnList := sampleTable()
+	steps, err := NewSteps("public", table, columnList, Options{BatchSize: 1000})
+	if err != nil {
+		t.Fatalf("NewSteps failed: %v", err)
+	}
+
+	assert.Equal(t, "public.orders", steps.Table)
+	assert.Equal(t, "public.orders_new", steps.NewTable)
+	assert.Equal(t, "public.orders_progress", steps.Progress)
+	assert.Equal(t, 1, steps.KeyLength)
+
+	assertInOrder(t, steps.Prepare, []string{"CREATE TABLE public.orders_new (", "ALTER TABLE public.orders_new OWNER TO app;"})
+	assert.Equal(t, `WITH batch AS (
+    INSERT INTO public.orders_new (id, created_at, total, customer_id, parent_id) OVERRIDING SYSTEM VALUE
+    SELECT id, created_at, total, customer_id, parent_id
+    FROM public.orders
+    ORDER BY id
+    LIMIT 1000
+    RETURNING id, created_at, total, customer_id, parent_id
+)
+SELECT count(*), COALESCE(md5(string_agg(row(id, created_at, total, customer_id, parent_id)::text, E'\n' ORDER BY id)), ''), (array_agg(id::text ORDER BY id DESC))[1]
+FROM batch`, steps.Copy.First)
+	assert.Contains(t, steps.Copy.Next, "    FROM public.orders\n    WHERE (id) > ($1::bigint)\n    ORDER BY id\n")
+	assert.Equal(t, `SELECT count(*), COALESCE(md5(string_agg(row(id, created_at, total, customer_id, parent_id)::text, E'\n' ORDER BY id)), '')
+FROM public.orders_new
+WHERE (id) <= ($1::bigint)`, steps.TargetChecksum.First)
+	assert.Equal(t, `SELECT count(*), COALESCE(md5(string_agg(row(id, created_at, total, customer_id, parent_id)::text, E'\n' ORDER BY id)), '')
+FROM public.orders_new
+WHERE (id) > ($1::bigint)
+    AND (id) <= ($2::bigint)`, steps.TargetChecksum.Next)
+
+	assertInOrder(t, steps.Build, []string{
+		"CREATE INDEX orders_created_at_idx_new ON public.orders_new USING btree (created_at);",
+		"ALTER TABLE public.orders_new ADD CONSTRAINT orders_pkey_new PRIMARY KEY (id);",
+		"GRANT SELECT ON TABLE public.orders_new TO reporting;",
+	})
+	assertInOrder(t, steps.Swap, []string{
+		"SET LOCAL lock_timeout = '5s';\nLOCK TABLE public.orders IN ACCESS EXCLUSIVE MODE;",
+		"ALTER TABLE public.orders_new RENAME TO orders;",
+		"CREATE TRIGGER orders_audit",
+	})
+	assert.NotContains(t, steps.Swap, "BEGIN;")
+	assert.NotContains(t, steps.Swap, "COMMIT;")
+	assert.Contains(t, steps.AfterSwap, "ALTER TABLE public.line_items VALIDATE CONSTRAINT line_items_order_id_fkey;")
+	assert.Contains(t, steps.Rollback, "ALTER TABLE public.orders_old RENAME TO orders;")
+}
+
+func TestNewSteps_CompositeKey(t *testing.T) {
+	table := common.TableInfo{
+		Name:        "line_items",
+		Constraints: []common.ConstraintInfo{{Name: "line_items_pkey", Type: "p", Definition: "PRIMARY KEY (order_id, line)", Columns: []string{"order_id", "line"}}},
+	}
+	columnList := []common.ColumnInfo{
+		{ColumnName: "order_id", FormattedType: "bigint", IsNullable: "NO"},
+		{ColumnName: "line", FormattedType: "integer", IsNullable: "NO"},
+	}
+
+	steps, err := NewSteps("public", table, columnList, Options{})
+	if err != nil {
+		t.Fatalf("NewSteps failed: %v", err)
+	}
+
+	assert.Equal(t, 2, steps.KeyLength)
+	assert.NotContains(t, steps.Copy.First, "WHERE")
+	assert.Contains(t, steps.Copy.Next, "WHERE (order_id, line) > ($1::bigint, $2::integer)")
+	assert.Contains(t, steps.Copy.Next, "(array_agg(order_id::text ORDER BY order_id DESC, line DESC))[1], (array_agg(line::text ORDER BY order_id DESC, line DESC))[1]")
+	assert.Contains(t, steps.SourceChecksum.First, "WHERE (order_id, line) <= ($1::bigint, $2::integer)")
+	assert.Contains(t, steps.SourceChecksum.Next, "AND (order_id, line) <= ($3::bigint, $4::integer)")
+}
+
+func TestNewSteps_NoPrimaryKey(t *testing.T) {
+	_, err := NewSteps("public", common.TableInfo{Name: "events"}, []common.ColumnInfo{{ColumnName: "payload", FormattedType: "jsonb"}}, Options{})
+	assert.EqualError(t, err, "table events needs a primary key to be copied in batches")
+}
@@ -0,0 +1,165 @@
+package pgdump
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"main/pkg/ddl"
+)
+
+// Magic starts every pg_dump archive.
+const Magic = "PGDMP"
+
+const (
+	formatCustom = 1
+
+	// Archive versions are MAKE_ARCHIVE_VERSION(major, minor, revision) of pg_backup_archiver.h.
+	version1_10 = 1<<16 | 10<<8
+	version1_11 = 1<<16 | 11<<8
+	version1_14 = 1<<16 | 14<<8
+	version1_15 = 1<<16 | 15<<8
+	version1_16 = 1<<16 | 16<<8
+
+	// The pg_compress_algorithm values; custom archives write gzip data as zlib streams.
+	compressionNone = 0
+	compressionGzip = 1
+)
+
+var compressionNames = map[int]string{compressionNone: "none", compressionGzip: "gzip", 2: "lz4", 3: "zstd"}
+
+// Entry is an entry of the archive's table of contents.
+type Entry struct {
+	DumpID    int
+	Tag       string
+	Desc      string
+	Namespace string
+	Owner     string
+	// Definition is the SQL that creates the object, empty for data entries.
+	Definition string
+	// CopyStatement is the COPY a TABLE DATA entry restores its data with, empty when the
+	// data was dumped as INSERT statements.
+	CopyStatement string
+}
+
+// Archive is a pg_dump custom-format archive, read up to the end of its table of
+// contents. The data blocks that follow can be read once with Data.
+type Archive struct {
+	Version     string
+	Database    string
+	Compression string
+	Entries     []Entry
+
+	reader      *bufio.Reader
+	err         error
+	version     int
+	intSize     int
+	offSize     int
+	compression int
+}
+
+// Read reads the header and the table of contents of a custom-format archive, as
+// pg_dump -Fc writes it.
+func Read(r io.Reader) (*Archive, error) {
+	a := &Archive{reader: bufio.NewReader(r)}
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(a.reader, magic); err != nil || string(magic) != Magic {
+		return nil, errors.New("not a pg_dump archive")
+	}
+
+	major, minor, revision := a.byte(), a.byte(), 0
+	if major > 1 || (major == 1 && minor > 0) {
+		revision = a.byte()
+	}
+	a.version = major<<16 | minor<<8 | revision
+	a.Version = fmt.Sprintf("%d.%d-%d", major, minor, revision)
+	if a.version < version1_10 {
+		return nil, fmt.Errorf("archive version %s is older than pg_dump 8.4 and not supported", a.Version)
+	}
+
+	a.intSize, a.offSize = a.byte(), a.byte()
+	format := a.byte()
+	if a.err != nil {
+		return nil, fmt.Errorf("failed to read archive header: %w", a.err)
+	}
+	if format != formatCustom {
+		return nil, fmt.Errorf("archive format %d is not the custom format, only pg_dump -Fc archives can be read", format)
+	}
+	if a.version >= version1_15 {
+		a.compression = a.byte()
+	} else if a.int() != 0 {
+		// Before 1.15 the header holds the compression level, and any level means zlib.
+		a.compression = compressionGzip
+	}
+	a.Compression = compressionNames[a.compression]
+
+	// The creation time is seven ints of a struct tm.
+	for i := 0; i < 7; i++ {
+		a.int()
+	}
+	a.Database = a.str()
+	a.str() // server version
+	a.str() // pg_dump version
+
+	count := a.int()
+	for i := 0; i < count; i++ {
+		entry := Entry{DumpID: a.int()}
+		a.int() // hadDumper
+		a.str() // catalog table OID
+		a.str() // OID
+		entry.Tag = a.str()
+		entry.Desc = a.str()
+		if a.version >= version1_11 {
+			a.int() // section
+		}
+		entry.Definition = a.str()
+		a.str() // drop statement
+		entry.CopyStatement = a.str()
+		entry.Namespace = a.str()
+		a.str() // tablespace
+		if a.version >= version1_14 {
+			a.str() // table access method
+		}
+		if a.version >= version1_16 {
+			a.int() // relkind
+		}
+		entry.Owner = a.str()
+		a.str() // WITH OIDS
+		for a.nullableStr() != nil {
+			// Dependencies, up to a NULL string.
+		}
+		a.offset() // data position
+		if a.err != nil {
+			break
+		}
+		a.Entries = append(a.Entries, entry)
+	}
+
+	if a.err != nil {
+		return nil, fmt.Errorf("failed to read table of contents: %w", a.err)
+	}
+	return a, nil
+}
+
+// Schema returns the definitions of the archive's entries in table of contents order, as
+// pg_restore --schema-only prints them. Each is preceded by the search path pg_restore
+// sets for it, which archives of older pg_dump versions need for unqualified names.
+func (a *Archive) Schema() string {
+	var schema strings.Builder
+	for _, entry := range a.Entries {
+		if entry.Definition == "" {
+			continue
+		}
+		if entry.Namespace != "" {
+			fmt.Fprintf(&schema, "SET search_path = %s, pg_catalog;\n", ddl.QuoteIdent(entry.Namespace))
+		}
+		schema.WriteString(entry.Definition)
+		if !strings.HasSuffix(entry.Definition, "\n") {
+			schema.WriteString("\n")
+		}
+	}
+	return schema.String()
+}
@@ -0,0 +1,179 @@
+package pgdump
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// archiveWriter writes an archive as WriteHead, WriteToc and the custom format's data
+// blocks lay it out, with 4-byte ints and 8-byte offsets.
+type archiveWriter struct {
+	bytes.Buffer
+}
+
+func (w *archiveWriter) int(value int) {
+	if value < 0 {
+		w.WriteByte(1)
+		value = -value
+	} else {
+		w.WriteByte(0)
+	}
+	for i := 0; i < 4; i++ {
+		w.WriteByte(byte(value >> (8 * i)))
+	}
+}
+
+func (w *archiveWriter) str(value string) {
+	w.int(len(value))
+	w.WriteString(value)
+}
+
+func (w *archiveWriter) null() {
+	w.int(-1)
+}
+
+type testEntry struct {
+	id                                  int
+	tag, desc, namespace, defn, copyStm string
+}
+
+func writeArchive(t *testing.T, minor int, compression int, entries []testEntry, data map[int]string) []byte {
+	w := &archiveWriter{}
+	w.WriteString(Magic)
+	w.Write([]byte{1, byte(minor), 0, 4, 8, formatCustom})
+	if minor >= 15 {
+		w.WriteByte(byte(compression))
+	} else {
+		w.int(compression)
+	}
+	for _, value := range []int{0, 30, 12, 1, 2, 124, 0} {
+		w.int(value)
+	}
+	w.str("shop")
+	w.str("16.2")
+	w.str("16.2")
+
+	w.int(len(entries))
+	for _, entry := range entries {
+		w.int(entry.id)
+		w.int(1)
+		w.str("1259")
+		w.str("16384")
+		w.str(entry.tag)
+		w.str(entry.desc)
+		w.int(2)
+		w.str(entry.defn)
+		w.str("")
+		w.str(entry.copyStm)
+		w.str(entry.namespace)
+		w.str("")
+		if minor >= 14 {
+			w.str("heap")
+		}
+		if minor >= 16 {
+			w.int('r')
+		}
+		w.str("app")
+		w.str("false")
+		w.str("1")
+		w.null()
+		w.WriteByte(1)
+		w.Write(make([]byte, 8))
+	}
+
+	for _, entry := range entries {
+		rows, found := data[entry.id]
+		if !found {
+			continue
+		}
+		w.WriteByte(blockData)
+		w.int(entry.id)
+		payload := []byte(rows)
+		if compression != 0 {
+			var compressed bytes.Buffer
+			zw := zlib.NewWriter(&compressed)
+			zw.Write(payload)
+			zw.Close()
+			payload = compressed.Bytes()
+		}
+		// Split into two chunks, as the compressor flushes its buffer.
+		half := len(payload) / 2
+		for _, chunk := range [][]byte{payload[:half], payload[half:]} {
+			w.int(len(chunk))
+			w.Write(chunk)
+		}
+		w.int(0)
+	}
+
+	// A large object block, which is skipped.
+	w.WriteByte(blockLargeObjects)
+	w.int(99)
+	w.int(16500)
+	w.str("blob")
+	w.int(0)
+	w.int(0)
+	return w.Bytes()
+}
+
+var testEntries = []testEntry{
+	{id: 1, tag: "SCHEMA sales", desc: "SCHEMA", defn: "CREATE SCHEMA sales;\n"},
+	{id: 2, tag: "orders", desc: "TABLE", namespace: "sales", defn: "CREATE TABLE sales.orders (\n    id bigint NOT NULL,\n    \"Note\" text\n);\n"},
+	{id: 3, tag: "orders", desc: "TABLE DATA", namespace: "sales", copyStm: "COPY sales.orders (id, \"Note\") FROM stdin;\n"},
+}
+
+func TestRead(t *testing.T) {
+	for _, archive := range []struct {
+		minor, compression int
+	}{{14, 0}, {14, -1}, {15, 1}, {16, 0}} {
+		content := writeArchive(t, archive.minor, archive.compression, testEntries, map[int]string{3: "1\tfirst\n2\t\\N\n3\t\\\\N\n"})
+
+		a, err := Read(bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Read of version 1.%d failed: %v", archive.minor, err)
+		}
+		assert.Equal(t, "shop", a.Database)
+		assert.Len(t, a.Entries, 3)
+		assert.Equal(t, Entry{DumpID: 2, Tag: "orders", Desc: "TABLE", Namespace: "sales", Owner: "app", Definition: testEntries[1].defn}, a.Entries[1])
+		assert.Equal(t, "CREATE SCHEMA sales;\nSET search_path = sales, pg_catalog;\n"+testEntries[1].defn, a.Schema())
+
+		var counts []TableCount
+		err = a.Data(func(entry Entry, data io.Reader) error {
+			count, err := CountCopy(entry.CopyStatement, data)
+			counts = append(counts, count)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Data of version 1.%d failed: %v", archive.minor, err)
+		}
+		assert.Equal(t, []TableCount{{Rows: 3, NonNull: map[string]int{"id": 3, "Note": 2}}}, counts)
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	_, err := Read(bytes.NewReader([]byte("CREATE TABLE t ();")))
+	assert.EqualError(t, err, "not a pg_dump archive")
+
+	content := writeArchive(t, 14, 0, testEntries, nil)
+	_, err = Read(bytes.NewReader(content[:200]))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	content[10] = 3
+	_, err = Read(bytes.NewReader(content))
+	assert.EqualError(t, err, "archive format 3 is not the custom format, only pg_dump -Fc archives can be read")
+
+	a, err := Read(bytes.NewReader(writeArchive(t, 15, 3, testEntries, nil)))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	assert.EqualError(t, a.Data(nil), "the data is compressed with zstd, which cannot be read")
+}
+
+func TestCountCopy(t *testing.T) {
+	count, err := CountCopy("COPY public.t (a, b, c) FROM stdin;\n", bytes.NewReader([]byte("1\t\\N\tx\n\\N\t\\N\t\\N\n\\.\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, TableCount{Rows: 2, NonNull: map[string]int{"a": 1, "b": 0, "c": 1}}, count)
+}
@@ -0,0 +1,200 @@
+package pgdump
+
+import (
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Block types of pg_backup_custom.c.
+const (
+	blockData         = 1
+	blockLargeObjects = 3
+)
+
+// TableCount is what the data of a table holds: its rows, and per column the rows in
+// which it is not NULL. Columns that are not in the data, as generated columns are not,
+// are missing from NonNull.
+type TableCount struct {
+	Rows    int
+	NonNull map[string]int
+}
+
+// Data reads the data blocks that follow the table of contents and calls visit with the
+// TABLE DATA entry of each and its decompressed data. It must be called at most once,
+// as the blocks are read in the order they are stored in.
+func (a *Archive) Data(visit func(entry Entry, data io.Reader) error) error {
+	if a.compression != compressionNone && a.compression != compressionGzip {
+		return fmt.Errorf("the data is compressed with %s, which cannot be read", a.Compression)
+	}
+	entries := make(map[int]Entry)
+	for _, entry := range a.Entries {
+		entries[entry.DumpID] = entry
+	}
+
+	for {
+		kind, err := a.reader.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		id := a.int()
+
+		switch kind {
+		case blockData:
+			chunks := &chunkReader{archive: a}
+			var data io.Reader = chunks
+			if a.compression == compressionGzip {
+				// A block without data can hold no stream at all.
+				if data, err = zlib.NewReader(chunks); errors.Is(err, io.EOF) {
+					data = strings.NewReader("")
+				} else if err != nil {
+					return fmt.Errorf("failed to decompress the data of entry %d: %w", id, err)
+				}
+			}
+			if entry, found := entries[id]; found && entry.Desc == "TABLE DATA" {
+				if err := visit(entry, data); err != nil {
+					return err
+				}
+			}
+			// Whatever visit left unread is skipped, up to the end of the block.
+			if _, err := io.Copy(io.Discard, chunks); err != nil {
+				return err
+			}
+		case blockLargeObjects:
+			// Each large object is its OID and its data, up to an OID of 0.
+			for a.int() != 0 && a.err == nil {
+				if _, err := io.Copy(io.Discard, &chunkReader{archive: a}); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unknown data block type %d", kind)
+		}
+		if a.err != nil {
+			return fmt.Errorf("failed to read data of entry %d: %w", id, a.err)
+		}
+	}
+}
+
+// chunkReader reads the data of a block, stored as chunks that each start with their
+// length, up to a chunk of length 0.
+type chunkReader struct {
+	archive   *Archive
+	remaining int
+	done      bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		c.remaining = c.archive.int()
+		if c.archive.err != nil {
+			return 0, c.archive.err
+		}
+		if c.remaining <= 0 {
+			c.remaining, c.done = 0, true
+		}
+	}
+
+	n, err := c.archive.reader.Read(p[:min(len(p), c.remaining)])
+	c.remaining -= n
+	if err != nil {
+		c.archive.err = unexpectedEOF(err)
+	}
+	return n, c.archive.err
+}
+
+// CountCopy counts the rows of data in COPY text format, as restored by the COPY of
+// copyStatement, and the rows in which each of its columns is not NULL.
+func CountCopy(copyStatement string, data io.Reader) (TableCount, error) {
+	columns := copyColumns(copyStatement)
+	count := TableCount{NonNull: make(map[string]int, len(columns))}
+	for _, column := range columns {
+		count.NonNull[column] = 0
+	}
+
+	buf := make([]byte, 64*1024)
+	field, line := 0, []byte(nil)
+	null := make([]bool, len(columns))
+	endRow := func() {
+		// The end-of-data marker is not a row.
+		if field == 0 && string(line) == `\.` {
+			return
+		}
+		if field < len(null) {
+			null[field] = string(line) == `\N`
+		}
+		count.Rows++
+		for i, column := range columns {
+			if !null[i] {
+				count.NonNull[column]++
+			}
+		}
+	}
+
+	for {
+		n, err := data.Read(buf)
+		for _, c := range buf[:n] {
+			switch c {
+			case '\n':
+				endRow()
+				field, line = 0, line[:0]
+			case '\t':
+				if field < len(null) {
+					null[field] = string(line) == `\N`
+				}
+				field, line = field+1, line[:0]
+			default:
+				// Only the start of a field is needed to tell \N from a value.
+				if len(line) < 3 {
+					line = append(line, c)
+				}
+			}
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// copyColumns returns the column names of a COPY statement's column list.
+func copyColumns(copyStatement string) []string {
+	start := strings.IndexByte(copyStatement, '(')
+	if start == -1 {
+		return nil
+	}
+
+	var columns []string
+	var name strings.Builder
+	quoted := false
+	for i := start + 1; i < len(copyStatement); i++ {
+		c := copyStatement[i]
+		switch {
+		case c == '"' && quoted && i+1 < len(copyStatement) && copyStatement[i+1] == '"':
+			name.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == ',' || c == ')'):
+			columns = append(columns, name.String())
+			name.Reset()
+			if c == ')' {
+				return columns
+			}
+		case !quoted && c == ' ':
+		default:
+			name.WriteByte(c)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,74 @@
+package pgdump
+
+import (
+	"errors"
+	"io"
+)
+
+// The readers below follow ReadInt, ReadStr and ReadOffset of pg_backup_archiver.c. The
+// first error is kept in a.err, after which they return zero values.
+
+func (a *Archive) byte() int {
+	if a.err != nil {
+		return 0
+	}
+	b, err := a.reader.ReadByte()
+	if err != nil {
+		a.err = unexpectedEOF(err)
+		return 0
+	}
+	return int(b)
+}
+
+// int reads a sign byte followed by the magnitude in intSize little-endian bytes.
+func (a *Archive) int() int {
+	negative := a.byte() != 0
+	value := 0
+	for i := 0; i < a.intSize; i++ {
+		value |= a.byte() << (8 * i)
+	}
+	if negative {
+		return -value
+	}
+	return value
+}
+
+func (a *Archive) str() string {
+	if s := a.nullableStr(); s != nil {
+		return *s
+	}
+	return ""
+}
+
+// nullableStr reads a length and that many bytes, or nil for the length -1 of a NULL.
+func (a *Archive) nullableStr() *string {
+	length := a.int()
+	if length < 0 || a.err != nil {
+		return nil
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(a.reader, buf); err != nil {
+		a.err = unexpectedEOF(err)
+		return nil
+	}
+	s := string(buf)
+	return &s
+}
+
+// offset reads a flag byte, which tells whether the position is set, followed by the
+// position in offSize little-endian bytes.
+func (a *Archive) offset() int64 {
+	a.byte()
+	var position int64
+	for i := 0; i < a.offSize; i++ {
+		position |= int64(a.byte()) << (8 * i)
+	}
+	return position
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
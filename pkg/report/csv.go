@@ -0,0 +1,183 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type csvWriter struct {
+	directory string
+	run       Run
+	options   SummaryOptions
+	tables    []TableReport
+}
+
+// NewCSVWriter writes one <table>_report.csv file per table into directory, and a
+// summary.csv ranking the tables once the writer is closed.
+func NewCSVWriter(directory string, run Run, options SummaryOptions) Writer {
+	return &csvWriter{directory: directory, run: run, options: options}
+}
+
+func (w *csvWriter) WriteTable(table TableReport) error {
+	if err := os.MkdirAll(w.directory, 0o755); err != nil {
+		return fmt.Errorf("unable to create reports directory: %v", err)
+	}
+
+	reportName := filepath.Join(w.directory, fmt.Sprintf("%s_report.csv", table.Name))
+	file, err := os.Create(reportName)
+	if err != nil {
+		return fmt.Errorf("unable to create report: %s, error: %v", reportName, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writeCSVHeader(writer); err != nil {
+		return fmt.Errorf("unable to write CSV header: %v", err)
+	}
+
+	// Write current column order with padding information
+	for _, col := range table.Columns {
+		if err := writer.Write(columnRow(col)); err != nil {
+			return fmt.Errorf("unable to write CSV row: %v", err)
+		}
+	}
+	if err := writer.Write(columnTotalsRow(table.Totals)); err != nil {
+		return fmt.Errorf("unable to write CSV row: %v", err)
+	}
+
+	w.tables = append(w.tables, table)
+	fmt.Printf("Report %s generated successfully.\n", reportName)
+
+	if len(table.Dependencies) > 0 {
+		return w.writeDependencies(table)
+	}
+	return nil
+}
+
+// writeDependencies writes the objects depending on a table to <table>_dependencies.csv.
+func (w *csvWriter) writeDependencies(table TableReport) error {
+	reportName := filepath.Join(w.directory, fmt.Sprintf("%s_dependencies.csv", table.Name))
+	file, err := os.Create(reportName)
+	if err != nil {
+		return fmt.Errorf("unable to create report: %s, error: %v", reportName, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write(dependencyHeader); err != nil {
+		return fmt.Errorf("unable to write CSV header: %v", err)
+	}
+	for _, dependent := range table.Dependencies {
+		if err := writer.Write([]string{dependent.Kind, dependent.Name, dependent.Action}); err != nil {
+			return fmt.Errorf("unable to write CSV row: %v", err)
+		}
+	}
+
+	fmt.Printf("Report %s generated successfully.\n", reportName)
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	if err := os.MkdirAll(w.directory, 0o755); err != nil {
+		return fmt.Errorf("unable to create reports directory: %v", err)
+	}
+
+	summaryName := filepath.Join(w.directory, "summary.csv")
+	file, err := os.Create(summaryName)
+	if err != nil {
+		return fmt.Errorf("unable to create report: %s, error: %v", summaryName, err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	summary := BuildSummary(w.run, w.tables, w.options)
+	if err := writer.Write(summaryHeader); err != nil {
+		return fmt.Errorf("unable to write CSV header: %v", err)
+	}
+	for _, row := range summary.Tables {
+		if err := writer.Write(summaryRow(row)); err != nil {
+			return fmt.Errorf("unable to write CSV row: %v", err)
+		}
+	}
+	if err := writer.Write(summaryTotalsRow(summary.Totals)); err != nil {
+		return fmt.Errorf("unable to write CSV row: %v", err)
+	}
+
+	fmt.Printf("Report %s generated successfully.\n", summaryName)
+	fmt.Println(formatSummary(summary.Totals))
+	return nil
+}
+
+func writeCSVHeader(writer *csv.Writer) error {
+	return writer.Write(columnHeader)
+}
+
+// columnHeader, columnRow and columnTotalsRow give the per-column breakdown shared by the
+// tabular formats. The padding of a column is the gap inserted before it.
+var columnHeader = []string{
+	"Ordinal Position",
+	"Column Name",
+	"Data Type",
+	"Nullable",
+	"Data Type Size (B)",
+	"Type Alignment (B)",
+	"Padding Before Column Per Entry (B)",
+	"Expected Padding Before Column Per Entry (B)",
+	"Recommended Position",
+	"Constrained Position",
+	"Total Wasted Space (B)",
+	"Expected Wasted Space (B)",
+	"Cacheable Offset",
+	"Cacheable Offset In Recommended Order",
+}
+
+func columnRow(col ColumnReport) []string {
+	return []string{
+		strconv.Itoa(col.OrdinalPosition),
+		col.Name,
+		col.DataType,
+		formatFlag(col.Nullable),
+		strconv.Itoa(col.TypLen),
+		strconv.Itoa(col.TypAlign),
+		strconv.Itoa(col.Padding),
+		formatBytes(col.ExpectedPadding),
+		strconv.Itoa(col.RecommendedPosition),
+		strconv.Itoa(col.ConstrainedPosition),
+		strconv.Itoa(col.WastedBytes),
+		formatBytes(col.ExpectedWastedBytes),
+		formatFlag(col.CacheableOffset),
+		formatFlag(col.RecommendedCacheableOffset),
+	}
+}
+
+// columnTotalsRow closes the breakdown with the padding of a whole row, the MAXALIGN tail
+// after the last column included, and the space it wastes across the table.
+func columnTotalsRow(totals Totals) []string {
+	return []string{
+		"",
+		"Total (row, with MAXALIGN tail)",
+		"",
+		"",
+		"",
+		"",
+		strconv.Itoa(totals.Padding),
+		formatBytes(totals.ExpectedPadding),
+		"",
+		"",
+		strconv.Itoa(totals.WastedBytes),
+		formatBytes(totals.ExpectedWastedBytes),
+		"",
+		"",
+	}
+}
+
+var dependencyHeader = []string{"Kind", "Name", "Action"}
@@ -0,0 +1,234 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// byteMapWidth is the width an SVG byte-map is scaled to fit, unless that would make a
+	// byte narrower than minByteWidth or wider than maxByteWidth.
+	byteMapWidth = 960
+	minByteWidth = 4
+	maxByteWidth = 24
+	byteMapRow   = 28
+)
+
+//go:embed templates/report.html.tmpl
+var htmlTemplate string
+
+// columnColors are cycled through for the columns of a byte-map; padding is drawn in
+// paddingColor so that it stands out against every one of them.
+var columnColors = []string{"#4e79a7", "#59a14f", "#76b7b2", "#edc948", "#b07aa1", "#9c755f", "#bab0ac", "#f28e2b"}
+
+const paddingColor = "#e15759"
+
+type htmlWriter struct {
+	path    string
+	run     Run
+	options SummaryOptions
+	tables  []TableReport
+}
+
+// NewHTMLWriter collects every table of a run into a single self-contained HTML page,
+// written to path when the writer is closed.
+func NewHTMLWriter(path string, run Run, options SummaryOptions) Writer {
+	return &htmlWriter{path: path, run: run, options: options}
+}
+
+func (w *htmlWriter) WriteTable(table TableReport) error {
+	w.tables = append(w.tables, table)
+	return nil
+}
+
+type htmlPage struct {
+	Run           Run
+	GeneratedAt   time.Time
+	Header        []string
+	Tables        []htmlTable
+	Summary       Summary
+	SummaryHeader []string
+	SummaryRows   [][]string
+	SummaryTotals []string
+}
+
+type htmlTable struct {
+	TableReport
+	Rows        [][]string
+	TotalsRow   []string
+	Current     byteMap
+	Recommended byteMap
+}
+
+type byteMap struct {
+	Width    int
+	Height   int
+	Segments []byteSegment
+	Ticks    []int
+}
+
+type byteSegment struct {
+	X       int
+	Width   int
+	Color   string
+	Label   string
+	Title   string
+	Padding bool
+}
+
+func (w *htmlWriter) Close() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return fmt.Errorf("unable to create reports directory: %v", err)
+	}
+
+	page, err := template.New("report").Parse(htmlTemplate)
+	if err != nil {
+		return fmt.Errorf("unable to parse HTML template: %v", err)
+	}
+
+	file, err := os.Create(w.path)
+	if err != nil {
+		return fmt.Errorf("unable to create report: %s, error: %v", w.path, err)
+	}
+	defer file.Close()
+
+	content := w.page()
+	if err := page.Execute(file, content); err != nil {
+		return fmt.Errorf("unable to write HTML report: %v", err)
+	}
+
+	fmt.Printf("Report %s generated successfully.\n", w.path)
+	fmt.Println(formatSummary(content.Summary.Totals))
+	return nil
+}
+
+func (w *htmlWriter) page() htmlPage {
+	page := htmlPage{
+		Run:           w.run,
+		GeneratedAt:   time.Now().UTC(),
+		Header:        columnHeader,
+		Summary:       BuildSummary(w.run, w.tables, w.options),
+		SummaryHeader: summaryHeader,
+	}
+	for _, row := range page.Summary.Tables {
+		page.SummaryRows = append(page.SummaryRows, summaryRow(row))
+	}
+	page.SummaryTotals = summaryTotalsRow(page.Summary.Totals)
+
+	for _, table := range w.tables {
+		rows := make([][]string, len(table.Columns))
+		for i, col := range table.Columns {
+			rows[i] = columnRow(col)
+		}
+
+		recommended := make([]ColumnReport, len(table.Columns))
+		copy(recommended, table.Columns)
+		sort.Slice(recommended, func(i, j int) bool {
+			return recommended[i].RecommendedPosition < recommended[j].RecommendedPosition
+		})
+
+		scale := byteScale(table.Totals.NoNulls.DataSize, table.Totals.Recommended.DataSize)
+		page.Tables = append(page.Tables, htmlTable{
+			TableReport: table,
+			Rows:        rows,
+			TotalsRow:   columnTotalsRow(table.Totals),
+			Current:     currentByteMap(table.Columns, table.Totals.NoNulls.DataSize, scale),
+			Recommended: recommendedByteMap(recommended, table.Totals.Recommended.DataSize, scale),
+		})
+	}
+
+	return page
+}
+
+// byteScale picks one width per byte for both byte-maps of a table so that they can be
+// compared by eye.
+func byteScale(sizes ...int) int {
+	largest := 1
+	for _, size := range sizes {
+		if size > largest {
+			largest = size
+		}
+	}
+
+	scale := byteMapWidth / largest
+	if scale < minByteWidth {
+		return minByteWidth
+	}
+	if scale > maxByteWidth {
+		return maxByteWidth
+	}
+	return scale
+}
+
+func currentByteMap(columns []ColumnReport, dataSize, scale int) byteMap {
+	offsets := make([]int, len(columns))
+	paddings := make([]int, len(columns))
+	for i, col := range columns {
+		offsets[i], paddings[i] = col.Offset, col.Padding
+	}
+	return newByteMap(columns, offsets, paddings, dataSize, scale)
+}
+
+func recommendedByteMap(columns []ColumnReport, dataSize, scale int) byteMap {
+	offsets := make([]int, len(columns))
+	paddings := make([]int, len(columns))
+	for i, col := range columns {
+		offsets[i], paddings[i] = col.RecommendedOffset, col.RecommendedPadding
+	}
+	return newByteMap(columns, offsets, paddings, dataSize, scale)
+}
+
+// newByteMap draws the data area of a row without NULLs: one segment per column and one
+// per padding gap, with a tick at every MAXALIGN boundary.
+func newByteMap(columns []ColumnReport, offsets, paddings []int, dataSize, scale int) byteMap {
+	byteMap := byteMap{Width: dataSize*scale + 1, Height: byteMapRow}
+
+	for i, col := range columns {
+		if paddings[i] > 0 {
+			start := offsets[i] - paddings[i]
+			byteMap.Segments = append(byteMap.Segments, byteSegment{
+				X:       start * scale,
+				Width:   paddings[i] * scale,
+				Color:   paddingColor,
+				Title:   fmt.Sprintf("padding before %s: %d B at offset %d", col.Name, paddings[i], start),
+				Padding: true,
+			})
+		}
+
+		segment := byteSegment{
+			X:     offsets[i] * scale,
+			Width: col.Size * scale,
+			Color: columnColors[(col.OrdinalPosition-1)%len(columnColors)],
+			Title: fmt.Sprintf("%s %s: %d B at offset %d", col.Name, col.DataType, col.Size, offsets[i]),
+		}
+		segment.Label = fitLabel(col.Name, segment.Width)
+		byteMap.Segments = append(byteMap.Segments, segment)
+	}
+
+	for offset := 0; offset <= dataSize; offset += 8 {
+		byteMap.Ticks = append(byteMap.Ticks, offset*scale)
+	}
+
+	return byteMap
+}
+
+// fitLabel shortens a column name to what fits in a segment of the given width, dropping
+// it altogether when not even a few characters would.
+func fitLabel(name string, width int) string {
+	const charWidth = 7
+	fits := (width - 4) / charWidth
+	runes := []rune(name)
+	switch {
+	case fits < 3:
+		return ""
+	case len(runes) > fits:
+		return string(runes[:fits-1]) + "…"
+	default:
+		return name
+	}
+}
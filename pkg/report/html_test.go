@@ -0,0 +1,108 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/estimate"
+	"main/pkg/layout"
+)
+
+func TestHTMLWriter(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+		{OrdinalPosition: 3, ColumnName: "count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
+	}
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	writer := NewHTMLWriter(path, Run{Database: "shop", Schema: "public"}, SummaryOptions{})
+	if _, err := GenerateReport(columnList, common.TableInfo{Name: "<orders>"}, layout.Options{}, estimate.Throughput{}, writer); err != nil {
+		t.Fatalf("GenerateReport failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closing the report writer failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report file: %v", err)
+	}
+	document := string(content)
+
+	assert.Equal(t, 2, strings.Count(document, "<svg"))
+	assert.Contains(t, document, "<h2>&lt;orders&gt;</h2>")
+	assert.Contains(t, document, "<title>padding before id: 7 B at offset 1</title>")
+	assert.Equal(t, 2, strings.Count(document, `class="padding"`))
+	assert.Contains(t, document, "<title>padding before count: 3 B at offset 1</title>")
+	assert.Contains(t, document, "<h3>Current order, 20 B</h3>")
+	assert.Contains(t, document, "<h3>Recommended order, 16 B</h3>")
+	assert.Contains(t, document, "<td>id</td><td>bigint</td>")
+
+	// Nothing is loaded from outside the file.
+	assert.NotRegexp(t, regexp.MustCompile(`(src|href)=`), document)
+}
+
+func TestNewByteMap(t *testing.T) {
+	columns := []ColumnReport{
+		{OrdinalPosition: 1, Name: "enabled", DataType: "boolean", Size: 1},
+		{OrdinalPosition: 2, Name: "id", DataType: "bigint", Offset: 8, Padding: 7, Size: 8},
+	}
+
+	byteMap := currentByteMap(columns, 16, 10)
+	assert.Equal(t, 161, byteMap.Width)
+	assert.Equal(t, []int{0, 80, 160}, byteMap.Ticks)
+	assert.Equal(t, []byteSegment{
+		{X: 0, Width: 10, Color: columnColors[0], Title: "enabled boolean: 1 B at offset 0"},
+		{X: 10, Width: 70, Color: paddingColor, Title: "padding before id: 7 B at offset 1", Padding: true},
+		{X: 80, Width: 80, Color: columnColors[1], Label: "id", Title: "id bigint: 8 B at offset 8"},
+	}, byteMap.Segments)
+}
+
+func TestByteScale(t *testing.T) {
+	assert.Equal(t, maxByteWidth, byteScale(8, 16))
+	assert.Equal(t, 10, byteScale(96, 80))
+	assert.Equal(t, minByteWidth, byteScale(4000))
+}
+
+func TestFitLabel(t *testing.T) {
+	assert.Equal(t, "created_at", fitLabel("created_at", 160))
+	assert.Equal(t, "creat…", fitLabel("created_at", 48))
+	assert.Equal(t, "", fitLabel("created_at", 16))
+}
+
+func TestHTMLWriter_SortableTables(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+	}
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	writer := NewHTMLWriter(path, Run{Database: "shop", Schema: "public"}, SummaryOptions{})
+	for _, name := range []string{"orders", "customers"} {
+		if _, err := GenerateReport(columnList, common.TableInfo{Name: name}, layout.Options{}, estimate.Throughput{}, writer); err != nil {
+			t.Fatalf("GenerateReport failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closing the report writer failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report file: %v", err)
+	}
+	document := string(content)
+
+	// The summary and both tables sort, each by the index of the header within its own row.
+	assert.Equal(t, 3, strings.Count(document, `<table class="sortable">`))
+	assert.Contains(t, document, `document.querySelectorAll("table.sortable").forEach(function (table) {`)
+	assert.Contains(t, document, "var column = header.cellIndex;")
+	assert.NotContains(t, document, `querySelectorAll("table.sortable th")`)
+}
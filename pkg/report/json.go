@@ -0,0 +1,77 @@
+package report
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON report document. The minor version is bumped
+// for additive changes and the major version when a field is removed or changes meaning.
+const SchemaVersion = "1.0"
+
+// JSONSchema is the JSON Schema the JSON report document conforms to.
+//
+//go:embed schema/report.schema.json
+var JSONSchema []byte
+
+type jsonDocument struct {
+	SchemaVersion string        `json:"schemaVersion"`
+	GeneratedAt   time.Time     `json:"generatedAt"`
+	Database      string        `json:"database"`
+	Schema        string        `json:"schema"`
+	Tables        []TableReport `json:"tables"`
+	Summary       Summary       `json:"summary"`
+}
+
+type jsonWriter struct {
+	path     string
+	options  SummaryOptions
+	document jsonDocument
+}
+
+// NewJSONWriter collects every table of a run into a single JSON document, written to
+// path when the writer is closed.
+func NewJSONWriter(path string, run Run, options SummaryOptions) Writer {
+	return &jsonWriter{
+		path:    path,
+		options: options,
+		document: jsonDocument{
+			SchemaVersion: SchemaVersion,
+			GeneratedAt:   time.Now().UTC(),
+			Database:      run.Database,
+			Schema:        run.Schema,
+			Tables:        []TableReport{},
+		},
+	}
+}
+
+func (w *jsonWriter) WriteTable(table TableReport) error {
+	w.document.Tables = append(w.document.Tables, table)
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return fmt.Errorf("unable to create reports directory: %v", err)
+	}
+
+	run := Run{Database: w.document.Database, Schema: w.document.Schema}
+	w.document.Summary = BuildSummary(run, w.document.Tables, w.options)
+
+	content, err := json.MarshalIndent(w.document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode JSON report: %v", err)
+	}
+
+	if err := os.WriteFile(w.path, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("unable to create report: %s, error: %v", w.path, err)
+	}
+
+	fmt.Printf("Report %s generated successfully.\n", w.path)
+	fmt.Println(formatSummary(w.document.Summary.Totals))
+	return nil
+}
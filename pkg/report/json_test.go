@@ -0,0 +1,161 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/estimate"
+	"main/pkg/layout"
+)
+
+func TestJSONWriter(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+		{OrdinalPosition: 3, ColumnName: "count", DataType: "integer", IsNullable: "YES", TypLen: 4, TypAlign: 4, EntryCount: 10},
+	}
+
+	path := filepath.Join(t.TempDir(), "out", "report.json")
+	writer := NewJSONWriter(path, Run{Database: "shop", Schema: "public"}, SummaryOptions{})
+	constraints := layout.Constraints{Pins: []layout.Pin{{Column: "id", Position: 2}}}
+	if _, err := GenerateReport(columnList, common.TableInfo{Name: "orders", RowCount: 10, TotalRelationSize: 8192}, layout.Options{Constraints: constraints}, estimate.Throughput{}, writer); err != nil {
+		t.Fatalf("GenerateReport failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closing the report writer failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report file: %v", err)
+	}
+
+	var document jsonDocument
+	if err := json.Unmarshal(content, &document); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+
+	assert.Equal(t, SchemaVersion, document.SchemaVersion)
+	assert.Equal(t, "shop", document.Database)
+	assert.Equal(t, "public", document.Schema)
+	assert.Len(t, document.Tables, 1)
+
+	table := document.Tables[0]
+	assert.Equal(t, "orders", table.Name)
+	assert.Equal(t, []string{"enabled", "count", "id"}, table.RecommendedOrder)
+	assert.Equal(t, []string{"enabled", "id", "count"}, table.ConstrainedOrder)
+	assert.Equal(t, 7, table.Columns[1].Padding)
+	// 7 bytes before id in each of the 10 entries and the 4-byte tail of each of the 10 rows.
+	assert.Equal(t, 4, table.Totals.TailPadding)
+	assert.Equal(t, 110, table.Totals.WastedBytes)
+	assert.Equal(t, RowSize{HeaderSize: 24, DataSize: 20, TupleSize: 48}, table.Totals.NoNulls)
+	assert.Equal(t, 40.0, table.Totals.Recommended.TupleSize)
+	if assert.NotNil(t, table.Totals.Constrained) {
+		assert.Equal(t, 48.0, table.Totals.Constrained.TupleSize)
+	}
+}
+
+func TestJSONWriter_NoTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	writer := NewJSONWriter(path, Run{Database: "shop", Schema: "public"}, SummaryOptions{})
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closing the report writer failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report file: %v", err)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	assert.Equal(t, []interface{}{}, document["tables"])
+}
+
+// TestJSONSchema_MatchesDocument checks that every key the writer emits is declared in
+// the published schema, and that every key the schema requires is emitted.
+func TestJSONSchema_MatchesDocument(t *testing.T) {
+	var schema struct {
+		Required   []string                   `json:"required"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]struct {
+			Required   []string                   `json:"required"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(JSONSchema, &schema); err != nil {
+		t.Fatalf("Failed to decode schema: %v", err)
+	}
+
+	constrained := OrderTotals{}
+	document := jsonDocument{
+		Tables: []TableReport{{
+			Columns:          []ColumnReport{{}},
+			ConstrainedOrder: []string{"id"},
+			Totals:           Totals{Constrained: &constrained},
+			Dependencies:     []Dependency{{}},
+		}},
+		Summary: Summary{Tables: []SummaryRow{{}}},
+	}
+	content, _ := json.Marshal(document)
+
+	var emitted map[string]interface{}
+	if err := json.Unmarshal(content, &emitted); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+
+	table := emitted["tables"].([]interface{})[0].(map[string]interface{})
+	totals := table["totals"].(map[string]interface{})
+	summary := emitted["summary"].(map[string]interface{})
+	objects := map[string]map[string]interface{}{
+		"":              emitted,
+		"summary":       summary,
+		"summaryRow":    summary["tables"].([]interface{})[0].(map[string]interface{}),
+		"summaryTotals": summary["totals"].(map[string]interface{}),
+		"table":         table,
+		"column":        table["columns"].([]interface{})[0].(map[string]interface{}),
+		"totals":        totals,
+		"rowSize":       totals["noNulls"].(map[string]interface{}),
+		"order":         totals["recommended"].(map[string]interface{}),
+		"dependency":    table["dependencies"].([]interface{})[0].(map[string]interface{}),
+		"maintenance":   table["maintenance"].(map[string]interface{}),
+	}
+
+	for name, object := range objects {
+		properties, required := schema.Properties, schema.Required
+		if name != "" {
+			properties, required = schema.Defs[name].Properties, schema.Defs[name].Required
+		}
+
+		assert.ElementsMatch(t, keys(properties), keysOf(object), "properties of %q", name)
+		for _, key := range required {
+			assert.Contains(t, object, key, "required key of %q", name)
+		}
+	}
+}
+
+func keys(properties map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func keysOf(object map[string]interface{}) []string {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
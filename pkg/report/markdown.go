@@ -0,0 +1,188 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarkdownLimit is the maximum size of a GitHub comment body. GitHub counts characters;
+// counting bytes instead keeps multi-byte names on the safe side.
+const MarkdownLimit = 65536
+
+type markdownWriter struct {
+	path    string
+	run     Run
+	options SummaryOptions
+	limit   int
+	tables  []TableReport
+}
+
+// NewMarkdownWriter collects every table of a run into a single Markdown document, written
+// to path when the writer is closed. Table sections that would take the document past
+// MarkdownLimit are left out, with a note saying so.
+func NewMarkdownWriter(path string, run Run, options SummaryOptions) Writer {
+	return &markdownWriter{path: path, run: run, options: options, limit: MarkdownLimit}
+}
+
+func (w *markdownWriter) WriteTable(table TableReport) error {
+	w.tables = append(w.tables, table)
+	return nil
+}
+
+func (w *markdownWriter) Close() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return fmt.Errorf("unable to create reports directory: %v", err)
+	}
+
+	if err := os.WriteFile(w.path, []byte(w.render()), 0o644); err != nil {
+		return fmt.Errorf("unable to create report: %s, error: %v", w.path, err)
+	}
+
+	fmt.Printf("Report %s generated successfully.\n", w.path)
+	fmt.Println(formatSummary(BuildSummary(w.run, w.tables, w.options).Totals))
+	return nil
+}
+
+// render lays out the summary first, then one section per table, both sorted by wasted
+// bytes so that whatever truncation drops matters least. The summary lists the tables the
+// summary options keep, as the other formats do; every table still gets its section.
+func (w *markdownWriter) render() string {
+	tables := make([]TableReport, len(w.tables))
+	copy(tables, w.tables)
+	sort.SliceStable(tables, func(i, j int) bool {
+		if tables[i].Totals.WastedBytes != tables[j].Totals.WastedBytes {
+			return tables[i].Totals.WastedBytes > tables[j].Totals.WastedBytes
+		}
+		return tables[i].Name < tables[j].Name
+	})
+
+	summary := BuildSummary(w.run, w.tables, w.options)
+	listed := make(map[string]bool, len(summary.Tables))
+	for _, row := range summary.Tables {
+		listed[row.Table] = true
+	}
+
+	var blocks []string
+	totals := summary.Totals
+	note := ""
+	if totals.Listed < totals.Tables {
+		note = fmt.Sprintf(" %d of %d tables listed.", totals.Listed, totals.Tables)
+	}
+	blocks = append(blocks, fmt.Sprintf(
+		"## Column alignment report\n\nDatabase `%s`, schema `%s`: %d tables analysed, %s B reclaimable (%s%% of tuple data) across %d rows.%s\n\n",
+		w.run.Database, w.run.Schema, totals.Tables, formatBytes(totals.ReclaimableBytes), formatBytes(totals.PercentSaved), totals.RowCount, note,
+	))
+	blocks = append(blocks, markdownRow([]string{"Table", "Wasted Space (B)", "Expected Wasted Space (B)", "Expected Tuple (B)", "Recommended Order (B)", "Saved Per Row (B)", "Maintenance (h)"}))
+	blocks = append(blocks, markdownRow([]string{"---", "---:", "---:", "---:", "---:", "---:", "---:"}))
+	for _, table := range tables {
+		if !listed[table.Name] {
+			continue
+		}
+		blocks = append(blocks, markdownRow([]string{
+			escapeMarkdown(table.Name),
+			strconv.Itoa(table.Totals.WastedBytes),
+			formatBytes(table.Totals.ExpectedWastedBytes),
+			formatBytes(table.Totals.ExpectedTupleSize),
+			formatBytes(table.Totals.Recommended.TupleSize),
+			formatBytes(table.Totals.ExpectedTupleSize - table.Totals.Recommended.TupleSize),
+			formatHours(table.Maintenance.Hours()),
+		}))
+	}
+	blocks[len(blocks)-1] += "\n"
+	sections := len(blocks)
+	for _, table := range tables {
+		blocks = append(blocks, markdownSection(table))
+	}
+
+	var document strings.Builder
+	for i, block := range blocks {
+		note := truncationNote(omittedTables(i, sections, len(tables)), len(tables))
+		if document.Len()+len(block)+len(note) > w.limit {
+			document.WriteString(note)
+			return document.String()
+		}
+		document.WriteString(block)
+	}
+	return document.String()
+}
+
+// omittedTables is how many table sections are left out if the document stops before
+// block i. Cutting into the summary leaves out every section.
+func omittedTables(i, sections, tableCount int) int {
+	if i < sections {
+		return tableCount
+	}
+	return tableCount - (i - sections)
+}
+
+func truncationNote(omitted, tableCount int) string {
+	return fmt.Sprintf("\n_Truncated to stay within GitHub's comment size limit: %d of %d table sections omitted. Use `--format json` for the full report._\n", omitted, tableCount)
+}
+
+func markdownSection(table TableReport) string {
+	var section strings.Builder
+	totals := table.Totals
+
+	bound := "optimal"
+	if !totals.Recommended.Optimal {
+		bound = fmt.Sprintf("within %s B of optimal", formatBytes(totals.Recommended.Objective-totals.Recommended.LowerBound))
+	}
+
+	fmt.Fprintf(&section, "### %s\n\n", table.Name)
+	fmt.Fprintf(&section, "Expected tuple %s B, recommended order %s B (%s). Cacheable column offsets current %d/%d, recommended order %d/%d.\n\n",
+		formatBytes(totals.ExpectedTupleSize), formatBytes(totals.Recommended.TupleSize), bound,
+		totals.CacheableOffsets, len(table.Columns), totals.Recommended.CacheableOffsets, len(table.Columns))
+	fmt.Fprintf(&section, "Recommended order: %s\n\n", markdownColumnList(table.RecommendedOrder))
+	fmt.Fprintf(&section, "Rebuild estimate: rewrites %d B, needs %d B of temporary disk, about %s h (copy %s h, index builds %s h).\n\n",
+		table.Maintenance.RewriteBytes, table.Maintenance.TemporaryBytes, formatHours(table.Maintenance.Hours()),
+		formatHours(table.Maintenance.CopySeconds/3600), formatHours(table.Maintenance.IndexBuildSeconds/3600))
+	if totals.Constrained != nil {
+		fmt.Fprintf(&section, "Constrained order (%s B): %s\n\n", formatBytes(totals.Constrained.TupleSize), markdownColumnList(table.ConstrainedOrder))
+	}
+	if len(table.Dependencies) > 0 {
+		section.WriteString("Dependent objects:\n\n")
+		for _, dependent := range table.Dependencies {
+			fmt.Fprintf(&section, "- **%s** %s `%s`\n", dependent.Action, escapeMarkdown(dependent.Kind), dependent.Name)
+		}
+		section.WriteString("\n")
+	}
+
+	section.WriteString("<details>\n<summary>Column breakdown</summary>\n\n")
+	section.WriteString(markdownRow(columnHeader))
+	separator := make([]string, len(columnHeader))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	section.WriteString(markdownRow(separator))
+	for _, col := range table.Columns {
+		row := columnRow(col)
+		for i := range row {
+			row[i] = escapeMarkdown(row[i])
+		}
+		section.WriteString(markdownRow(row))
+	}
+	section.WriteString(markdownRow(columnTotalsRow(table.Totals)))
+	section.WriteString("\n</details>\n\n")
+
+	return section.String()
+}
+
+func markdownColumnList(columns []string) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = "`" + column + "`"
+	}
+	return strings.Join(names, ", ")
+}
+
+func markdownRow(cells []string) string {
+	return "| " + strings.Join(cells, " | ") + " |\n"
+}
+
+func escapeMarkdown(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}
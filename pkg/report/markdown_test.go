@@ -0,0 +1,106 @@
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/estimate"
+	"main/pkg/layout"
+)
+
+func TestMarkdownWriter(t *testing.T) {
+	tight := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+	}
+	padded := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+		{OrdinalPosition: 3, ColumnName: "count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
+	}
+
+	path := filepath.Join(t.TempDir(), "report.md")
+	writer := NewMarkdownWriter(path, Run{Database: "shop", Schema: "public"}, SummaryOptions{})
+	for name, columnList := range map[string][]common.ColumnInfo{"accounts": tight, "orders": padded} {
+		if _, err := GenerateReport(columnList, common.TableInfo{Name: name}, layout.Options{}, estimate.Throughput{}, writer); err != nil {
+			t.Fatalf("GenerateReport failed: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closing the report writer failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report file: %v", err)
+	}
+	document := string(content)
+
+	assert.Contains(t, document, "Database `shop`, schema `public`: 2 tables analysed, 0.00 B reclaimable (0.00% of tuple data) across 0 rows.")
+	assert.Contains(t, document, "| orders | 70 | 70.00 | 48.00 | 40.00 | 8.00 | 0.00 |\n| accounts | 0 | 0.00 | 32.00 | 32.00 | 0.00 | 0.00 |\n")
+	assert.Less(t, strings.Index(document, "### orders"), strings.Index(document, "### accounts"))
+	assert.Contains(t, document, "Recommended order: `enabled`, `count`, `id`")
+	assert.Contains(t, document, "<details>\n<summary>Column breakdown</summary>\n\n| Ordinal Position | Column Name |")
+	assert.Contains(t, document, "| 2 | id | bigint | NO | 8 | 8 | 7 | 7.00 | 3 | 3 | 70 | 70.00 | YES | YES |")
+	// The whole row pads 7 bytes before id and 4 after count to reach MAXALIGN.
+	assert.Contains(t, document, "|  | Total (row, with MAXALIGN tail) |  |  |  |  | 11 | 11.00 |  |  | 70 | 70.00 |  |  |")
+	assert.Equal(t, 2, strings.Count(document, "</details>"))
+	assert.NotContains(t, document, "Truncated")
+}
+
+func TestMarkdownWriter_SummaryOptions(t *testing.T) {
+	writer := &markdownWriter{run: Run{Database: "shop", Schema: "public"}, options: SummaryOptions{Top: 1}, limit: MarkdownLimit}
+	for _, name := range []string{"accounts", "orders"} {
+		columnList := []common.ColumnInfo{
+			{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
+			{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+			{OrdinalPosition: 3, ColumnName: "count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
+		}
+		rows := 10
+		if name == "accounts" {
+			rows = 5
+		}
+		table, err := BuildTableReport(columnList, common.TableInfo{Name: name, RowCount: rows}, layout.Options{})
+		if err != nil {
+			t.Fatalf("BuildTableReport failed: %v", err)
+		}
+		writer.WriteTable(table)
+	}
+
+	document := writer.render()
+	assert.Contains(t, document, "across 15 rows. 1 of 2 tables listed.")
+	assert.Contains(t, document, "| orders | 110 |")
+	assert.NotContains(t, document, "| accounts |")
+	assert.Contains(t, document, "### accounts")
+	assert.Contains(t, document, "### orders")
+}
+
+func TestMarkdownWriter_Truncation(t *testing.T) {
+	writer := &markdownWriter{run: Run{Database: "shop", Schema: "public"}, limit: 4000}
+	for i := 0; i < 20; i++ {
+		table, err := BuildTableReport([]common.ColumnInfo{
+			{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: i},
+			{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: i},
+		}, common.TableInfo{Name: fmt.Sprintf("table_%02d", i)}, layout.Options{})
+		if err != nil {
+			t.Fatalf("BuildTableReport failed: %v", err)
+		}
+		writer.WriteTable(table)
+	}
+
+	document := writer.render()
+	assert.LessOrEqual(t, len(document), 4000)
+	assert.Contains(t, document, "| table_00 | 0 |")
+	assert.Contains(t, document, "### table_19")
+	assert.NotContains(t, document, "### table_00")
+	assert.Regexp(t, `_Truncated to stay within GitHub's comment size limit: \d+ of 20 table sections omitted\.`, document)
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	assert.Equal(t, `a\|b`, escapeMarkdown("a|b"))
+}
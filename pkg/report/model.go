@@ -0,0 +1,105 @@
+package report
+
+// Run identifies what a report was generated against.
+type Run struct {
+	Database string
+	Schema   string
+}
+
+// TableReport holds everything the report formats render for a single table.
+type TableReport struct {
+	Name              string         `json:"name"`
+	RowCount          int            `json:"rowCount"`
+	TotalRelationSize int64          `json:"totalRelationSize"`
+	Columns           []ColumnReport `json:"columns"`
+	RecommendedOrder  []string       `json:"recommendedOrder"`
+	ConstrainedOrder  []string       `json:"constrainedOrder,omitempty"`
+	Totals            Totals         `json:"totals"`
+	Maintenance       Maintenance    `json:"maintenance"`
+	Dependencies      []Dependency   `json:"dependencies,omitempty"`
+}
+
+// Maintenance estimates the rebuild of the table in its recommended order, or in its
+// constrained order when ordering constraints apply.
+type Maintenance struct {
+	HeapSize          int64   `json:"heapSize"`
+	ToastSize         int64   `json:"toastSize"`
+	IndexesSize       int64   `json:"indexesSize"`
+	NewHeapSize       int64   `json:"newHeapSize"`
+	RewriteBytes      int64   `json:"rewriteBytes"`
+	TemporaryBytes    int64   `json:"temporaryBytes"`
+	CopySeconds       float64 `json:"copySeconds"`
+	IndexBuildSeconds float64 `json:"indexBuildSeconds"`
+}
+
+func (m Maintenance) Hours() float64 {
+	return (m.CopySeconds + m.IndexBuildSeconds) / 3600
+}
+
+// Dependency is an object that depends on the table and what rebuilding the table in a
+// new order has to do about it.
+type Dependency struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+type ColumnReport struct {
+	OrdinalPosition            int     `json:"ordinalPosition"`
+	Name                       string  `json:"name"`
+	DataType                   string  `json:"dataType"`
+	Nullable                   bool    `json:"nullable"`
+	TypLen                     int     `json:"typLen"`
+	TypAlign                   int     `json:"typAlign"`
+	NullFrac                   float64 `json:"nullFrac"`
+	AvgWidth                   int     `json:"avgWidth"`
+	EntryCount                 int     `json:"entryCount"`
+	Offset                     int     `json:"offset"`
+	Size                       int     `json:"size"`
+	Padding                    int     `json:"padding"`
+	ExpectedPadding            float64 `json:"expectedPadding"`
+	RecommendedPosition        int     `json:"recommendedPosition"`
+	RecommendedOffset          int     `json:"recommendedOffset"`
+	RecommendedPadding         int     `json:"recommendedPadding"`
+	ConstrainedPosition        int     `json:"constrainedPosition"`
+	WastedBytes                int     `json:"wastedBytes"`
+	ExpectedWastedBytes        float64 `json:"expectedWastedBytes"`
+	CacheableOffset            bool    `json:"cacheableOffset"`
+	RecommendedCacheableOffset bool    `json:"recommendedCacheableOffset"`
+}
+
+// Totals sums up a table in its current order. Padding is all the padding in a row without
+// NULLs, the TailPadding that rounds the data area up to MAXALIGN included; WastedBytes
+// adds the padding before every stored column value to that tail for every row.
+type Totals struct {
+	NoNulls             RowSize      `json:"noNulls"`
+	WithNulls           RowSize      `json:"withNulls"`
+	ExpectedTupleSize   float64      `json:"expectedTupleSize"`
+	Padding             int          `json:"padding"`
+	ExpectedPadding     float64      `json:"expectedPadding"`
+	TailPadding         int          `json:"tailPadding"`
+	ExpectedTailPadding float64      `json:"expectedTailPadding"`
+	WastedBytes         int          `json:"wastedBytes"`
+	ExpectedWastedBytes float64      `json:"expectedWastedBytes"`
+	CacheableOffsets    int          `json:"cacheableOffsets"`
+	Recommended         OrderTotals  `json:"recommended"`
+	Constrained         *OrderTotals `json:"constrained,omitempty"`
+}
+
+type RowSize struct {
+	HeaderSize int `json:"headerSize"`
+	DataSize   int `json:"dataSize"`
+	TupleSize  int `json:"tupleSize"`
+}
+
+// OrderTotals describes a recommended order. DataSize is the data area of a row without
+// NULLs in that order. Objective is what the search minimised and LowerBound a proven
+// bound on it; Optimal is set when the two meet.
+type OrderTotals struct {
+	TupleSize        float64 `json:"tupleSize"`
+	DataSize         int     `json:"dataSize"`
+	CacheableOffsets int     `json:"cacheableOffsets"`
+	Objective        float64 `json:"objective"`
+	LowerBound       float64 `json:"lowerBound"`
+	Optimal          bool    `json:"optimal"`
+}
@@ -1,105 +1,259 @@
 package report
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
-	"sort"
 	"strconv"
+	"strings"
 
 	"main/pkg/common"
+	"main/pkg/dependency"
+	"main/pkg/estimate"
+	"main/pkg/layout"
 )
 
-func GenerateReport(columnList []common.ColumnInfo, tableName string) error {
-	reportName := fmt.Sprintf("reports/%s_report.csv", tableName)
-	file, err := os.Create(reportName)
+func GenerateReport(columnList []common.ColumnInfo, tableInfo common.TableInfo, options layout.Options, throughput estimate.Throughput, writer Writer) (TableReport, error) {
+	table, err := BuildTableReport(columnList, tableInfo, options)
 	if err != nil {
-		return fmt.Errorf("unable to create report: %s, error: %v", reportName, err)
+		return TableReport{}, err
 	}
-	defer file.Close()
+	table.Maintenance = maintenance(tableInfo, table.Totals, throughput)
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if err := writer.WriteTable(table); err != nil {
+		return TableReport{}, err
+	}
 
-	if err := writeCSVHeader(writer); err != nil {
-		return fmt.Errorf("unable to write CSV header: %v", err)
+	fmt.Println(formatEstimate(table.Name, table.Totals))
+	if table.Totals.Constrained != nil {
+		fmt.Println(formatConstrainedEstimate(table.Name, table.Totals))
+	}
+	fmt.Println(formatDeformScore(table.Name, len(table.Columns), table.Totals))
+	fmt.Println(formatMaintenance(table.Name, table.Maintenance))
+	if len(table.Dependencies) > 0 {
+		fmt.Println(formatDependencies(table.Name, table.Dependencies))
 	}
+	return table, nil
+}
 
-	// Build a map here to store the recommended position as the map's value.
-	// We could sort the list of columns by their type alignment, but retrieving
-	// the given column would take O(n) since we don't know its position.
-	alignmentMap := buildAlignmentMap(columnList)
+// BuildTableReport computes the layout of a table in its current order along with the
+// recommended order and, when options carry constraints, the constrained one.
+func BuildTableReport(columnList []common.ColumnInfo, tableInfo common.TableInfo, options layout.Options) (TableReport, error) {
+	tableName := tableInfo.Name
 
-	// Write current column order with padding information
-	for i, col := range columnList {
-		currentSize := col.TypAlign
-		var nextSize int
-		if i < len(columnList)-1 {
-			nextSize = columnList[i+1].TypAlign
-		}
+	ordering, err := layout.OptimizeWithOptions(columnList, layout.Options{DeformWeight: options.DeformWeight})
+	if err != nil {
+		return TableReport{}, fmt.Errorf("unable to compute recommended order for %s: %v", tableName, err)
+	}
 
-		wastedPadding := calculateWastedPadding(currentSize, nextSize)
-
-		row := []string{
-			strconv.Itoa(col.OrdinalPosition),
-			col.ColumnName,
-			col.DataType,
-			col.IsNullable,
-			strconv.Itoa(col.TypLen),
-			strconv.Itoa(col.TypAlign),
-			strconv.Itoa(wastedPadding),
-			strconv.Itoa(alignmentMap[col.ColumnName]),
-			strconv.Itoa(col.EntryCount * wastedPadding),
+	constrainedOrdering := ordering
+	if !options.Constraints.Empty() {
+		constrainedOrdering, err = layout.OptimizeWithOptions(columnList, options)
+		if err != nil {
+			return TableReport{}, fmt.Errorf("unable to apply ordering constraints to %s: %v", tableName, err)
 		}
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("unable to write CSV row: %v", err)
+	}
+
+	recommendedPositions := ordering.Positions()
+	constrainedPositions := constrainedOrdering.Positions()
+
+	tupleLayout := layout.Compute(columnList)
+	recommendedLayout := layout.Compute(layout.Reorder(columnList, ordering.Order))
+	expectedLayout := layout.Expected(columnList)
+	estimate := layout.Estimate(columnList)
+
+	tailPadding := tupleLayout.AlignedSize - tupleLayout.DataSize
+	cacheable := layout.CacheableOffsets(columnList)
+	recommendedCacheable := ordering.Cacheable(columnList)
+
+	table := TableReport{
+		Name:              tableName,
+		RowCount:          tableInfo.RowCount,
+		TotalRelationSize: tableInfo.TotalRelationSize,
+		Columns:           make([]ColumnReport, len(columnList)),
+		RecommendedOrder:  columnNames(columnList, ordering.Order),
+		Totals: Totals{
+			NoNulls:             rowSize(estimate.NoNulls),
+			WithNulls:           rowSize(estimate.WithNulls),
+			ExpectedTupleSize:   expectedLayout.TupleSize,
+			Padding:             tupleLayout.Padding + tailPadding,
+			ExpectedPadding:     expectedLayout.TotalPadding + expectedLayout.TailPadding,
+			TailPadding:         tailPadding,
+			ExpectedTailPadding: expectedLayout.TailPadding,
+			CacheableOffsets:    layout.DeformScore(columnList),
+			Recommended:         orderTotals(ordering, recommendedLayout),
+		},
+	}
+
+	for i, col := range columnList {
+		wastedPadding := tupleLayout.Columns[i].Padding
+		expectedPadding := expectedLayout.Padding[i]
+
+		table.Columns[i] = ColumnReport{
+			OrdinalPosition:            col.OrdinalPosition,
+			Name:                       col.ColumnName,
+			DataType:                   col.DataType,
+			Nullable:                   col.IsNullable == "YES",
+			TypLen:                     col.TypLen,
+			TypAlign:                   col.TypAlign,
+			NullFrac:                   col.NullFrac,
+			AvgWidth:                   col.AvgWidth,
+			EntryCount:                 col.EntryCount,
+			Offset:                     tupleLayout.Columns[i].Offset,
+			Size:                       tupleLayout.Columns[i].Size,
+			Padding:                    wastedPadding,
+			ExpectedPadding:            expectedPadding,
+			RecommendedPosition:        recommendedPositions[i],
+			RecommendedOffset:          recommendedLayout.Columns[recommendedPositions[i]-1].Offset,
+			RecommendedPadding:         recommendedLayout.Columns[recommendedPositions[i]-1].Padding,
+			ConstrainedPosition:        constrainedPositions[i],
+			WastedBytes:                col.EntryCount * wastedPadding,
+			ExpectedWastedBytes:        float64(col.EntryCount) * expectedPadding,
+			CacheableOffset:            cacheable[i],
+			RecommendedCacheableOffset: recommendedCacheable[i],
 		}
+		table.Totals.WastedBytes += table.Columns[i].WastedBytes
+		table.Totals.ExpectedWastedBytes += table.Columns[i].ExpectedWastedBytes
+	}
+
+	// Every row is stored rounded up to MAXALIGN, so the tail is wasted once per row.
+	table.Totals.WastedBytes += tableInfo.RowCount * table.Totals.TailPadding
+	table.Totals.ExpectedWastedBytes += float64(tableInfo.RowCount) * table.Totals.ExpectedTailPadding
+
+	if !options.Constraints.Empty() {
+		constrained := orderTotals(constrainedOrdering, layout.Compute(layout.Reorder(columnList, constrainedOrdering.Order)))
+		table.Totals.Constrained = &constrained
+		table.ConstrainedOrder = columnNames(columnList, constrainedOrdering.Order)
+	}
+
+	for _, dependent := range dependency.Analyze(tableInfo) {
+		table.Dependencies = append(table.Dependencies, Dependency{Kind: dependent.Kind, Name: dependent.Name, Action: string(dependent.Action)})
+	}
+
+	return table, nil
+}
+
+// rebuiltTupleSize is the expected tuple size in the order the plan command would pick: the
+// constrained order when constraints apply, or else the recommended one.
+func rebuiltTupleSize(totals Totals) float64 {
+	if totals.Constrained != nil {
+		return totals.Constrained.TupleSize
 	}
+	return totals.Recommended.TupleSize
+}
 
-	fmt.Printf("Report %s generated successfully.\n", reportName)
-	return nil
+// maintenance estimates the rebuild into the order the plan command would pick.
+func maintenance(tableInfo common.TableInfo, totals Totals, throughput estimate.Throughput) Maintenance {
+	rebuild := estimate.ForRebuild(tableInfo, rebuiltTupleSize(totals), throughput)
+	return Maintenance{
+		HeapSize:          tableInfo.HeapSize,
+		ToastSize:         tableInfo.ToastSize,
+		IndexesSize:       tableInfo.IndexesSize,
+		NewHeapSize:       rebuild.NewHeapSize,
+		RewriteBytes:      rebuild.RewriteBytes,
+		TemporaryBytes:    rebuild.TemporaryBytes,
+		CopySeconds:       rebuild.CopySeconds,
+		IndexBuildSeconds: rebuild.IndexBuildSeconds,
+	}
 }
 
-func writeCSVHeader(writer *csv.Writer) error {
-	return writer.Write([]string{
-		"Ordinal Position",
-		"Column Name",
-		"Data Type",
-		"Nullable",
-		"Data Type Size (B)",
-		"Type Alignment (B)",
-		"Wasted Padding Per Entry (B)",
-		"Recommended Position",
-		"Total Wasted Space (B)",
-	})
+func columnNames(columnList []common.ColumnInfo, order []int) []string {
+	names := make([]string, len(order))
+	for position, index := range order {
+		names[position] = columnList[index].ColumnName
+	}
+	return names
 }
 
-func calculateWastedPadding(currentSize, nextSize int) int {
-	if nextSize == 0 {
-		return 0
+func rowSize(estimate layout.RowEstimate) RowSize {
+	return RowSize{HeaderSize: estimate.HeaderSize, DataSize: estimate.DataSize, TupleSize: estimate.TupleSize}
+}
+
+func orderTotals(ordering layout.Ordering, tupleLayout layout.TupleLayout) OrderTotals {
+	return OrderTotals{
+		TupleSize:        ordering.TupleSize,
+		DataSize:         tupleLayout.DataSize,
+		CacheableOffsets: ordering.CacheableOffsets,
+		Objective:        ordering.Objective,
+		LowerBound:       ordering.LowerBound,
+		Optimal:          ordering.Optimal(),
 	}
+}
 
-	remainder := currentSize % nextSize
-	if remainder == 0 {
-		return 0
+func formatEstimate(tableName string, totals Totals) string {
+	bound := "optimal"
+	if !totals.Recommended.Optimal {
+		bound = fmt.Sprintf("within %s B of optimal", formatBytes(totals.Recommended.Objective-totals.Recommended.LowerBound))
 	}
 
-	return nextSize - remainder
+	return fmt.Sprintf(
+		"Table %s: without NULLs header %d B + data %d B = tuple %d B; with NULLs header %d B + data %d B = tuple %d B; expected tuple %s B, recommended order %s B (%s)",
+		tableName,
+		totals.NoNulls.HeaderSize, totals.NoNulls.DataSize, totals.NoNulls.TupleSize,
+		totals.WithNulls.HeaderSize, totals.WithNulls.DataSize, totals.WithNulls.TupleSize,
+		formatBytes(totals.ExpectedTupleSize), formatBytes(totals.Recommended.TupleSize), bound,
+	)
+}
+
+func formatConstrainedEstimate(tableName string, totals Totals) string {
+	return fmt.Sprintf(
+		"Table %s: constrained order %s B, %s B more than the unconstrained order",
+		tableName,
+		formatBytes(totals.Constrained.TupleSize),
+		formatBytes(totals.Constrained.TupleSize-totals.Recommended.TupleSize),
+	)
 }
 
-func buildAlignmentMap(columnList []common.ColumnInfo) map[string]int {
-	copiedList := make([]common.ColumnInfo, len(columnList))
-	copy(copiedList, columnList)
+func formatDeformScore(tableName string, columnCount int, totals Totals) string {
+	summary := fmt.Sprintf(
+		"Table %s: cacheable column offsets current %d/%d, recommended order %d/%d",
+		tableName, totals.CacheableOffsets, columnCount, totals.Recommended.CacheableOffsets, columnCount,
+	)
+	if totals.Constrained != nil {
+		summary += fmt.Sprintf(", constrained order %d/%d", totals.Constrained.CacheableOffsets, columnCount)
+	}
+	return summary
+}
 
-	sort.Slice(copiedList, func(i, j int) bool {
-		return copiedList[i].TypAlign > copiedList[j].TypAlign
-	})
+func formatMaintenance(tableName string, maintenance Maintenance) string {
+	return fmt.Sprintf(
+		"Table %s: rebuild rewrites %d B (heap %d B, currently %d B; TOAST %d B; indexes %d B), needs %d B of temporary disk and about %s h (copy %s h, index builds %s h)",
+		tableName, maintenance.RewriteBytes, maintenance.NewHeapSize, maintenance.HeapSize, maintenance.ToastSize, maintenance.IndexesSize,
+		maintenance.TemporaryBytes, formatHours(maintenance.Hours()), formatHours(maintenance.CopySeconds/3600), formatHours(maintenance.IndexBuildSeconds/3600),
+	)
+}
 
-	columnMap := make(map[string]int)
+// formatDependencies sums up how much of a rebuild the dependent objects of a table add.
+func formatDependencies(tableName string, dependencies []Dependency) string {
+	counts := make(map[string]int)
+	var blocking []string
+	for _, dependent := range dependencies {
+		counts[dependent.Action]++
+		if dependent.Action == string(dependency.Manual) {
+			blocking = append(blocking, dependent.Kind+" "+dependent.Name)
+		}
+	}
 
-	for i, colInfo := range copiedList {
-		columnMap[colInfo.ColumnName] = i + 1
+	summary := fmt.Sprintf(
+		"Table %s: %d dependent objects, %d to recreate, %d to retarget, %d to review, %d needing manual work",
+		tableName, len(dependencies),
+		counts[string(dependency.Recreate)], counts[string(dependency.Retarget)], counts[string(dependency.Review)], counts[string(dependency.Manual)],
+	)
+	if len(blocking) > 0 {
+		summary += " (" + strings.Join(blocking, ", ") + ")"
 	}
+	return summary
+}
+
+func formatFlag(value bool) string {
+	if value {
+		return "YES"
+	}
+	return "NO"
+}
+
+func formatBytes(bytes float64) string {
+	return strconv.FormatFloat(bytes, 'f', 2, 64)
+}
 
-	return columnMap
+func formatHours(hours float64) string {
+	return strconv.FormatFloat(hours, 'f', 2, 64)
 }
@@ -7,48 +7,52 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"main/pkg/common"
+	"main/pkg/estimate"
+	"main/pkg/layout"
 )
 
-var expectedHeader = []string{"Ordinal Position", "Column Name", "Data Type", "Nullable", "Data Type Size (B)", "Type Alignment (B)", "Wasted Padding Per Entry (B)", "Recommended Position", "Total Wasted Space (B)"}
+var expectedHeader = []string{"Ordinal Position", "Column Name", "Data Type", "Nullable", "Data Type Size (B)", "Type Alignment (B)", "Padding Before Column Per Entry (B)", "Expected Padding Before Column Per Entry (B)", "Recommended Position", "Constrained Position", "Total Wasted Space (B)", "Expected Wasted Space (B)", "Cacheable Offset", "Cacheable Offset In Recommended Order"}
 
 func TestGenerateReport(t *testing.T) {
 	columnList := []common.ColumnInfo{
-		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: -1, EntryCount: 10},
+		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
 		{OrdinalPosition: 2, ColumnName: "age", DataType: "smallint", IsNullable: "NO", TypLen: 2, TypAlign: 2, EntryCount: 10},
 		{OrdinalPosition: 3, ColumnName: "count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
 		{OrdinalPosition: 4, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "enabled", "boolean", "NO", "1", "-1", "3", "4", "30"},
-		{"2", "age", "smallint", "NO", "2", "2", "2", "3", "20"},
-		{"3", "count", "integer", "NO", "4", "4", "4", "2", "40"},
-		{"4", "id", "bigint", "NO", "8", "8", "0", "1", "0"},
+		{"1", "enabled", "boolean", "NO", "1", "1", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "age", "smallint", "NO", "2", "2", "1", "1.00", "2", "2", "10", "10.00", "YES", "YES"},
+		{"3", "count", "integer", "NO", "4", "4", "0", "0.00", "3", "3", "0", "0.00", "YES", "YES"},
+		{"4", "id", "bigint", "NO", "8", "8", "0", "0.00", "4", "4", "0", "0.00", "YES", "YES"},
 	})
 }
 
 func TestGenerateReport_NullableColumns(t *testing.T) {
 	columnList := []common.ColumnInfo{
-		{OrdinalPosition: 1, ColumnName: "description", DataType: "text", IsNullable: "YES", TypLen: 1, TypAlign: -1, EntryCount: 3},
+		{OrdinalPosition: 1, ColumnName: "archived", DataType: "boolean", IsNullable: "YES", TypLen: 1, TypAlign: 1, EntryCount: 3},
 		{OrdinalPosition: 2, ColumnName: "price", DataType: "real", IsNullable: "YES", TypLen: 4, TypAlign: 4, EntryCount: 4},
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "description", "text", "YES", "1", "-1", "5", "2", "15"},
-		{"2", "price", "real", "YES", "4", "4", "0", "1", "0"},
+		{"1", "archived", "boolean", "YES", "1", "1", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "price", "real", "YES", "4", "4", "3", "3.00", "2", "2", "12", "12.00", "NO", "NO"},
 	})
 }
 
 func TestGenerateReport_SameDataType(t *testing.T) {
 	columnList := []common.ColumnInfo{
-		{OrdinalPosition: 1, ColumnName: "first_name", DataType: "varchar", IsNullable: "YES", TypLen: 1, TypAlign: -1, EntryCount: 3},
-		{OrdinalPosition: 2, ColumnName: "last_name", DataType: "varchar", IsNullable: "YES", TypLen: 1, TypAlign: -1, EntryCount: 2},
+		{OrdinalPosition: 1, ColumnName: "first_name", DataType: "varchar", IsNullable: "YES", TypLen: -1, TypAlign: 4, EntryCount: 3},
+		{OrdinalPosition: 2, ColumnName: "last_name", DataType: "varchar", IsNullable: "YES", TypLen: -1, TypAlign: 4, EntryCount: 2},
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "first_name", "varchar", "YES", "1", "-1", "0", "1", "0"},
-		{"2", "last_name", "varchar", "YES", "1", "-1", "0", "2", "0"},
+		{"1", "first_name", "varchar", "YES", "-1", "4", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "last_name", "varchar", "YES", "-1", "4", "0", "0.00", "2", "2", "0", "0.00", "NO", "NO"},
 	})
 }
 
@@ -65,56 +69,56 @@ func TestGenerateReport_SOExample(t *testing.T) {
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "e", "smallint", "NO", "2", "2", "6", "5", "60"},
-		{"2", "a", "bigint", "NO", "8", "8", "0", "1", "0"},
-		{"3", "f", "smallint", "NO", "2", "2", "6", "6", "60"},
-		{"4", "b", "bigint", "NO", "8", "8", "0", "2", "0"},
-		{"5", "g", "smallint", "NO", "2", "2", "6", "7", "60"},
-		{"6", "c", "bigint", "NO", "8", "8", "0", "3", "0"},
-		{"7", "h", "smallint", "NO", "2", "2", "6", "8", "60"},
-		{"8", "d", "bigint", "NO", "8", "8", "0", "4", "0"},
+		{"1", "e", "smallint", "NO", "2", "2", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "a", "bigint", "NO", "8", "8", "6", "6.00", "5", "5", "60", "60.00", "YES", "YES"},
+		{"3", "f", "smallint", "NO", "2", "2", "0", "0.00", "2", "2", "0", "0.00", "YES", "YES"},
+		{"4", "b", "bigint", "NO", "8", "8", "6", "6.00", "6", "6", "60", "60.00", "YES", "YES"},
+		{"5", "g", "smallint", "NO", "2", "2", "0", "0.00", "3", "3", "0", "0.00", "YES", "YES"},
+		{"6", "c", "bigint", "NO", "8", "8", "6", "6.00", "7", "7", "60", "60.00", "YES", "YES"},
+		{"7", "h", "smallint", "NO", "2", "2", "0", "0.00", "4", "4", "0", "0.00", "YES", "YES"},
+		{"8", "d", "bigint", "NO", "8", "8", "6", "6.00", "8", "8", "60", "60.00", "YES", "YES"},
 	})
 }
 
 func TestGenerateReport_AllDataTypes(t *testing.T) {
 	columnList := []common.ColumnInfo{
 		{OrdinalPosition: 1, ColumnName: "id", DataType: "smallint", IsNullable: "NO", TypLen: 2, TypAlign: 2, EntryCount: 10},
-		{OrdinalPosition: 2, ColumnName: "status", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: -1, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "status", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
 		{OrdinalPosition: 3, ColumnName: "created_at", DataType: "timestamp without time zone", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
 		{OrdinalPosition: 4, ColumnName: "score", DataType: "double precision", IsNullable: "YES", TypLen: 8, TypAlign: 8, EntryCount: 6},
-		{OrdinalPosition: 5, ColumnName: "unique_id", DataType: "uuid", IsNullable: "NO", TypLen: 8, TypAlign: -1, EntryCount: 10},
-		{OrdinalPosition: 6, ColumnName: "data", DataType: "bytea", IsNullable: "YES", TypLen: 1, TypAlign: -1, EntryCount: 5},
+		{OrdinalPosition: 5, ColumnName: "unique_id", DataType: "uuid", IsNullable: "NO", TypLen: 16, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 6, ColumnName: "data", DataType: "bytea", IsNullable: "YES", TypLen: -1, TypAlign: 4, EntryCount: 5},
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "id", "smallint", "NO", "2", "2", "0", "3", "0"},
-		{"2", "status", "boolean", "NO", "1", "-1", "9", "4", "90"},
-		{"3", "created_at", "timestamp without time zone", "NO", "8", "8", "0", "1", "0"},
-		{"4", "score", "double precision", "YES", "8", "8", "0", "2", "0"},
-		{"5", "unique_id", "uuid", "NO", "8", "-1", "0", "5", "0"},
-		{"6", "data", "bytea", "YES", "1", "-1", "0", "6", "0"},
+		{"1", "id", "smallint", "NO", "2", "2", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "status", "boolean", "NO", "1", "1", "0", "0.00", "2", "2", "0", "0.00", "YES", "YES"},
+		{"3", "created_at", "timestamp without time zone", "NO", "8", "8", "5", "5.00", "5", "5", "50", "50.00", "YES", "NO"},
+		{"4", "score", "double precision", "YES", "8", "8", "0", "0.00", "6", "6", "0", "0.00", "YES", "NO"},
+		{"5", "unique_id", "uuid", "NO", "16", "1", "0", "0.00", "3", "3", "0", "0.00", "NO", "YES"},
+		{"6", "data", "bytea", "YES", "-1", "4", "0", "0.00", "4", "4", "0", "0.00", "NO", "YES"},
 	})
 }
 
 func TestGenerateReport_SingleColumn(t *testing.T) {
 	columnList := []common.ColumnInfo{
-		{OrdinalPosition: 1, ColumnName: "id", DataType: "uuid", IsNullable: "NO", TypLen: 8, TypAlign: -1},
+		{OrdinalPosition: 1, ColumnName: "id", DataType: "uuid", IsNullable: "NO", TypLen: 16, TypAlign: 1},
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "id", "uuid", "NO", "8", "-1", "0", "1", "0"},
+		{"1", "id", "uuid", "NO", "16", "1", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
 	})
 }
 
 func TestGenerateReport_Uuid(t *testing.T) {
 	columnList := []common.ColumnInfo{
 		{OrdinalPosition: 1, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 400},
-		{OrdinalPosition: 2, ColumnName: "uuid", DataType: "uuid", IsNullable: "NO", TypLen: 8, TypAlign: -1, EntryCount: 400},
+		{OrdinalPosition: 2, ColumnName: "uuid", DataType: "uuid", IsNullable: "NO", TypLen: 16, TypAlign: 1, EntryCount: 400},
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "id", "bigint", "NO", "8", "8", "0", "1", "0"},
-		{"2", "uuid", "uuid", "NO", "8", "-1", "0", "2", "0"},
+		{"1", "id", "bigint", "NO", "8", "8", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "uuid", "uuid", "NO", "16", "1", "0", "0.00", "2", "2", "0", "0.00", "YES", "YES"},
 	})
 }
 
@@ -129,38 +133,112 @@ func TestGenerateReport_EDBExample(t *testing.T) {
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "a", "char", "NO", "1", "1", "1", "4", "10"},
-		{"2", "b", "int2", "NO", "2", "2", "0", "3", "0"},
-		{"3", "c", "char", "NO", "1", "1", "3", "5", "30"},
-		{"4", "d", "int4", "NO", "4", "4", "0", "2", "0"},
-		{"5", "e", "char", "NO", "1", "1", "7", "6", "70"},
-		{"6", "f", "int8", "NO", "8", "8", "0", "1", "0"},
+		{"1", "a", "char", "NO", "1", "1", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "b", "int2", "NO", "2", "2", "1", "1.00", "2", "2", "10", "10.00", "YES", "YES"},
+		{"3", "c", "char", "NO", "1", "1", "0", "0.00", "3", "3", "0", "0.00", "YES", "YES"},
+		{"4", "d", "int4", "NO", "4", "4", "3", "3.00", "4", "4", "30", "30.00", "YES", "YES"},
+		{"5", "e", "char", "NO", "1", "1", "0", "0.00", "5", "5", "0", "0.00", "YES", "YES"},
+		{"6", "f", "int8", "NO", "8", "8", "3", "3.00", "6", "6", "30", "30.00", "YES", "YES"},
 	})
 }
 
 func TestGenerateReport_ReadmeExample(t *testing.T) {
 	columnList := []common.ColumnInfo{
 		{OrdinalPosition: 1, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
-		{OrdinalPosition: 2, ColumnName: "post_uid", DataType: "uuid", IsNullable: "NO", TypLen: 8, TypAlign: -1, EntryCount: 10},
-		{OrdinalPosition: 3, ColumnName: "author_uid", DataType: "uuid", IsNullable: "NO", TypLen: 8, TypAlign: -1, EntryCount: 10},
-		{OrdinalPosition: 4, ColumnName: "content", DataType: "text", IsNullable: "NO", TypLen: 1, TypAlign: -1, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "post_uid", DataType: "uuid", IsNullable: "NO", TypLen: 16, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 3, ColumnName: "author_uid", DataType: "uuid", IsNullable: "NO", TypLen: 16, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 4, ColumnName: "content", DataType: "text", IsNullable: "NO", TypLen: -1, TypAlign: 4, EntryCount: 10},
 		{OrdinalPosition: 5, ColumnName: "created_at", DataType: "timestamp without timezone", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
 		{OrdinalPosition: 6, ColumnName: "like_count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
 		{OrdinalPosition: 7, ColumnName: "comment_count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
 	}
 
 	generateReportTest(t, columnList, [][]string{
-		{"1", "id", "bigint", "NO", "8", "8", "0", "1", "0"},
-		{"2", "post_uid", "uuid", "NO", "8", "-1", "0", "5", "0"},
-		{"3", "author_uid", "uuid", "NO", "8", "-1", "0", "6", "0"},
-		{"4", "content", "text", "NO", "1", "-1", "9", "7", "90"},
-		{"5", "created_at", "timestamp without timezone", "NO", "8", "8", "0", "2", "0"},
-		{"6", "like_count", "integer", "NO", "4", "4", "0", "3", "0"},
-		{"7", "comment_count", "integer", "NO", "4", "4", "0", "4", "0"},
+		{"1", "id", "bigint", "NO", "8", "8", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "post_uid", "uuid", "NO", "16", "1", "0", "0.00", "2", "2", "0", "0.00", "YES", "YES"},
+		{"3", "author_uid", "uuid", "NO", "16", "1", "0", "0.00", "3", "3", "0", "0.00", "YES", "YES"},
+		{"4", "content", "text", "NO", "-1", "4", "0", "0.00", "7", "7", "0", "0.00", "YES", "YES"},
+		{"5", "created_at", "timestamp without timezone", "NO", "8", "8", "7", "3.50", "4", "4", "70", "35.00", "NO", "YES"},
+		{"6", "like_count", "integer", "NO", "4", "4", "0", "0.00", "5", "5", "0", "0.00", "NO", "YES"},
+		{"7", "comment_count", "integer", "NO", "4", "4", "0", "0.00", "6", "6", "0", "0.00", "NO", "YES"},
 	})
 }
 
+func TestGenerateReport_NullFraction(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "count", DataType: "integer", IsNullable: "YES", TypLen: 4, TypAlign: 4, EntryCount: 10, NullFrac: 0.5},
+		{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+	}
+
+	generateReportTest(t, columnList, [][]string{
+		{"1", "count", "integer", "YES", "4", "4", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "id", "bigint", "NO", "8", "8", "4", "2.00", "2", "2", "40", "20.00", "NO", "NO"},
+	})
+}
+
+func TestGenerateReport_Constraints(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "id", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "total", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+		{OrdinalPosition: 3, ColumnName: "created_at", DataType: "timestamp with time zone", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+		{OrdinalPosition: 4, ColumnName: "count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
+	}
+	constraints := layout.Constraints{
+		Pins: []layout.Pin{{Column: "id", Position: 1}, {Column: "total", Position: 2}},
+	}
+
+	generateConstrainedReportTest(t, columnList, constraints, [][]string{
+		{"1", "id", "integer", "NO", "4", "4", "0", "0.00", "1", "1", "0", "0.00", "YES", "YES"},
+		{"2", "total", "bigint", "NO", "8", "8", "4", "4.00", "3", "2", "40", "40.00", "YES", "YES"},
+		{"3", "created_at", "timestamp with time zone", "NO", "8", "8", "0", "0.00", "4", "3", "0", "0.00", "YES", "YES"},
+		{"4", "count", "integer", "NO", "4", "4", "0", "0.00", "2", "4", "0", "0.00", "YES", "YES"},
+	})
+}
+
+func TestGenerateReport_UnsatisfiableConstraints(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "id", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4},
+	}
+	constraints := layout.Constraints{Pins: []layout.Pin{{Column: "missing", Position: 1}}}
+
+	if _, err := GenerateReport(columnList, common.TableInfo{Name: "test_table"}, layout.Options{Constraints: constraints}, estimate.Throughput{}, NewCSVWriter(t.TempDir(), Run{}, SummaryOptions{})); err == nil {
+		t.Errorf("Expected an error for constraints naming a missing column")
+	}
+}
+
+func TestGenerateReport_Maintenance(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1},
+		{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+		{OrdinalPosition: 3, ColumnName: "count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4},
+	}
+	tableInfo := common.TableInfo{Name: "orders", RowCount: 1000, HeapSize: 7 * layout.BlockSize, ToastSize: 8192, IndexesSize: 2 * layout.BlockSize}
+	// Pinning id second keeps the 48 byte tuple instead of the recommended 40 bytes.
+	constraints := layout.Constraints{Pins: []layout.Pin{{Column: "id", Position: 2}}}
+
+	table, err := GenerateReport(columnList, tableInfo, layout.Options{Constraints: constraints}, estimate.Throughput{Copy: 8192, IndexBuild: 8192}, NewCSVWriter(t.TempDir(), Run{}, SummaryOptions{}))
+	if err != nil {
+		t.Fatalf("GenerateReport failed: %v", err)
+	}
+
+	newHeap := layout.HeapSize(1000, 48, 100)
+	assert.Equal(t, Maintenance{
+		HeapSize:          7 * layout.BlockSize,
+		ToastSize:         8192,
+		IndexesSize:       2 * layout.BlockSize,
+		NewHeapSize:       newHeap,
+		RewriteBytes:      newHeap + 3*layout.BlockSize,
+		TemporaryBytes:    2 * (newHeap + 3*layout.BlockSize),
+		CopySeconds:       float64(newHeap+8192) / 8192,
+		IndexBuildSeconds: 2,
+	}, table.Maintenance)
+}
+
 func generateReportTest(t *testing.T, columnList []common.ColumnInfo, expected [][]string) {
+	generateConstrainedReportTest(t, columnList, layout.Constraints{}, expected)
+}
+
+func generateConstrainedReportTest(t *testing.T, columnList []common.ColumnInfo, constraints layout.Constraints, expected [][]string) {
 	tmpDir := t.TempDir()
 	reportDir := createReportsDirectory(t, tmpDir)
 
@@ -175,10 +253,14 @@ func generateReportTest(t *testing.T, columnList []common.ColumnInfo, expected [
 
 	// Call GenerateReport
 	tableName := "test_table"
-	err = GenerateReport(columnList, tableName)
+	writer := NewCSVWriter("reports", Run{}, SummaryOptions{})
+	_, err = GenerateReport(columnList, common.TableInfo{Name: tableName}, layout.Options{Constraints: constraints}, estimate.Throughput{}, writer)
 	if err != nil {
 		t.Fatalf("GenerateReport failed: %v", err)
 	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closing the report writer failed: %v", err)
+	}
 
 	// Verify the report file exists
 	rows := readFile(t, tableName, reportDir)
@@ -241,3 +323,91 @@ func equalSlices(a, b []string) bool {
 	}
 	return true
 }
+
+func TestFormatEstimate(t *testing.T) {
+	totals := Totals{
+		NoNulls:           RowSize{HeaderSize: 24, DataSize: 16, TupleSize: 40},
+		WithNulls:         RowSize{HeaderSize: 24, DataSize: 12, TupleSize: 40},
+		ExpectedTupleSize: 38.5,
+		Recommended:       OrderTotals{TupleSize: 36, Objective: 36, LowerBound: 36, Optimal: true},
+	}
+
+	expected := "Table test_table: without NULLs header 24 B + data 16 B = tuple 40 B; with NULLs header 24 B + data 12 B = tuple 40 B; expected tuple 38.50 B, recommended order 36.00 B (optimal)"
+	if got := formatEstimate("test_table", totals); got != expected {
+		t.Errorf("Estimate mismatch. Expected %q, got %q", expected, got)
+	}
+}
+
+func TestFormatConstrainedEstimate(t *testing.T) {
+	totals := Totals{
+		Recommended: OrderTotals{TupleSize: 48},
+		Constrained: &OrderTotals{TupleSize: 56},
+	}
+
+	expected := "Table test_table: constrained order 56.00 B, 8.00 B more than the unconstrained order"
+	if got := formatConstrainedEstimate("test_table", totals); got != expected {
+		t.Errorf("Estimate mismatch. Expected %q, got %q", expected, got)
+	}
+}
+
+func TestFormatDeformScore(t *testing.T) {
+	totals := Totals{CacheableOffsets: 2, Recommended: OrderTotals{CacheableOffsets: 4}}
+
+	expected := "Table test_table: cacheable column offsets current 2/5, recommended order 4/5"
+	if got := formatDeformScore("test_table", 5, totals); got != expected {
+		t.Errorf("Deform score mismatch. Expected %q, got %q", expected, got)
+	}
+
+	totals.Constrained = &OrderTotals{CacheableOffsets: 3}
+	expected = "Table test_table: cacheable column offsets current 2/5, recommended order 4/5, constrained order 3/5"
+	if got := formatDeformScore("test_table", 5, totals); got != expected {
+		t.Errorf("Deform score mismatch. Expected %q, got %q", expected, got)
+	}
+}
+
+func TestFormatEstimate_LowerBound(t *testing.T) {
+	totals := Totals{
+		NoNulls:           RowSize{HeaderSize: 24, DataSize: 16, TupleSize: 40},
+		WithNulls:         RowSize{HeaderSize: 24, DataSize: 16, TupleSize: 40},
+		ExpectedTupleSize: 40,
+		Recommended:       OrderTotals{TupleSize: 36, Objective: 36, LowerBound: 35.25},
+	}
+
+	expected := "Table test_table: without NULLs header 24 B + data 16 B = tuple 40 B; with NULLs header 24 B + data 16 B = tuple 40 B; expected tuple 40.00 B, recommended order 36.00 B (within 0.75 B of optimal)"
+	if got := formatEstimate("test_table", totals); got != expected {
+		t.Errorf("Estimate mismatch. Expected %q, got %q", expected, got)
+	}
+}
+
+func TestBuildTableReport_Dependencies(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8},
+	}
+	tableInfo := common.TableInfo{
+		Name: "orders",
+		Dependencies: []common.DependencyInfo{
+			{Kind: "view", Name: "public.order_totals", Depth: 1},
+			{Kind: "inheritance child", Name: "public.orders_2023"},
+		},
+		ReferencedBy: []common.ConstraintInfo{{Name: "line_items_order_id_fkey", Type: "f", Table: "public.line_items"}},
+	}
+
+	table, err := BuildTableReport(columnList, tableInfo, layout.Options{})
+	if err != nil {
+		t.Fatalf("BuildTableReport failed: %v", err)
+	}
+
+	expected := []Dependency{
+		{Kind: "view", Name: "public.order_totals", Action: "recreate"},
+		{Kind: "inheritance child", Name: "public.orders_2023", Action: "manual"},
+		{Kind: "foreign key", Name: "line_items_order_id_fkey ON public.line_items", Action: "retarget"},
+	}
+	if fmt.Sprint(table.Dependencies) != fmt.Sprint(expected) {
+		t.Errorf("Dependencies mismatch. Expected %v, got %v", expected, table.Dependencies)
+	}
+
+	summary := "Table orders: 3 dependent objects, 1 to recreate, 1 to retarget, 0 to review, 1 needing manual work (inheritance child public.orders_2023)"
+	if got := formatDependencies("orders", table.Dependencies); got != summary {
+		t.Errorf("Dependency summary mismatch. Expected %q, got %q", summary, got)
+	}
+}
@@ -0,0 +1,161 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// SummaryOptions filters the tables listed in a run summary. The roll-up totals always
+// cover every analysed table.
+type SummaryOptions struct {
+	Top        int
+	MinSavings float64
+}
+
+// Summary ranks the tables of a run by the bytes a rewrite in the recommended order, or in
+// the constrained order when constraints apply, is expected to reclaim.
+type Summary struct {
+	Tables []SummaryRow  `json:"tables"`
+	Totals SummaryTotals `json:"totals"`
+}
+
+type SummaryRow struct {
+	Table             string  `json:"table"`
+	CurrentTupleSize  float64 `json:"currentTupleSize"`
+	OptimalTupleSize  float64 `json:"optimalTupleSize"`
+	RowCount          int     `json:"rowCount"`
+	ReclaimableBytes  float64 `json:"reclaimableBytes"`
+	PercentSaved      float64 `json:"percentSaved"`
+	TotalRelationSize int64   `json:"totalRelationSize"`
+	RewriteBytes      int64   `json:"rewriteBytes"`
+	TemporaryBytes    int64   `json:"temporaryBytes"`
+	MaintenanceHours  float64 `json:"maintenanceHours"`
+}
+
+type SummaryTotals struct {
+	Schema            string  `json:"schema"`
+	Tables            int     `json:"tables"`
+	Listed            int     `json:"listed"`
+	RowCount          int     `json:"rowCount"`
+	ReclaimableBytes  float64 `json:"reclaimableBytes"`
+	PercentSaved      float64 `json:"percentSaved"`
+	TotalRelationSize int64   `json:"totalRelationSize"`
+	RewriteBytes      int64   `json:"rewriteBytes"`
+	TemporaryBytes    int64   `json:"temporaryBytes"`
+	MaintenanceHours  float64 `json:"maintenanceHours"`
+}
+
+// BuildSummary compares the expected tuple size of each table in its current order and in
+// the order a rebuild would use. Tables reclaiming less than MinSavings bytes are left out, and at
+// most Top tables are listed when Top is positive.
+func BuildSummary(run Run, tables []TableReport, options SummaryOptions) Summary {
+	summary := Summary{
+		Tables: make([]SummaryRow, 0, len(tables)),
+		Totals: SummaryTotals{Schema: run.Schema, Tables: len(tables)},
+	}
+
+	var currentBytes float64
+	for _, table := range tables {
+		row := SummaryRow{
+			Table:             table.Name,
+			CurrentTupleSize:  table.Totals.ExpectedTupleSize,
+			OptimalTupleSize:  rebuiltTupleSize(table.Totals),
+			RowCount:          table.RowCount,
+			TotalRelationSize: table.TotalRelationSize,
+			RewriteBytes:      table.Maintenance.RewriteBytes,
+			TemporaryBytes:    table.Maintenance.TemporaryBytes,
+			MaintenanceHours:  table.Maintenance.Hours(),
+		}
+		row.ReclaimableBytes = (row.CurrentTupleSize - row.OptimalTupleSize) * float64(row.RowCount)
+		row.PercentSaved = percentOf(row.CurrentTupleSize-row.OptimalTupleSize, row.CurrentTupleSize)
+
+		summary.Totals.RowCount += row.RowCount
+		summary.Totals.ReclaimableBytes += row.ReclaimableBytes
+		summary.Totals.TotalRelationSize += row.TotalRelationSize
+		summary.Totals.RewriteBytes += row.RewriteBytes
+		// Tables are rebuilt one at a time, so the disk needed is that of the largest.
+		if row.TemporaryBytes > summary.Totals.TemporaryBytes {
+			summary.Totals.TemporaryBytes = row.TemporaryBytes
+		}
+		summary.Totals.MaintenanceHours += row.MaintenanceHours
+		currentBytes += row.CurrentTupleSize * float64(row.RowCount)
+
+		if row.ReclaimableBytes >= options.MinSavings {
+			summary.Tables = append(summary.Tables, row)
+		}
+	}
+	summary.Totals.PercentSaved = percentOf(summary.Totals.ReclaimableBytes, currentBytes)
+
+	sort.SliceStable(summary.Tables, func(i, j int) bool {
+		if summary.Tables[i].ReclaimableBytes != summary.Tables[j].ReclaimableBytes {
+			return summary.Tables[i].ReclaimableBytes > summary.Tables[j].ReclaimableBytes
+		}
+		return summary.Tables[i].Table < summary.Tables[j].Table
+	})
+	if options.Top > 0 && len(summary.Tables) > options.Top {
+		summary.Tables = summary.Tables[:options.Top]
+	}
+	summary.Totals.Listed = len(summary.Tables)
+
+	return summary
+}
+
+func percentOf(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole * 100
+}
+
+func formatSummary(totals SummaryTotals) string {
+	return fmt.Sprintf(
+		"Schema %s: %d tables analysed, %s B reclaimable (%s%% of tuple data) across %d rows, %d B total relation size",
+		totals.Schema, totals.Tables, formatBytes(totals.ReclaimableBytes), formatBytes(totals.PercentSaved), totals.RowCount, totals.TotalRelationSize,
+	)
+}
+
+var summaryHeader = []string{
+	"Table",
+	"Current Tuple Size (B)",
+	"Optimal Tuple Size (B)",
+	"Row Count",
+	"Reclaimable Space (B)",
+	"Saved (%)",
+	"Total Relation Size (B)",
+	"Rewrite Volume (B)",
+	"Temporary Disk (B)",
+	"Estimated Maintenance (h)",
+}
+
+func summaryRow(row SummaryRow) []string {
+	return []string{
+		row.Table,
+		formatBytes(row.CurrentTupleSize),
+		formatBytes(row.OptimalTupleSize),
+		strconv.Itoa(row.RowCount),
+		formatBytes(row.ReclaimableBytes),
+		formatBytes(row.PercentSaved),
+		strconv.FormatInt(row.TotalRelationSize, 10),
+		strconv.FormatInt(row.RewriteBytes, 10),
+		strconv.FormatInt(row.TemporaryBytes, 10),
+		formatHours(row.MaintenanceHours),
+	}
+}
+
+// summaryTotalsRow rolls the schema up into a final row. Tuple sizes are left blank as
+// they do not add up across tables.
+func summaryTotalsRow(totals SummaryTotals) []string {
+	return []string{
+		fmt.Sprintf("Total (%s, %d tables)", totals.Schema, totals.Tables),
+		"",
+		"",
+		strconv.Itoa(totals.RowCount),
+		formatBytes(totals.ReclaimableBytes),
+		formatBytes(totals.PercentSaved),
+		strconv.FormatInt(totals.TotalRelationSize, 10),
+		strconv.FormatInt(totals.RewriteBytes, 10),
+		strconv.FormatInt(totals.TemporaryBytes, 10),
+		formatHours(totals.MaintenanceHours),
+	}
+}
@@ -0,0 +1,117 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/estimate"
+	"main/pkg/layout"
+)
+
+func summaryTable(name string, current, optimal float64, rowCount int) TableReport {
+	return TableReport{
+		Name:              name,
+		RowCount:          rowCount,
+		TotalRelationSize: int64(rowCount) * 100,
+		Totals: Totals{
+			ExpectedTupleSize: current,
+			Recommended:       OrderTotals{TupleSize: optimal},
+		},
+	}
+}
+
+func TestBuildSummary(t *testing.T) {
+	tables := []TableReport{
+		summaryTable("small", 48, 40, 10),
+		summaryTable("large", 48, 40, 1000),
+		summaryTable("tight", 32, 32, 500),
+	}
+
+	current, optimal := 48.0, 40.0
+	saved := (current - optimal) / current * 100
+
+	summary := BuildSummary(Run{Schema: "public"}, tables, SummaryOptions{})
+	assert.Equal(t, []SummaryRow{
+		{Table: "large", CurrentTupleSize: 48, OptimalTupleSize: 40, RowCount: 1000, ReclaimableBytes: 8000, PercentSaved: saved, TotalRelationSize: 100000},
+		{Table: "small", CurrentTupleSize: 48, OptimalTupleSize: 40, RowCount: 10, ReclaimableBytes: 80, PercentSaved: saved, TotalRelationSize: 1000},
+		{Table: "tight", CurrentTupleSize: 32, OptimalTupleSize: 32, RowCount: 500, TotalRelationSize: 50000},
+	}, summary.Tables)
+
+	assert.Equal(t, "public", summary.Totals.Schema)
+	assert.Equal(t, 3, summary.Totals.Tables)
+	assert.Equal(t, 3, summary.Totals.Listed)
+	assert.Equal(t, 1510, summary.Totals.RowCount)
+	assert.Equal(t, 8080.0, summary.Totals.ReclaimableBytes)
+	assert.Equal(t, int64(151000), summary.Totals.TotalRelationSize)
+	assert.InDelta(t, 8080.0/(48*1010+32*500)*100, summary.Totals.PercentSaved, 1e-9)
+}
+
+func TestBuildSummary_Filters(t *testing.T) {
+	tables := []TableReport{
+		summaryTable("small", 48, 40, 10),
+		summaryTable("large", 48, 40, 1000),
+		summaryTable("medium", 48, 40, 100),
+	}
+
+	summary := BuildSummary(Run{Schema: "public"}, tables, SummaryOptions{MinSavings: 100})
+	assert.Len(t, summary.Tables, 2)
+	assert.Equal(t, "large", summary.Tables[0].Table)
+	assert.Equal(t, "medium", summary.Tables[1].Table)
+
+	summary = BuildSummary(Run{Schema: "public"}, tables, SummaryOptions{Top: 1})
+	assert.Len(t, summary.Tables, 1)
+	assert.Equal(t, "large", summary.Tables[0].Table)
+
+	// The totals still cover every table.
+	assert.Equal(t, 3, summary.Totals.Tables)
+	assert.Equal(t, 1, summary.Totals.Listed)
+	assert.Equal(t, 8880.0, summary.Totals.ReclaimableBytes)
+}
+
+func TestBuildSummary_Constrained(t *testing.T) {
+	table := summaryTable("orders", 48, 40, 100)
+	table.Totals.Constrained = &OrderTotals{TupleSize: 44}
+
+	summary := BuildSummary(Run{Schema: "public"}, []TableReport{table}, SummaryOptions{MinSavings: 500})
+
+	// Only the constrained order is ever emitted, so the summary promises its savings.
+	assert.Empty(t, summary.Tables)
+	assert.Equal(t, 400.0, summary.Totals.ReclaimableBytes)
+
+	summary = BuildSummary(Run{Schema: "public"}, []TableReport{table}, SummaryOptions{})
+	assert.Equal(t, 44.0, summary.Tables[0].OptimalTupleSize)
+}
+
+func TestCSVWriter_Summary(t *testing.T) {
+	columnList := []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "enabled", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, EntryCount: 10},
+		{OrdinalPosition: 2, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, EntryCount: 10},
+		{OrdinalPosition: 3, ColumnName: "count", DataType: "integer", IsNullable: "NO", TypLen: 4, TypAlign: 4, EntryCount: 10},
+	}
+
+	reportDir := t.TempDir()
+	writer := NewCSVWriter(reportDir, Run{Schema: "public"}, SummaryOptions{})
+	tableInfo := common.TableInfo{Name: "orders", RowCount: 10, TotalRelationSize: 16384, HeapSize: 8192, IndexesSize: 8192}
+	// Half an hour each to copy the single page of rows and to build the index.
+	throughput := estimate.Throughput{Copy: 8192.0 / 1800, IndexBuild: 8192.0 / 1800}
+	if _, err := GenerateReport(columnList, tableInfo, layout.Options{}, throughput, writer); err != nil {
+		t.Fatalf("GenerateReport failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Closing the report writer failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(reportDir, "summary.csv"))
+	if err != nil {
+		t.Fatalf("Failed to read summary file: %v", err)
+	}
+	assert.Equal(t,
+		"Table,Current Tuple Size (B),Optimal Tuple Size (B),Row Count,Reclaimable Space (B),Saved (%),Total Relation Size (B),Rewrite Volume (B),Temporary Disk (B),Estimated Maintenance (h)\n"+
+			"orders,48.00,40.00,10,80.00,16.67,16384,16384,32768,1.00\n"+
+			"\"Total (public, 1 tables)\",,,10,80.00,16.67,16384,16384,32768,1.00\n",
+		string(content))
+}
@@ -0,0 +1,41 @@
+package report
+
+import "fmt"
+
+// Writer renders table reports in one output format. WriteTable is called once per
+// analysed table and Close once the run is over, so formats that produce a single
+// document per run can write it out there.
+type Writer interface {
+	WriteTable(table TableReport) error
+	Close() error
+}
+
+// NewWriter returns the writer for format. output overrides where the report is written:
+// the directory of per-table files for CSV, or the file for single-document formats.
+// Every format ends with a summary of the run filtered by options.
+func NewWriter(format string, output string, run Run, options SummaryOptions) (Writer, error) {
+	switch format {
+	case "csv":
+		if output == "" {
+			output = "reports"
+		}
+		return NewCSVWriter(output, run, options), nil
+	case "json":
+		if output == "" {
+			output = "reports/report.json"
+		}
+		return NewJSONWriter(output, run, options), nil
+	case "markdown":
+		if output == "" {
+			output = "reports/report.md"
+		}
+		return NewMarkdownWriter(output, run, options), nil
+	case "html":
+		if output == "" {
+			output = "reports/report.html"
+		}
+		return NewHTMLWriter(output, run, options), nil
+	default:
+		return nil, fmt.Errorf("unsupported report format: %s", format)
+	}
+}
@@ -0,0 +1,88 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"main/pkg/common"
+)
+
+// Version is the version of the file format Write produces. Read rejects files of a
+// later version, whose fields it could silently drop.
+const Version = 1
+
+// Snapshot is what the analysis reads of a schema, captured in one session so that it can
+// be repeated without a connection to the database.
+type Snapshot struct {
+	Version       int       `json:"version"`
+	Database      string    `json:"database"`
+	Schema        string    `json:"schema"`
+	ServerVersion string    `json:"serverVersion"`
+	TakenAt       time.Time `json:"takenAt"`
+	Tables        []Table   `json:"tables"`
+}
+
+// Table is a table as the live introspection reads it: its columns with their statistics
+// and entry counts, and its definition with sizes, constraints, dependent objects and the
+// objects a rebuild carries over.
+type Table struct {
+	Columns []common.ColumnInfo `json:"columns"`
+	Info    common.TableInfo    `json:"info"`
+}
+
+// Table returns the table of the snapshot with the given name.
+func (s *Snapshot) Table(name string) (Table, bool) {
+	for _, table := range s.Tables {
+		if table.Info.Name == name {
+			return table, true
+		}
+	}
+	return Table{}, false
+}
+
+// TableNames returns the names of the snapshot's tables in the order they were captured.
+func (s *Snapshot) TableNames() []string {
+	names := make([]string, len(s.Tables))
+	for i, table := range s.Tables {
+		names[i] = table.Info.Name
+	}
+	return names
+}
+
+// Write encodes a snapshot as indented JSON.
+func Write(w io.Writer, s Snapshot) error {
+	s.Version = Version
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// Read decodes a snapshot that Write encoded.
+func Read(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if s.Version < 1 || s.Version > Version {
+		return nil, fmt.Errorf("snapshot version %d is not supported, expected 1 to %d", s.Version, Version)
+	}
+	return &s, nil
+}
+
+// Load reads the snapshot stored in a file.
+func Load(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,64 @@
+package snapshot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"main/pkg/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRead(t *testing.T) {
+	captured := Snapshot{
+		Database:      "shop",
+		Schema:        "sales",
+		ServerVersion: "16.2",
+		TakenAt:       time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC),
+		Tables: []Table{
+			{
+				Columns: []common.ColumnInfo{
+					{OrdinalPosition: 1, ColumnName: "id", DataType: "bigint", TypLen: 8, TypAlign: 8, Storage: "p", EntryCount: 120, NotNull: true},
+					{OrdinalPosition: 2, ColumnName: "note", DataType: "text", TypLen: -1, TypAlign: 4, Storage: "x", NullFrac: 0.25, AvgWidth: 14, EntryCount: 90},
+				},
+				Info: common.TableInfo{
+					Name:        "orders",
+					RowCount:    120,
+					HeapSize:    16384,
+					Constraints: []common.ConstraintInfo{{Name: "orders_pkey", Type: "p", Definition: "PRIMARY KEY (id)", Columns: []string{"id"}}},
+					Indexes:     []common.IndexInfo{{Name: "orders_note_idx", Definition: "CREATE INDEX orders_note_idx ON sales.orders USING btree (note)"}},
+				},
+			},
+			{Info: common.TableInfo{Name: "customers"}},
+		},
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(t, Write(&buffer, captured))
+	assert.Contains(t, buffer.String(), `"entryCount": 120`)
+
+	read, err := Read(&buffer)
+	assert.NoError(t, err)
+	captured.Version = Version
+	assert.Equal(t, captured, *read)
+
+	assert.Equal(t, []string{"orders", "customers"}, read.TableNames())
+	table, found := read.Table("orders")
+	assert.True(t, found)
+	assert.Equal(t, 0.25, table.Columns[1].NullFrac)
+	_, found = read.Table("invoices")
+	assert.False(t, found)
+}
+
+func TestRead_Errors(t *testing.T) {
+	_, err := Read(strings.NewReader(`{"version": 2, "tables": []}`))
+	assert.EqualError(t, err, "snapshot version 2 is not supported, expected 1 to 1")
+
+	_, err = Read(strings.NewReader(`{"schema": "public"}`))
+	assert.EqualError(t, err, "snapshot version 0 is not supported, expected 1 to 1")
+
+	_, err = Read(strings.NewReader(`CREATE TABLE t ();`))
+	assert.ErrorContains(t, err, "failed to decode snapshot")
+}
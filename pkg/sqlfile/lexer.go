@@ -0,0 +1,212 @@
+package sqlfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	// tokenWord is an unquoted identifier or keyword, folded to lower case as PostgreSQL
+	// folds them.
+	tokenWord tokenKind = iota
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+// token is a lexical token with its offsets in the source, so that expressions can be
+// carried over as they were written.
+type token struct {
+	kind  tokenKind
+	text  string
+	start int
+	end   int
+	line  int
+}
+
+// is reports whether the token is the unquoted keyword word.
+func (t token) is(word string) bool {
+	return t.kind == tokenWord && t.text == word
+}
+
+func (t token) isSymbol(symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+// tokenize splits src into statements of tokens. Comments, psql meta-commands and empty
+// statements are dropped. file names src in errors.
+func tokenize(file string, src string) ([][]token, error) {
+	var statements [][]token
+	var statement []token
+	line := 1
+	lineStart := true
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			lineStart = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+			continue
+		case c == '\\' && lineStart:
+			// A psql meta-command runs to the end of the line.
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		lineStart = false
+
+		start, startLine := i, line
+		add := func(kind tokenKind, text string) {
+			statement = append(statement, token{kind: kind, text: text, start: start, end: i, line: startLine})
+		}
+
+		switch {
+		case strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			depth := 0
+			for i < len(src) {
+				if strings.HasPrefix(src[i:], "/*") {
+					depth++
+					i += 2
+				} else if strings.HasPrefix(src[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					if src[i] == '\n' {
+						line++
+					}
+					i++
+				}
+			}
+			if depth > 0 {
+				return nil, errorAtLine(file, startLine, "unterminated comment")
+			}
+		case c == ';':
+			i++
+			if len(statement) > 0 {
+				statements = append(statements, statement)
+				statement = nil
+			}
+		case c == '\'' || ((c == 'E' || c == 'e') && i+1 < len(src) && src[i+1] == '\''):
+			escapes := c != '\''
+			if escapes {
+				i++
+			}
+			value, next, lines, err := quoted(src, i, '\'', escapes)
+			if err != nil {
+				return nil, errorAtLine(file, startLine, "%v", err)
+			}
+			i, line = next, line+lines
+			add(tokenString, value)
+		case c == '"':
+			value, next, lines, err := quoted(src, i, '"', false)
+			if err != nil {
+				return nil, errorAtLine(file, startLine, "%v", err)
+			}
+			i, line = next, line+lines
+			add(tokenQuotedIdent, value)
+		case c == '$' && dollarTag(src[i:]) != "":
+			tag := dollarTag(src[i:])
+			closing := strings.Index(src[i+len(tag):], tag)
+			if closing == -1 {
+				return nil, errorAtLine(file, startLine, "unterminated dollar-quoted string")
+			}
+			value := src[i+len(tag) : i+len(tag)+closing]
+			i += len(tag) + closing + len(tag)
+			line += strings.Count(value, "\n")
+			add(tokenString, value)
+		case isIdentStart(c):
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			add(tokenWord, strings.ToLower(src[start:i]))
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			for i < len(src) && (isIdentPart(src[i]) || src[i] == '.') {
+				i++
+			}
+			add(tokenNumber, src[start:i])
+		case strings.HasPrefix(src[i:], "::"):
+			i += 2
+			add(tokenSymbol, "::")
+		default:
+			i++
+			add(tokenSymbol, string(c))
+		}
+	}
+
+	if len(statement) > 0 {
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// quoted reads the string or identifier quoted with quote that starts at src[i], where a
+// doubled quote stands for itself. It returns the value, the offset after the closing
+// quote and the number of line breaks in between.
+func quoted(src string, i int, quote byte, escapes bool) (string, int, int, error) {
+	var value strings.Builder
+	lines := 0
+	for i++; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote && i+1 < len(src) && src[i+1] == quote:
+			value.WriteByte(quote)
+			i++
+		case c == quote:
+			return value.String(), i + 1, lines, nil
+		case c == '\\' && escapes && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				value.WriteByte(src[i])
+			}
+		default:
+			if c == '\n' {
+				lines++
+			}
+			value.WriteByte(c)
+		}
+	}
+	return "", i, lines, fmt.Errorf("unterminated quoted %s", map[byte]string{'\'': "string", '"': "identifier"}[quote])
+}
+
+// dollarTag returns the opening $tag$ of a dollar-quoted string at the start of s, or ""
+// when s does not start one.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1]
+		case !isIdentPart(s[i]) || (i == 1 && !isIdentStart(s[i])):
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
@@ -0,0 +1,39 @@
+package sqlfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	src := "\\set ON_ERROR_STOP on\n" +
+		"COMMENT ON TABLE \"Odd\"\"Name\" IS 'it''s; here' /* a; /* nested */ comment */;\n" +
+		"-- a comment;\n" +
+		";\n" +
+		"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;\n" +
+		"SELECT E'a\\'b', x::int"
+
+	statements, err := tokenize("f.sql", src)
+	if err != nil {
+		t.Fatalf("tokenize failed: %v", err)
+	}
+
+	assert.Len(t, statements, 3)
+	assert.Equal(t, token{kind: tokenQuotedIdent, text: `Odd"Name`, start: 39, end: 50, line: 2}, statements[0][3])
+	assert.Equal(t, token{kind: tokenString, text: "it's; here", start: 54, end: 67, line: 2}, statements[0][5])
+	assert.Equal(t, " SELECT 1; ", statements[1][8].text)
+	assert.Equal(t, 5, statements[1][0].line)
+	assert.Equal(t, []string{"select", "a'b", ",", "x", "::", "int"}, texts(statements[2]))
+
+	_, err = tokenize("f.sql", "SELECT 'open")
+	assert.EqualError(t, err, "f.sql:1: unterminated quoted string")
+}
+
+func texts(tokens []token) []string {
+	result := make([]string, len(tokens))
+	for i, t := range tokens {
+		result[i] = t.text
+	}
+	return result
+}
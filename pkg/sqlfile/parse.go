@@ -0,0 +1,1101 @@
+package sqlfile
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"main/pkg/common"
+	"main/pkg/ddl"
+)
+
+const defaultSchema = "public"
+
+// Table is a table as the statements read so far define it.
+type Table struct {
+	Schema  string
+	Info    common.TableInfo
+	Columns []common.ColumnInfo
+
+	// Appended maps the columns that ALTER TABLE added after the table was created to the
+	// file that added them. Those columns come last whatever their alignment, which is
+	// where padding creeps into a table that migrations grow.
+	Appended map[string]string
+}
+
+// Catalog collects the tables and types that SQL files define. Statements are applied in
+// the order they are read, so that a later ALTER TABLE changes a table created earlier.
+type Catalog struct {
+	tables []*Table
+	types  map[string]typeInfo
+
+	// searchPath is the schema unqualified names are created in, as set by SET search_path.
+	searchPath string
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{types: make(map[string]typeInfo), searchPath: defaultSchema}
+}
+
+// Parse applies the statements of src to the catalog: CREATE TABLE, ALTER TABLE, DROP
+// TABLE, DROP SCHEMA, COMMENT ON, CREATE TYPE, CREATE DOMAIN and SET search_path. Other
+// statements, and temporary tables, are skipped. file names src in errors.
+func (c *Catalog) Parse(file string, src string) error {
+	statements, err := tokenize(file, src)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		p := &parser{file: file, src: src, tokens: statement, endLine: statement[len(statement)-1].line}
+		if err := c.apply(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tables returns the tables in the order they were created, with their columns numbered
+// and their constraints listed as pg_constraint would list them.
+func (c *Catalog) Tables() []Table {
+	tables := make([]Table, 0, len(c.tables))
+	for _, table := range c.tables {
+		copied := Table{Schema: table.Schema, Info: table.Info, Columns: append([]common.ColumnInfo(nil), table.Columns...), Appended: maps.Clone(table.Appended)}
+		copied.Info.Constraints = append([]common.ConstraintInfo(nil), table.Info.Constraints...)
+
+		primaryKey := make(map[string]bool)
+		for _, constraint := range copied.Info.Constraints {
+			if constraint.Type == "p" {
+				for _, column := range constraint.Columns {
+					primaryKey[column] = true
+				}
+			}
+		}
+		for i := range copied.Columns {
+			col := &copied.Columns[i]
+			col.OrdinalPosition = i + 1
+			col.NotNull = col.NotNull || primaryKey[col.ColumnName]
+			col.IsNullable = "YES"
+			if col.NotNull {
+				col.IsNullable = "NO"
+			}
+		}
+
+		sort.SliceStable(copied.Info.Constraints, func(i, j int) bool {
+			a, b := copied.Info.Constraints[i], copied.Info.Constraints[j]
+			if a.Type != b.Type {
+				return strings.Index("pucfx", a.Type) < strings.Index("pucfx", b.Type)
+			}
+			return a.Name < b.Name
+		})
+		tables = append(tables, copied)
+	}
+	return tables
+}
+
+func (c *Catalog) apply(p *parser) error {
+	switch {
+	case p.accept("create"):
+		p.accept("or", "replace")
+		if !p.accept("global") {
+			p.accept("local")
+		}
+		unlogged := p.accept("unlogged")
+		temporary := !unlogged && (p.accept("temporary") || p.accept("temp"))
+		switch {
+		case p.accept("table"):
+			// A temporary table is gone at the end of the session that runs the file.
+			if temporary {
+				return nil
+			}
+			return c.createTable(p, unlogged)
+		case p.accept("type"):
+			return c.createType(p)
+		case p.accept("domain"):
+			return c.createDomain(p)
+		case p.accept("extension"):
+			return c.createExtension(p)
+		}
+	case p.accept("alter", "table"):
+		return c.alterTable(p)
+	case p.accept("drop", "table"):
+		return c.dropTables(p)
+	case p.accept("drop", "schema"):
+		return c.dropSchemas(p)
+	case p.accept("comment", "on"):
+		return c.comment(p)
+	case p.accept("set"):
+		if !p.accept("session") {
+			p.accept("local")
+		}
+		if p.accept("search_path") && (p.accept("to") || p.acceptSymbol("=")) {
+			if schema, err := p.ident(); err == nil {
+				c.searchPath = schema
+			}
+		}
+	}
+	return nil
+}
+
+// createTable adds a table from its column and constraint definitions. Tables created AS
+// a query, OF a type or as a partition have no column list to read and are skipped, as is
+// CREATE TABLE IF NOT EXISTS of a table that already exists.
+func (c *Catalog) createTable(p *parser, unlogged bool) error {
+	ifNotExists := p.accept("if", "not", "exists")
+	schema, name, err := c.qualifiedName(p)
+	if err != nil {
+		return err
+	}
+	if c.table(schema, name) != nil {
+		if ifNotExists {
+			return nil
+		}
+		return p.errorf("table %s.%s is created twice", schema, name)
+	}
+	table := &Table{Schema: schema, Info: common.TableInfo{Name: name, Unlogged: unlogged}, Appended: make(map[string]string)}
+
+	// A partition has the columns of its parent, and can only add constraints of its own.
+	if p.accept("partition", "of") {
+		parent, err := c.parentTable(p)
+		if err != nil {
+			return err
+		}
+		table.Columns = inheritedColumns(parent)
+	} else if !p.peek().isSymbol("(") {
+		return nil
+	}
+
+	if p.peek().isSymbol("(") {
+		elements, err := p.list()
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			if err := c.addElement(element, table); err != nil {
+				return err
+			}
+		}
+	}
+
+	for !p.done() {
+		switch {
+		case p.accept("inherits"):
+			// Inherited columns come first, in the order of the parents, and a column the
+			// table also declares itself keeps the place its parent gives it.
+			elements, err := p.list()
+			if err != nil {
+				return err
+			}
+			var columns []common.ColumnInfo
+			for _, element := range elements {
+				parent, err := c.parentTable(element)
+				if err != nil {
+					return err
+				}
+				for _, col := range inheritedColumns(parent) {
+					if slices.IndexFunc(columns, func(known common.ColumnInfo) bool { return known.ColumnName == col.ColumnName }) == -1 {
+						columns = append(columns, col)
+					}
+				}
+			}
+			for _, col := range table.Columns {
+				if i := slices.IndexFunc(columns, func(known common.ColumnInfo) bool { return known.ColumnName == col.ColumnName }); i != -1 {
+					columns[i] = col
+				} else {
+					columns = append(columns, col)
+				}
+			}
+			table.Columns = columns
+		case p.accept("with"):
+			if table.Info.Options, err = p.options(); err != nil {
+				return err
+			}
+		case p.peek().isSymbol("("):
+			if _, err := p.list(); err != nil {
+				return err
+			}
+		default:
+			p.next()
+		}
+	}
+
+	c.tables = append(c.tables, table)
+	return nil
+}
+
+// parentTable reads the name of a table that another inherits from or partitions.
+func (c *Catalog) parentTable(p *parser) (*Table, error) {
+	schema, name, err := c.qualifiedName(p)
+	if err != nil {
+		return nil, err
+	}
+	parent := c.table(schema, name)
+	if parent == nil {
+		return nil, p.errorf("unknown parent table %s.%s", schema, name)
+	}
+	return parent, nil
+}
+
+// inheritedColumns returns the columns of parent as a child table gets them: with their
+// types, NOT NULL and defaults, but without comments.
+func inheritedColumns(parent *Table) []common.ColumnInfo {
+	columns := make([]common.ColumnInfo, len(parent.Columns))
+	for i, col := range parent.Columns {
+		col.Comment = ""
+		columns[i] = col
+	}
+	return columns
+}
+
+// addElement adds a column, a table constraint or the columns of a LIKE clause.
+func (c *Catalog) addElement(p *parser, table *Table) error {
+	switch {
+	case p.empty():
+		return nil
+	case p.startsConstraint():
+		constraint, err := tableConstraint(p, table)
+		if err != nil {
+			return err
+		}
+		table.Info.Constraints = append(table.Info.Constraints, constraint)
+		return nil
+	case p.accept("like"):
+		schema, name, err := c.qualifiedName(p)
+		if err != nil {
+			return err
+		}
+		source := c.table(schema, name)
+		if source == nil {
+			return p.errorf("LIKE names unknown table %s.%s", schema, name)
+		}
+		for _, col := range source.Columns {
+			// LIKE copies names, types and NOT NULL; defaults and the rest only when asked to.
+			table.Columns = append(table.Columns, common.ColumnInfo{
+				ColumnName: col.ColumnName, DataType: col.DataType, FormattedType: col.FormattedType, TypLen: col.TypLen,
+				TypAlign: col.TypAlign, Storage: col.TypStorage, TypStorage: col.TypStorage, NotNull: col.NotNull,
+			})
+		}
+		return nil
+	}
+
+	col, constraints, err := c.column(p, table)
+	if err != nil {
+		return err
+	}
+	if table.column(col.ColumnName) != -1 {
+		return p.errorf("column %s of table %s is defined twice", col.ColumnName, table.Info.Name)
+	}
+	table.Columns = append(table.Columns, col)
+	table.Info.Constraints = append(table.Info.Constraints, constraints...)
+	return nil
+}
+
+// column reads a column definition and the constraints declared on it, named as
+// PostgreSQL names them when they have no name of their own.
+func (c *Catalog) column(p *parser, table *Table) (common.ColumnInfo, []common.ConstraintInfo, error) {
+	name, err := p.ident()
+	if err != nil {
+		return common.ColumnInfo{}, nil, err
+	}
+	columnType, err := c.columnType(p, table.Schema)
+	if err != nil {
+		return common.ColumnInfo{}, nil, err
+	}
+
+	col := common.ColumnInfo{ColumnName: name}
+	setType(&col, columnType)
+	if columnType.serial {
+		col.Default = fmt.Sprintf("nextval(%s::regclass)", ddl.QuoteLiteral(table.Info.Name+"_"+name+"_seq"))
+		col.NotNull = true
+	}
+
+	var constraints []common.ConstraintInfo
+	constraintName := ""
+	add := func(kind, defaultName, definition string) {
+		if constraintName == "" {
+			constraintName = defaultName
+		}
+		constraint := common.ConstraintInfo{Name: constraintName, Type: kind, Definition: definition}
+		if kind != "c" {
+			constraint.Columns = []string{name}
+		}
+		constraints = append(constraints, constraint)
+		constraintName = ""
+	}
+	suffix := func(clause string) error {
+		if len(constraints) == 0 {
+			return p.errorf("%s without a constraint", clause)
+		}
+		constraints[len(constraints)-1].Definition += " " + clause
+		return nil
+	}
+	prefix := table.Info.Name + "_" + name
+	column := "(" + ddl.QuoteIdent(name) + ")"
+
+	for !p.done() {
+		switch {
+		case p.accept("constraint"):
+			if constraintName, err = p.ident(); err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+		case p.accept("not", "null"):
+			col.NotNull = true
+		case p.accept("null"):
+		case p.accept("default"):
+			col.Default = p.expression()
+		case p.accept("collate"):
+			parts, err := p.nameParts()
+			if err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+			for i, part := range parts {
+				parts[i] = ddl.QuoteIdent(part)
+			}
+			col.Collation = strings.Join(parts, ".")
+		case p.accept("storage"):
+			storage := map[string]string{"plain": "p", "external": "e", "extended": "x", "main": "m", "default": col.TypStorage}[p.next().text]
+			if storage == "" {
+				return common.ColumnInfo{}, nil, p.errorf("unknown storage for column %s", name)
+			}
+			col.Storage = storage
+		case p.accept("compression"):
+			p.next()
+		case p.accept("generated"):
+			identity := "a"
+			if !p.accept("always") {
+				if !p.accept("by", "default") {
+					return common.ColumnInfo{}, nil, p.errorf("expected ALWAYS or BY DEFAULT after GENERATED")
+				}
+				identity = "d"
+			}
+			if !p.accept("as") {
+				return common.ColumnInfo{}, nil, p.errorf("expected AS after GENERATED")
+			}
+			if p.accept("identity") {
+				col.Identity = identity
+				col.NotNull = true
+				if p.peek().isSymbol("(") {
+					if _, err := p.list(); err != nil {
+						return common.ColumnInfo{}, nil, err
+					}
+				}
+				continue
+			}
+			expression, err := p.parenthesized()
+			if err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+			col.Generated = "s"
+			col.Default = expression
+			p.accept("stored")
+		case p.accept("check"):
+			expression, err := p.parenthesized()
+			if err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+			definition := "CHECK (" + expression + ")"
+			if p.accept("no", "inherit") {
+				definition += " NO INHERIT"
+			}
+			add("c", prefix+"_check", definition)
+		case p.accept("unique"):
+			definition := "UNIQUE " + column
+			if p.accept("nulls", "not", "distinct") {
+				definition = "UNIQUE NULLS NOT DISTINCT " + column
+			}
+			p.accept("nulls", "distinct")
+			p.expression()
+			add("u", prefix+"_key", definition)
+		case p.accept("primary", "key"):
+			p.expression()
+			col.NotNull = true
+			add("p", table.Info.Name+"_pkey", "PRIMARY KEY "+column)
+		case p.accept("references"):
+			from := p.pos
+			schema, referenced, err := c.qualifiedName(p)
+			if err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+			p.expression()
+			add("f", prefix+"_fkey", "FOREIGN KEY "+column+" REFERENCES "+p.text(from, p.pos))
+			if schema == table.Schema && referenced == table.Info.Name {
+				constraints[len(constraints)-1].Table = ddl.QualifiedName(table.Schema, table.Info.Name)
+			}
+		case p.accept("deferrable"):
+			if err := suffix("DEFERRABLE"); err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+		case p.accept("not", "deferrable"):
+			if err := suffix("NOT DEFERRABLE"); err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+		case p.accept("initially"):
+			if err := suffix("INITIALLY " + strings.ToUpper(p.next().text)); err != nil {
+				return common.ColumnInfo{}, nil, err
+			}
+		default:
+			return common.ColumnInfo{}, nil, p.errorf("unexpected %q in the definition of column %s", p.peek().text, name)
+		}
+	}
+	return col, constraints, nil
+}
+
+// tableConstraint reads a table constraint, keeping its definition as written.
+func tableConstraint(p *parser, table *Table) (common.ConstraintInfo, error) {
+	var constraint common.ConstraintInfo
+	if p.accept("constraint") {
+		name, err := p.ident()
+		if err != nil {
+			return constraint, err
+		}
+		constraint.Name = name
+	}
+
+	from := p.pos
+	suffix := ""
+	switch {
+	case p.accept("primary", "key"):
+		constraint.Type, suffix = "p", "pkey"
+	case p.accept("unique"):
+		constraint.Type, suffix = "u", "key"
+		p.accept("nulls", "distinct")
+		p.accept("nulls", "not", "distinct")
+	case p.accept("foreign", "key"):
+		constraint.Type, suffix = "f", "fkey"
+	case p.accept("check"):
+		constraint.Type, suffix = "c", "check"
+	case p.accept("exclude"):
+		constraint.Type, suffix = "x", "excl"
+	default:
+		return constraint, p.errorf("unexpected %q in a table constraint", p.peek().text)
+	}
+
+	if constraint.Type == "p" || constraint.Type == "u" || constraint.Type == "f" {
+		columns, err := p.identList()
+		if err != nil {
+			return constraint, err
+		}
+		constraint.Columns = columns
+	}
+	for !p.done() {
+		p.next()
+	}
+	constraint.Definition = p.text(from, p.pos)
+
+	if constraint.Name == "" {
+		parts := []string{table.Info.Name}
+		if constraint.Type == "u" || constraint.Type == "f" {
+			parts = append(parts, constraint.Columns...)
+		}
+		constraint.Name = strings.Join(append(parts, suffix), "_")
+	}
+	if constraint.Type == "f" && referencesTable(constraint.Definition, table) {
+		constraint.Table = ddl.QualifiedName(table.Schema, table.Info.Name)
+	}
+	return constraint, nil
+}
+
+// referencesTable reports whether a foreign key definition references table itself.
+func referencesTable(definition string, table *Table) bool {
+	statements, err := tokenize("", definition)
+	if err != nil || len(statements) != 1 {
+		return false
+	}
+	p := &parser{src: definition, tokens: statements[0]}
+	for !p.done() && !p.accept("references") {
+		p.next()
+	}
+	parts, err := p.nameParts()
+	if err != nil {
+		return false
+	}
+	schema := defaultSchema
+	if len(parts) > 1 {
+		schema = parts[len(parts)-2]
+	}
+	return parts[len(parts)-1] == table.Info.Name && (len(parts) == 1 || schema == table.Schema)
+}
+
+// alterTable applies the actions of ALTER TABLE that change columns, constraints or
+// options. Tables the catalog does not know are left alone.
+func (c *Catalog) alterTable(p *parser) error {
+	p.accept("if", "exists")
+	p.accept("only")
+	schema, name, err := c.qualifiedName(p)
+	if err != nil {
+		return err
+	}
+	table := c.table(schema, name)
+	if table == nil {
+		return nil
+	}
+	p.acceptSymbol("*")
+
+	for _, action := range p.split() {
+		if err := c.alterAction(action, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) alterAction(p *parser, table *Table) error {
+	switch {
+	case p.accept("add"):
+		if p.startsConstraint() {
+			constraint, err := tableConstraint(p, table)
+			if err != nil {
+				return err
+			}
+			table.Info.Constraints = append(table.Info.Constraints, constraint)
+			return nil
+		}
+		p.accept("column")
+		ifNotExists := p.accept("if", "not", "exists")
+		col, constraints, err := c.column(p, table)
+		if err != nil {
+			return err
+		}
+		if table.column(col.ColumnName) != -1 {
+			if ifNotExists {
+				return nil
+			}
+			return p.errorf("column %s of table %s is added twice", col.ColumnName, table.Info.Name)
+		}
+		table.Columns = append(table.Columns, col)
+		table.Info.Constraints = append(table.Info.Constraints, constraints...)
+		table.Appended[col.ColumnName] = p.file
+	case p.accept("drop"):
+		if p.accept("constraint") {
+			p.accept("if", "exists")
+			name, err := p.ident()
+			if err != nil {
+				return err
+			}
+			table.dropConstraints(func(constraint common.ConstraintInfo) bool { return constraint.Name == name })
+			return nil
+		}
+		p.accept("column")
+		p.accept("if", "exists")
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		// A dropped column keeps its place in existing rows until the table is rewritten;
+		// the analysis is of the table as a rebuild would lay it out.
+		if i := table.column(name); i != -1 {
+			table.Columns = append(table.Columns[:i], table.Columns[i+1:]...)
+			delete(table.Appended, name)
+			table.dropConstraints(func(constraint common.ConstraintInfo) bool {
+				for _, column := range constraint.Columns {
+					if column == name {
+						return true
+					}
+				}
+				return false
+			})
+		}
+	case p.accept("alter"):
+		p.accept("column")
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		i := table.column(name)
+		if i == -1 {
+			return p.errorf("table %s has no column %s", table.Info.Name, name)
+		}
+		col := &table.Columns[i]
+		switch {
+		case p.accept("set", "not", "null"):
+			col.NotNull = true
+		case p.accept("drop", "not", "null"):
+			col.NotNull = false
+		case p.accept("set", "default"):
+			col.Default = p.expression()
+		case p.accept("drop", "default"):
+			col.Default = ""
+		case p.accept("add", "generated"):
+			col.Identity = "a"
+			if !p.accept("always") {
+				p.accept("by", "default")
+				col.Identity = "d"
+			}
+			col.NotNull = true
+		case p.accept("drop", "identity"):
+			col.Identity = ""
+		case p.accept("set", "storage"):
+			storage := map[string]string{"plain": "p", "external": "e", "extended": "x", "main": "m", "default": col.TypStorage}[p.next().text]
+			if storage == "" {
+				return p.errorf("unknown storage for column %s", name)
+			}
+			col.Storage = storage
+		case p.accept("type") || p.accept("set", "data", "type"):
+			columnType, err := c.columnType(p, table.Schema)
+			if err != nil {
+				return err
+			}
+			setType(col, columnType)
+		}
+	case p.accept("rename"):
+		switch {
+		case p.accept("to"):
+			name, err := p.ident()
+			if err != nil {
+				return err
+			}
+			table.Info.Name = name
+		case p.accept("constraint"):
+			from, err := p.ident()
+			if err != nil {
+				return err
+			}
+			if !p.accept("to") {
+				return p.errorf("expected TO after RENAME CONSTRAINT")
+			}
+			to, err := p.ident()
+			if err != nil {
+				return err
+			}
+			for i := range table.Info.Constraints {
+				if table.Info.Constraints[i].Name == from {
+					table.Info.Constraints[i].Name = to
+				}
+			}
+		default:
+			p.accept("column")
+			from, err := p.ident()
+			if err != nil {
+				return err
+			}
+			if !p.accept("to") {
+				return p.errorf("expected TO after RENAME COLUMN")
+			}
+			to, err := p.ident()
+			if err != nil {
+				return err
+			}
+			if i := table.column(from); i != -1 {
+				table.Columns[i].ColumnName = to
+				if file, appended := table.Appended[from]; appended {
+					delete(table.Appended, from)
+					table.Appended[to] = file
+				}
+			}
+		}
+	case p.accept("owner", "to"):
+		owner, err := p.ident()
+		if err != nil {
+			return err
+		}
+		table.Info.Owner = owner
+	case p.accept("set", "schema"):
+		schema, err := p.ident()
+		if err != nil {
+			return err
+		}
+		table.Schema = schema
+	case p.accept("set", "unlogged"):
+		table.Info.Unlogged = true
+	case p.accept("set", "logged"):
+		table.Info.Unlogged = false
+	case p.accept("set"):
+		options, err := p.options()
+		if err != nil {
+			return err
+		}
+		table.Info.Options = mergeOptions(table.Info.Options, options)
+	}
+	return nil
+}
+
+func (c *Catalog) dropTables(p *parser) error {
+	p.accept("if", "exists")
+	for _, name := range p.split() {
+		schema, table, err := c.qualifiedName(name)
+		if err != nil {
+			return err
+		}
+		for i, known := range c.tables {
+			if known.Schema == schema && known.Info.Name == table {
+				c.tables = append(c.tables[:i], c.tables[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// dropSchemas drops the tables and types of the schemas that DROP SCHEMA ... CASCADE
+// drops. Without CASCADE only an empty schema can be dropped, which leaves nothing to do.
+func (c *Catalog) dropSchemas(p *parser) error {
+	p.accept("if", "exists")
+	schemas := make(map[string]bool)
+	for _, element := range p.split() {
+		name, err := element.ident()
+		if err != nil {
+			return err
+		}
+		schemas[name] = true
+		if element.accept("cascade") {
+			c.tables = slices.DeleteFunc(c.tables, func(table *Table) bool { return schemas[table.Schema] })
+			maps.DeleteFunc(c.types, func(name string, _ typeInfo) bool {
+				schema, _, _ := strings.Cut(name, ".")
+				return schemas[schema]
+			})
+		}
+	}
+	return nil
+}
+
+// comment sets the comments of tables and columns, which can carry ordering constraints.
+func (c *Catalog) comment(p *parser) error {
+	kind := p.next().text
+	if kind != "table" && kind != "column" {
+		return nil
+	}
+
+	parts, err := p.nameParts()
+	if err != nil {
+		return err
+	}
+	column := ""
+	if kind == "column" {
+		if len(parts) < 2 {
+			return p.errorf("COMMENT ON COLUMN needs a table and a column")
+		}
+		column, parts = parts[len(parts)-1], parts[:len(parts)-1]
+	}
+	schema, name := c.resolve(parts)
+
+	if !p.accept("is") {
+		return p.errorf("expected IS in COMMENT ON")
+	}
+	text := ""
+	if value := p.next(); value.kind == tokenString {
+		text = value.text
+	}
+
+	table := c.table(schema, name)
+	if table == nil {
+		return nil
+	}
+	if kind == "table" {
+		table.Info.Comment = text
+	} else if i := table.column(column); i != -1 {
+		table.Columns[i].Comment = text
+	}
+	return nil
+}
+
+// createType registers enum, composite and range types, which are laid out as the
+// catalog lays them out whatever their definition, and base types, which declare their
+// layout as pg_dump writes them. Shell types are skipped.
+func (c *Catalog) createType(p *parser) error {
+	schema, name, err := c.qualifiedName(p)
+	if err != nil {
+		return err
+	}
+
+	info := typeInfo{dataType: "USER-DEFINED", formatName: typeName(schema, name)}
+	if p.peek().isSymbol("(") {
+		if err := c.baseType(p, schema, &info); err != nil {
+			return err
+		}
+		c.types[schema+"."+name] = info
+		return nil
+	}
+	if !p.accept("as") {
+		return nil
+	}
+
+	switch {
+	case p.accept("enum"):
+		info.typLen, info.typAlign, info.typStorage = 4, 4, "p"
+	case p.accept("range"):
+		info.typLen, info.typAlign, info.typStorage = -1, 4, "x"
+		elements, err := p.list()
+		if err != nil {
+			return err
+		}
+		for _, element := range elements {
+			if element.accept("subtype") && element.acceptSymbol("=") {
+				subtype, err := c.columnType(element, schema)
+				if err != nil {
+					return err
+				}
+				_, align, _ := subtype.layout()
+				info.typAlign = max(info.typAlign, align)
+			}
+		}
+	case p.peek().isSymbol("("):
+		info.typLen, info.typAlign, info.typStorage = -1, 8, "x"
+	default:
+		return nil
+	}
+	c.types[schema+"."+name] = info
+	return nil
+}
+
+// baseType reads the layout a base type declares, which defaults to a 4-byte int-aligned
+// plain type as CREATE TYPE does.
+func (c *Catalog) baseType(p *parser, schema string, info *typeInfo) error {
+	info.typLen, info.typAlign, info.typStorage = 4, 4, "p"
+	elements, err := p.list()
+	if err != nil {
+		return err
+	}
+	for _, element := range elements {
+		option := element.next().text
+		if !element.acceptSymbol("=") {
+			continue
+		}
+		switch option {
+		case "internallength":
+			// A variable length is written as VARIABLE, and as -1 by some extension scripts.
+			if element.accept("variable") {
+				info.typLen = -1
+				continue
+			}
+			sign := 1
+			if element.acceptSymbol("-") {
+				sign = -1
+			}
+			length, err := strconv.Atoi(element.next().text)
+			if err != nil || length*sign < -1 || length == 0 {
+				return element.errorf("invalid INTERNALLENGTH of type %s", info.formatName)
+			}
+			info.typLen = length * sign
+		case "alignment":
+			alignment := map[string]int{"char": 1, "int2": 2, "int4": 4, "double": 8}[element.next().text]
+			if alignment == 0 {
+				return element.errorf("invalid ALIGNMENT of type %s", info.formatName)
+			}
+			info.typAlign = alignment
+		case "storage":
+			storage := map[string]string{"plain": "p", "external": "e", "extended": "x", "main": "m"}[element.next().text]
+			if storage == "" {
+				return element.errorf("invalid STORAGE of type %s", info.formatName)
+			}
+			info.typStorage = storage
+		case "like":
+			like, err := c.columnType(element, schema)
+			if err != nil {
+				return err
+			}
+			info.typLen, info.typAlign, info.typStorage = like.layout()
+		}
+	}
+	return nil
+}
+
+// createExtension registers the column types of the well-known extensions that define
+// them, which pg_dump leaves out of a dump as the extension creates them.
+func (c *Catalog) createExtension(p *parser) error {
+	p.accept("if", "not", "exists")
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	schema := c.searchPath
+	for !p.done() {
+		if p.accept("schema") {
+			if schema, err = p.ident(); err != nil {
+				return err
+			}
+			continue
+		}
+		p.next()
+	}
+
+	for typ, info := range extensionTypes[name] {
+		info.formatName = typeName(schema, typ)
+		c.types[schema+"."+typ] = info
+	}
+	return nil
+}
+
+// createDomain registers a domain, which is laid out as its base type.
+func (c *Catalog) createDomain(p *parser) error {
+	schema, name, err := c.qualifiedName(p)
+	if err != nil {
+		return err
+	}
+	p.accept("as")
+	base, err := c.columnType(p, schema)
+	if err != nil {
+		return err
+	}
+
+	info := typeInfo{dataType: base.dataType(), formatName: typeName(schema, name)}
+	info.typLen, info.typAlign, info.typStorage = base.layout()
+	c.types[schema+"."+name] = info
+	return nil
+}
+
+// columnType reads a type name, with its modifiers and array bounds, and resolves it
+// against the built-in types and the types the catalog has read.
+func (c *Catalog) columnType(p *parser, schema string) (columnType, error) {
+	start := p.peek()
+	parts, err := p.nameParts()
+	if err != nil {
+		return columnType{}, err
+	}
+	name := parts[len(parts)-1]
+	qualified := len(parts) > 1 && parts[len(parts)-2] != "pg_catalog"
+	unquoted := start.kind == tokenWord && len(parts) == 1
+
+	var resolved columnType
+	switch {
+	case qualified:
+	case unquoted && name == "double" && p.accept("precision"):
+		name = "double precision"
+	case unquoted && (name == "character" || name == "char" || name == "bit") && p.accept("varying"):
+		name = map[string]string{"character": "character varying", "char": "character varying", "bit": "bit varying"}[name]
+	case unquoted && name == "char":
+		name = "character"
+	case unquoted && (name == "time" || name == "timestamp"):
+		if p.peek().isSymbol("(") {
+			if resolved.modifier, err = p.modifier(); err != nil {
+				return columnType{}, err
+			}
+		}
+		if p.accept("with", "time", "zone") {
+			name += " with time zone"
+		} else {
+			p.accept("without", "time", "zone")
+		}
+	case unquoted && name == "interval":
+		// The fields limit what the value holds, not how it is stored.
+		for p.accept("year") || p.accept("month") || p.accept("day") || p.accept("hour") ||
+			p.accept("minute") || p.accept("second") || p.accept("to") {
+		}
+	case unquoted && name == "float":
+		if p.peek().isSymbol("(") {
+			precision, err := p.modifier()
+			if err != nil {
+				return columnType{}, err
+			}
+			if bits, err := strconv.Atoi(precision); err == nil && bits <= 24 {
+				name = "real"
+			}
+		}
+	}
+
+	if p.peek().isSymbol("(") {
+		if resolved.modifier, err = p.modifier(); err != nil {
+			return columnType{}, err
+		}
+	}
+	for p.peek().isSymbol("[") || p.peek().is("array") {
+		resolved.array = true
+		p.accept("array")
+		if p.acceptSymbol("[") {
+			for !p.done() && !p.acceptSymbol("]") {
+				p.next()
+			}
+		}
+	}
+
+	if base, serial := serialTypes[name]; serial && !qualified {
+		resolved.info, resolved.serial = builtinTypes[base], true
+		return resolved, nil
+	}
+	if alias, found := typeAliases[name]; found && !qualified {
+		name = alias
+	}
+	if info, found := builtinTypes[name]; found && !qualified {
+		if name == "numeric" && resolved.modifier != "" && !strings.Contains(resolved.modifier, ",") {
+			resolved.modifier += ",0"
+		}
+		resolved.info = info
+		return resolved, nil
+	}
+
+	candidates := []string{schema + "." + name, defaultSchema + "." + name}
+	if qualified {
+		candidates = []string{parts[len(parts)-2] + "." + name}
+	}
+	for _, candidate := range candidates {
+		if info, found := c.types[candidate]; found {
+			resolved.info = info
+			return resolved, nil
+		}
+	}
+	return columnType{}, p.errorAt(start, "unknown type %s, only built-in types and the enums, composite types, ranges and domains created in the input are known", strings.Join(parts, "."))
+}
+
+func setType(col *common.ColumnInfo, columnType columnType) {
+	col.DataType = columnType.dataType()
+	col.FormattedType = columnType.formatted()
+	col.TypLen, col.TypAlign, col.TypStorage = columnType.layout()
+	col.Storage = col.TypStorage
+}
+
+// qualifiedName reads a table or type name and returns its schema, which is the one of
+// the search path when the name is not qualified.
+func (c *Catalog) qualifiedName(p *parser) (string, string, error) {
+	parts, err := p.nameParts()
+	if err != nil {
+		return "", "", err
+	}
+	schema, name := c.resolve(parts)
+	return schema, name, nil
+}
+
+func (c *Catalog) resolve(parts []string) (string, string) {
+	if len(parts) == 1 {
+		return c.searchPath, parts[0]
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
+
+func (c *Catalog) table(schema, name string) *Table {
+	for _, table := range c.tables {
+		if table.Schema == schema && table.Info.Name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+func (t *Table) column(name string) int {
+	for i, col := range t.Columns {
+		if col.ColumnName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *Table) dropConstraints(drop func(constraint common.ConstraintInfo) bool) {
+	kept := t.Info.Constraints[:0]
+	for _, constraint := range t.Info.Constraints {
+		if !drop(constraint) {
+			kept = append(kept, constraint)
+		}
+	}
+	t.Info.Constraints = kept
+}
+
+// mergeOptions sets options over existing, both as array_to_string renders reloptions.
+func mergeOptions(existing, options string) string {
+	var merged []string
+	set := make(map[string]bool)
+	for _, option := range strings.Split(options, ", ") {
+		name, _, _ := strings.Cut(option, "=")
+		set[name] = true
+	}
+	for _, option := range strings.Split(existing, ", ") {
+		if name, _, _ := strings.Cut(option, "="); option != "" && !set[name] {
+			merged = append(merged, option)
+		}
+	}
+	if options != "" {
+		merged = append(merged, options)
+	}
+	return strings.Join(merged, ", ")
+}
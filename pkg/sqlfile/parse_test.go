@@ -0,0 +1,350 @@
+package sqlfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+)
+
+const ordersSQL = `
+-- Orders, as the first migration creates them.
+CREATE TYPE order_status AS ENUM ('new', 'paid');
+CREATE DOMAIN cents AS bigint CHECK (VALUE >= 0);
+
+CREATE UNLOGGED TABLE IF NOT EXISTS orders (
+    id bigserial PRIMARY KEY,
+    paid boolean NOT NULL DEFAULT false,
+    status order_status,
+    total cents,
+    created_at timestamp(3) with time zone NOT NULL DEFAULT now(),
+    note varchar(200) COLLATE "C",
+    tags text[],
+    parent_id bigint REFERENCES orders (id) ON DELETE CASCADE,
+    CONSTRAINT orders_total_check CHECK (total < 1000000)
+) WITH (fillfactor = 90);
+
+COMMENT ON COLUMN orders.id IS '@pin:first';
+`
+
+func TestCatalog_CreateTable(t *testing.T) {
+	catalog := NewCatalog()
+	if err := catalog.Parse("orders.sql", ordersSQL); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tables := catalog.Tables()
+	assert.Len(t, tables, 1)
+	table := tables[0]
+	assert.Equal(t, "public", table.Schema)
+	assert.Equal(t, "orders", table.Info.Name)
+	assert.True(t, table.Info.Unlogged)
+	assert.Equal(t, "fillfactor=90", table.Info.Options)
+
+	assert.Equal(t, []common.ColumnInfo{
+		{OrdinalPosition: 1, ColumnName: "id", DataType: "bigint", IsNullable: "NO", TypLen: 8, TypAlign: 8, Storage: "p", TypStorage: "p",
+			FormattedType: "bigint", Default: "nextval('orders_id_seq'::regclass)", NotNull: true, Comment: "@pin:first"},
+		{OrdinalPosition: 2, ColumnName: "paid", DataType: "boolean", IsNullable: "NO", TypLen: 1, TypAlign: 1, Storage: "p", TypStorage: "p",
+			FormattedType: "boolean", Default: "false", NotNull: true},
+		{OrdinalPosition: 3, ColumnName: "status", DataType: "USER-DEFINED", IsNullable: "YES", TypLen: 4, TypAlign: 4, Storage: "p", TypStorage: "p",
+			FormattedType: "order_status"},
+		{OrdinalPosition: 4, ColumnName: "total", DataType: "bigint", IsNullable: "YES", TypLen: 8, TypAlign: 8, Storage: "p", TypStorage: "p",
+			FormattedType: "cents"},
+		{OrdinalPosition: 5, ColumnName: "created_at", DataType: "timestamp with time zone", IsNullable: "NO", TypLen: 8, TypAlign: 8, Storage: "p", TypStorage: "p",
+			FormattedType: "timestamp(3) with time zone", Default: "now()", NotNull: true},
+		{OrdinalPosition: 6, ColumnName: "note", DataType: "character varying", IsNullable: "YES", TypLen: -1, TypAlign: 4, Storage: "x", TypStorage: "x",
+			FormattedType: "character varying(200)", Collation: `"C"`},
+		{OrdinalPosition: 7, ColumnName: "tags", DataType: "ARRAY", IsNullable: "YES", TypLen: -1, TypAlign: 4, Storage: "x", TypStorage: "x",
+			FormattedType: "text[]"},
+		{OrdinalPosition: 8, ColumnName: "parent_id", DataType: "bigint", IsNullable: "YES", TypLen: 8, TypAlign: 8, Storage: "p", TypStorage: "p",
+			FormattedType: "bigint"},
+	}, table.Columns)
+
+	assert.Equal(t, []common.ConstraintInfo{
+		{Name: "orders_pkey", Type: "p", Definition: "PRIMARY KEY (id)", Columns: []string{"id"}},
+		{Name: "orders_total_check", Type: "c", Definition: "CHECK (total < 1000000)"},
+		{Name: "orders_parent_id_fkey", Type: "f", Definition: "FOREIGN KEY (parent_id) REFERENCES orders (id) ON DELETE CASCADE", Columns: []string{"parent_id"}, Table: "public.orders"},
+	}, table.Info.Constraints)
+}
+
+func TestCatalog_AlterTable(t *testing.T) {
+	catalog := NewCatalog()
+	if err := catalog.Parse("001.sql", ordersSQL); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	err := catalog.Parse("002.sql", `
+ALTER TABLE ONLY public.orders
+    ADD COLUMN IF NOT EXISTS shipped_at timestamptz,
+    ADD COLUMN amount numeric(12) NOT NULL,
+    ADD CONSTRAINT orders_note_key UNIQUE (note),
+    DROP COLUMN tags,
+    ALTER COLUMN status TYPE smallint,
+    SET (fillfactor = 70, autovacuum_enabled = false);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS paid boolean;
+ALTER TABLE unknown ADD COLUMN ignored int;
+CREATE INDEX orders_paid_idx ON orders (paid);
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	table := catalog.Tables()[0]
+	names := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		names[i] = col.ColumnName
+	}
+	assert.Equal(t, []string{"id", "paid", "status", "total", "created_at", "note", "parent_id", "shipped_at", "amount"}, names)
+	assert.Equal(t, "smallint", table.Columns[2].FormattedType)
+	assert.Equal(t, 2, table.Columns[2].TypAlign)
+	assert.Equal(t, "timestamp with time zone", table.Columns[7].FormattedType)
+	assert.Equal(t, "numeric(12,0)", table.Columns[8].FormattedType)
+	assert.Equal(t, "NO", table.Columns[8].IsNullable)
+	assert.Equal(t, "fillfactor=70, autovacuum_enabled=false", table.Info.Options)
+	assert.Contains(t, table.Info.Constraints, common.ConstraintInfo{Name: "orders_note_key", Type: "u", Definition: "UNIQUE (note)", Columns: []string{"note"}})
+	assert.Equal(t, map[string]string{"shipped_at": "002.sql", "amount": "002.sql"}, table.Appended)
+}
+
+func TestCatalog_CreateTableIfNotExists(t *testing.T) {
+	catalog := NewCatalog()
+	if err := catalog.Parse("001.sql", ordersSQL); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// Rerunning the migration leaves the table as it was.
+	if err := catalog.Parse("002.sql", "CREATE TABLE IF NOT EXISTS public.orders (id int);"); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tables := catalog.Tables()
+	assert.Len(t, tables, 1)
+	assert.Len(t, tables[0].Columns, 8)
+	assert.Equal(t, "bigint", tables[0].Columns[0].FormattedType)
+
+	err := catalog.Parse("003.sql", "\nCREATE TABLE orders (id int);")
+	assert.EqualError(t, err, "003.sql:2: table public.orders is created twice")
+}
+
+func TestCatalog_SearchPathAndDrop(t *testing.T) {
+	catalog := NewCatalog()
+	err := catalog.Parse("schema.sql", `
+SET search_path TO sales, public;
+CREATE TABLE "Line Items" (order_id int, LIKE templates.audit);
+CREATE TABLE templates.audit (created_at timestamp);
+CREATE TABLE scratch (id int);
+DROP TABLE IF EXISTS scratch CASCADE;
+`)
+	assert.ErrorContains(t, err, "schema.sql:3: LIKE names unknown table templates.audit")
+
+	catalog = NewCatalog()
+	err = catalog.Parse("schema.sql", `
+SET search_path TO sales, public;
+CREATE TABLE templates.audit (created_at timestamp);
+CREATE TABLE "Line Items" (order_id int, LIKE templates.audit);
+CREATE TABLE scratch (id int);
+DROP TABLE IF EXISTS scratch CASCADE;
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tables := catalog.Tables()
+	assert.Len(t, tables, 2)
+	assert.Equal(t, "sales", tables[1].Schema)
+	assert.Equal(t, "Line Items", tables[1].Info.Name)
+	assert.Equal(t, "created_at", tables[1].Columns[1].ColumnName)
+	assert.Equal(t, "timestamp without time zone", tables[1].Columns[1].FormattedType)
+}
+
+func TestCatalog_SchemasAndTemporaryTables(t *testing.T) {
+	catalog := NewCatalog()
+	err := catalog.Parse("schema.sql", `
+CREATE SCHEMA archive;
+CREATE SCHEMA staging;
+CREATE TABLE orders (id bigint);
+ALTER TABLE orders SET SCHEMA archive;
+ALTER TABLE archive.orders ADD COLUMN note text;
+CREATE TYPE staging.mood AS ENUM ('ok');
+CREATE TABLE staging.imports (id int, mood staging.mood);
+CREATE TEMP TABLE scratch (id int);
+CREATE TEMPORARY TABLE orders (id int);
+DROP SCHEMA IF EXISTS staging CASCADE;
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tables := catalog.Tables()
+	assert.Len(t, tables, 1)
+	assert.Equal(t, "archive", tables[0].Schema)
+	assert.Equal(t, "orders", tables[0].Info.Name)
+	assert.Len(t, tables[0].Columns, 2)
+
+	err = catalog.Parse("types.sql", "CREATE TABLE moods (mood staging.mood);")
+	assert.ErrorContains(t, err, "types.sql:1: unknown type staging.mood")
+}
+
+func TestCatalog_ErrorAtEndOfStatement(t *testing.T) {
+	catalog := NewCatalog()
+	err := catalog.Parse("f.sql", "CREATE TABLE orders (id int);\n\nALTER TABLE orders\n    ALTER COLUMN id SET DATA TYPE;")
+	assert.EqualError(t, err, `f.sql:4: expected a name, found ""`)
+}
+
+func TestCatalog_UnknownType(t *testing.T) {
+	catalog := NewCatalog()
+	err := catalog.Parse("geo.sql", "CREATE TABLE places (\n    id int,\n    location geometry(Point, 4326)\n);")
+	assert.EqualError(t, err, "geo.sql:3: unknown type geometry, only built-in types and the enums, composite types, ranges and domains created in the input are known")
+}
+
+// pgDumpSQL is trimmed pg_dump --schema-only output of PostgreSQL 16.
+const pgDumpSQL = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+SET client_encoding = 'UTF8';
+SET standard_conforming_strings = on;
+SELECT pg_catalog.set_config('search_path', '', false);
+SET check_function_bodies = false;
+
+CREATE SCHEMA sales;
+
+ALTER SCHEMA sales OWNER TO app;
+
+CREATE EXTENSION IF NOT EXISTS citext WITH SCHEMA public;
+
+COMMENT ON EXTENSION citext IS 'data type for case-insensitive character strings';
+
+CREATE TYPE sales.money_pair AS (
+	amount numeric,
+	currency character(3)
+);
+
+CREATE TYPE public.mood AS ENUM (
+    'sad',
+    'happy'
+);
+
+CREATE TYPE public.point3;
+
+CREATE FUNCTION public.point3_in(cstring) RETURNS public.point3
+    LANGUAGE c IMMUTABLE STRICT
+    AS '$libdir/point3', 'point3_in';
+
+CREATE TYPE public.point3 (
+    INTERNALLENGTH = 24,
+    INPUT = public.point3_in,
+    OUTPUT = public.point3_out,
+    ALIGNMENT = double,
+    STORAGE = plain
+);
+
+CREATE DOMAIN sales.cents AS bigint
+	CONSTRAINT cents_check CHECK ((VALUE >= 0));
+
+SET default_tablespace = '';
+
+SET default_table_access_method = heap;
+
+CREATE TABLE sales.orders (
+    id bigint NOT NULL,
+    email public.citext,
+    mood public.mood,
+    total sales.cents,
+    price sales.money_pair,
+    location public.point3,
+    code text COLLATE pg_catalog."C"
+)
+WITH (fillfactor='80');
+
+ALTER TABLE sales.orders OWNER TO app;
+
+CREATE TABLE sales.archived_orders (
+    archived_at timestamp without time zone
+)
+INHERITS (sales.orders);
+
+CREATE SEQUENCE sales.orders_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE sales.orders ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME sales.orders_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+ALTER TABLE ONLY sales.orders
+    ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+
+CREATE INDEX orders_email_idx ON sales.orders USING btree (email);
+
+--
+-- PostgreSQL database dump complete
+--
+`
+
+func TestCatalog_PgDump(t *testing.T) {
+	catalog := NewCatalog()
+	if err := catalog.Parse("dump.sql", pgDumpSQL); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tables := catalog.Tables()
+	assert.Len(t, tables, 2)
+	orders, archived := tables[0], tables[1]
+	assert.Equal(t, "sales", orders.Schema)
+	assert.Equal(t, "app", orders.Info.Owner)
+	assert.Equal(t, "fillfactor=80", orders.Info.Options)
+	assert.Equal(t, []common.ConstraintInfo{{Name: "orders_pkey", Type: "p", Definition: "PRIMARY KEY (id)", Columns: []string{"id"}}}, orders.Info.Constraints)
+
+	type column struct {
+		name, dataType, formatted string
+		typLen, typAlign          int
+		storage                   string
+	}
+	var columns []column
+	for _, col := range orders.Columns {
+		columns = append(columns, column{col.ColumnName, col.DataType, col.FormattedType, col.TypLen, col.TypAlign, col.TypStorage})
+	}
+	assert.Equal(t, []column{
+		{"id", "bigint", "bigint", 8, 8, "p"},
+		{"email", "USER-DEFINED", "citext", -1, 4, "x"},
+		{"mood", "USER-DEFINED", "mood", 4, 4, "p"},
+		{"total", "bigint", "sales.cents", 8, 8, "p"},
+		{"price", "USER-DEFINED", "sales.money_pair", -1, 8, "x"},
+		{"location", "USER-DEFINED", "point3", 24, 8, "p"},
+		{"code", "text", "text", -1, 4, "x"},
+	}, columns)
+	assert.Equal(t, "a", orders.Columns[0].Identity)
+	assert.Equal(t, `pg_catalog."C"`, orders.Columns[6].Collation)
+
+	names := make([]string, len(archived.Columns))
+	for i, col := range archived.Columns {
+		names[i] = col.ColumnName
+	}
+	assert.Equal(t, []string{"id", "email", "mood", "total", "price", "location", "code", "archived_at"}, names)
+}
+
+func TestCatalog_Partition(t *testing.T) {
+	catalog := NewCatalog()
+	err := catalog.Parse("partitions.sql", `
+CREATE TABLE events (id bigint NOT NULL, at date NOT NULL) PARTITION BY RANGE (at);
+CREATE TABLE events_2024 PARTITION OF events (CONSTRAINT events_2024_id_check CHECK (id > 0))
+    FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	partition := catalog.Tables()[1]
+	assert.Equal(t, "events_2024", partition.Info.Name)
+	assert.Len(t, partition.Columns, 2)
+	assert.Equal(t, "at", partition.Columns[1].ColumnName)
+	assert.Equal(t, "CHECK (id > 0)", partition.Info.Constraints[0].Definition)
+}
@@ -0,0 +1,274 @@
+package sqlfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// constraintKeywords start the clauses of a column definition, and so end the
+// expression of the clause before them.
+var constraintKeywords = map[string]bool{
+	"constraint": true, "not": true, "null": true, "check": true, "default": true, "generated": true, "unique": true,
+	"primary": true, "references": true, "collate": true, "storage": true, "compression": true, "deferrable": true,
+	"initially": true,
+}
+
+// parser reads the tokens of one statement, or of one part of it.
+type parser struct {
+	file   string
+	src    string
+	tokens []token
+	pos    int
+
+	// endLine is the line the statement ends on, where running out of tokens is reported.
+	endLine int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) empty() bool {
+	return len(p.tokens) == 0
+}
+
+// peek returns the next token, or an empty symbol at the end.
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: tokenSymbol}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if !p.done() {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next tokens if they are the keywords words.
+func (p *parser) accept(words ...string) bool {
+	if p.pos+len(words) > len(p.tokens) {
+		return false
+	}
+	for i, word := range words {
+		if !p.tokens[p.pos+i].is(word) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if p.peek().isSymbol(symbol) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// startsConstraint reports whether a table constraint starts at the next token.
+func (p *parser) startsConstraint() bool {
+	t := p.peek()
+	return t.is("constraint") || t.is("primary") || t.is("unique") || t.is("check") || t.is("foreign") || t.is("exclude")
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenQuotedIdent {
+		return "", p.errorAt(t, "expected a name, found %q", t.text)
+	}
+	return t.text, nil
+}
+
+// nameParts reads a possibly qualified name.
+func (p *parser) nameParts() ([]string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	parts := []string{name}
+	for p.acceptSymbol(".") {
+		if name, err = p.ident(); err != nil {
+			return nil, err
+		}
+		parts = append(parts, name)
+	}
+	return parts, nil
+}
+
+// identList reads a parenthesized list of names.
+func (p *parser) identList() ([]string, error) {
+	elements, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(elements))
+	for _, element := range elements {
+		name, err := element.ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// list consumes a parenthesized list and returns a parser for each of its elements.
+func (p *parser) list() ([]*parser, error) {
+	open := p.next()
+	if !open.isSymbol("(") {
+		return nil, p.errorAt(open, "expected (, found %q", open.text)
+	}
+	end := p.closing()
+	if end == -1 {
+		return nil, p.errorAt(open, "unbalanced parentheses")
+	}
+	inner := &parser{file: p.file, src: p.src, tokens: p.tokens[p.pos:end], endLine: p.endLine}
+	p.pos = end + 1
+	return inner.split(), nil
+}
+
+// split returns a parser for each part of the remaining tokens between commas outside
+// parentheses, and consumes them.
+func (p *parser) split() []*parser {
+	var parts []*parser
+	start, depth := p.pos, 0
+	for ; p.pos <= len(p.tokens); p.pos++ {
+		if p.pos < len(p.tokens) {
+			t := p.tokens[p.pos]
+			switch {
+			case t.isSymbol("(") || t.isSymbol("["):
+				depth++
+				continue
+			case t.isSymbol(")") || t.isSymbol("]"):
+				depth--
+				continue
+			case !t.isSymbol(",") || depth > 0:
+				continue
+			}
+		}
+		parts = append(parts, &parser{file: p.file, src: p.src, tokens: p.tokens[start:p.pos], endLine: p.endLine})
+		start = p.pos + 1
+	}
+	p.pos = len(p.tokens)
+	return parts
+}
+
+// closing returns the index of the parenthesis that closes the one just consumed, or -1.
+func (p *parser) closing() int {
+	depth := 1
+	for i := p.pos; i < len(p.tokens); i++ {
+		switch {
+		case p.tokens[i].isSymbol("("):
+			depth++
+		case p.tokens[i].isSymbol(")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parenthesized consumes a parenthesized expression and returns it as written, without
+// the parentheses.
+func (p *parser) parenthesized() (string, error) {
+	open := p.next()
+	if !open.isSymbol("(") {
+		return "", p.errorAt(open, "expected (, found %q", open.text)
+	}
+	end := p.closing()
+	if end == -1 {
+		return "", p.errorAt(open, "unbalanced parentheses")
+	}
+	text := p.text(p.pos, end)
+	p.pos = end + 1
+	return text, nil
+}
+
+// modifier consumes the modifiers of a type, such as (10, 2), and returns them as
+// format_type lists them.
+func (p *parser) modifier() (string, error) {
+	text, err := p.parenthesized()
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(text), ""), nil
+}
+
+// expression consumes tokens up to the next clause of a column definition and returns
+// them as written.
+func (p *parser) expression() string {
+	start, depth := p.pos, 0
+	for ; !p.done(); p.pos++ {
+		t := p.tokens[p.pos]
+		switch {
+		case t.isSymbol("(") || t.isSymbol("["):
+			depth++
+		case t.isSymbol(")") || t.isSymbol("]"):
+			depth--
+		case depth == 0 && t.kind == tokenWord && constraintKeywords[t.text]:
+			return p.text(start, p.pos)
+		}
+	}
+	return p.text(start, p.pos)
+}
+
+// options reads a parenthesized list of storage parameters as array_to_string renders
+// reloptions.
+func (p *parser) options() (string, error) {
+	elements, err := p.list()
+	if err != nil {
+		return "", err
+	}
+	options := make([]string, 0, len(elements))
+	for _, element := range elements {
+		parts, err := element.nameParts()
+		if err != nil {
+			return "", err
+		}
+		option := strings.Join(parts, ".")
+		if element.acceptSymbol("=") {
+			value := element.next()
+			option += "=" + value.text
+		}
+		options = append(options, option)
+	}
+	return strings.Join(options, ", "), nil
+}
+
+// text returns the source of the tokens from index from up to index to.
+func (p *parser) text(from, to int) string {
+	if from >= to {
+		return ""
+	}
+	return p.src[p.tokens[from].start:p.tokens[to-1].end]
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	t := p.peek()
+	if p.done() && len(p.tokens) > 0 {
+		t = p.tokens[len(p.tokens)-1]
+	}
+	return p.errorAt(t, format, args...)
+}
+
+// errorAt reports an error at the line of t, or at the end of the statement for the empty
+// symbol that peek returns there.
+func (p *parser) errorAt(t token, format string, args ...any) error {
+	line := t.line
+	if line == 0 {
+		line = p.endLine
+	}
+	return errorAtLine(p.file, line, format, args...)
+}
+
+// errorAtLine formats errors of the lexer and the parser alike, as file:line: message.
+func errorAtLine(file string, line int, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", file, line, fmt.Sprintf(format, args...))
+}
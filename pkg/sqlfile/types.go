@@ -0,0 +1,190 @@
+package sqlfile
+
+import (
+	"fmt"
+	"strings"
+
+	"main/pkg/ddl"
+)
+
+// typeInfo is what pg_type holds about a type that the layout of a column depends on,
+// and the names information_schema.columns.data_type and format_type give it.
+type typeInfo struct {
+	dataType   string
+	typLen     int
+	typAlign   int
+	typStorage string
+
+	// formatName is the name format_type gives the type, when it differs from dataType.
+	formatName string
+	// defaultModifier is the type modifier a column of the type gets when none is given.
+	defaultModifier string
+}
+
+func (t typeInfo) format() string {
+	if t.formatName != "" {
+		return t.formatName
+	}
+	return t.dataType
+}
+
+// builtinTypes maps the names in pg_type of the built-in types a column can have to the
+// values a PostgreSQL 16 catalog holds for them.
+var builtinTypes = map[string]typeInfo{
+	"bool":          {dataType: "boolean", typLen: 1, typAlign: 1, typStorage: "p"},
+	"char":          {dataType: `"char"`, typLen: 1, typAlign: 1, typStorage: "p"},
+	"name":          {dataType: "name", typLen: 64, typAlign: 1, typStorage: "p"},
+	"int2":          {dataType: "smallint", typLen: 2, typAlign: 2, typStorage: "p"},
+	"int4":          {dataType: "integer", typLen: 4, typAlign: 4, typStorage: "p"},
+	"int8":          {dataType: "bigint", typLen: 8, typAlign: 8, typStorage: "p"},
+	"oid":           {dataType: "oid", typLen: 4, typAlign: 4, typStorage: "p"},
+	"xid":           {dataType: "xid", typLen: 4, typAlign: 4, typStorage: "p"},
+	"xid8":          {dataType: "xid8", typLen: 8, typAlign: 8, typStorage: "p"},
+	"cid":           {dataType: "cid", typLen: 4, typAlign: 4, typStorage: "p"},
+	"tid":           {dataType: "tid", typLen: 6, typAlign: 2, typStorage: "p"},
+	"regclass":      {dataType: "regclass", typLen: 4, typAlign: 4, typStorage: "p"},
+	"regtype":       {dataType: "regtype", typLen: 4, typAlign: 4, typStorage: "p"},
+	"regproc":       {dataType: "regproc", typLen: 4, typAlign: 4, typStorage: "p"},
+	"regconfig":     {dataType: "regconfig", typLen: 4, typAlign: 4, typStorage: "p"},
+	"float4":        {dataType: "real", typLen: 4, typAlign: 4, typStorage: "p"},
+	"float8":        {dataType: "double precision", typLen: 8, typAlign: 8, typStorage: "p"},
+	"money":         {dataType: "money", typLen: 8, typAlign: 8, typStorage: "p"},
+	"numeric":       {dataType: "numeric", typLen: -1, typAlign: 4, typStorage: "m"},
+	"text":          {dataType: "text", typLen: -1, typAlign: 4, typStorage: "x"},
+	"varchar":       {dataType: "character varying", typLen: -1, typAlign: 4, typStorage: "x"},
+	"bpchar":        {dataType: "character", typLen: -1, typAlign: 4, typStorage: "x", defaultModifier: "1"},
+	"bytea":         {dataType: "bytea", typLen: -1, typAlign: 4, typStorage: "x"},
+	"date":          {dataType: "date", typLen: 4, typAlign: 4, typStorage: "p"},
+	"time":          {dataType: "time without time zone", typLen: 8, typAlign: 8, typStorage: "p"},
+	"timetz":        {dataType: "time with time zone", typLen: 12, typAlign: 8, typStorage: "p"},
+	"timestamp":     {dataType: "timestamp without time zone", typLen: 8, typAlign: 8, typStorage: "p"},
+	"timestamptz":   {dataType: "timestamp with time zone", typLen: 8, typAlign: 8, typStorage: "p"},
+	"interval":      {dataType: "interval", typLen: 16, typAlign: 8, typStorage: "p"},
+	"uuid":          {dataType: "uuid", typLen: 16, typAlign: 1, typStorage: "p"},
+	"json":          {dataType: "json", typLen: -1, typAlign: 4, typStorage: "x"},
+	"jsonb":         {dataType: "jsonb", typLen: -1, typAlign: 4, typStorage: "x"},
+	"jsonpath":      {dataType: "jsonpath", typLen: -1, typAlign: 4, typStorage: "x"},
+	"xml":           {dataType: "xml", typLen: -1, typAlign: 4, typStorage: "x"},
+	"inet":          {dataType: "inet", typLen: -1, typAlign: 4, typStorage: "m"},
+	"cidr":          {dataType: "cidr", typLen: -1, typAlign: 4, typStorage: "m"},
+	"macaddr":       {dataType: "macaddr", typLen: 6, typAlign: 4, typStorage: "p"},
+	"macaddr8":      {dataType: "macaddr8", typLen: 8, typAlign: 4, typStorage: "p"},
+	"bit":           {dataType: "bit", typLen: -1, typAlign: 4, typStorage: "x", defaultModifier: "1"},
+	"varbit":        {dataType: "bit varying", typLen: -1, typAlign: 4, typStorage: "x"},
+	"point":         {dataType: "point", typLen: 16, typAlign: 8, typStorage: "p"},
+	"line":          {dataType: "line", typLen: 24, typAlign: 8, typStorage: "p"},
+	"lseg":          {dataType: "lseg", typLen: 32, typAlign: 8, typStorage: "p"},
+	"box":           {dataType: "box", typLen: 32, typAlign: 8, typStorage: "p"},
+	"path":          {dataType: "path", typLen: -1, typAlign: 8, typStorage: "x"},
+	"polygon":       {dataType: "polygon", typLen: -1, typAlign: 8, typStorage: "x"},
+	"circle":        {dataType: "circle", typLen: 24, typAlign: 8, typStorage: "p"},
+	"tsvector":      {dataType: "tsvector", typLen: -1, typAlign: 4, typStorage: "x"},
+	"tsquery":       {dataType: "tsquery", typLen: -1, typAlign: 4, typStorage: "p"},
+	"pg_lsn":        {dataType: "pg_lsn", typLen: 8, typAlign: 8, typStorage: "p"},
+	"txid_snapshot": {dataType: "txid_snapshot", typLen: -1, typAlign: 8, typStorage: "x"},
+	"pg_snapshot":   {dataType: "pg_snapshot", typLen: -1, typAlign: 8, typStorage: "x"},
+	"int4range":     {dataType: "int4range", typLen: -1, typAlign: 4, typStorage: "x"},
+	"int8range":     {dataType: "int8range", typLen: -1, typAlign: 8, typStorage: "x"},
+	"numrange":      {dataType: "numrange", typLen: -1, typAlign: 4, typStorage: "x"},
+	"daterange":     {dataType: "daterange", typLen: -1, typAlign: 4, typStorage: "x"},
+	"tsrange":       {dataType: "tsrange", typLen: -1, typAlign: 8, typStorage: "x"},
+	"tstzrange":     {dataType: "tstzrange", typLen: -1, typAlign: 8, typStorage: "x"},
+}
+
+// typeAliases maps the SQL standard and shorthand names of built-in types to their names
+// in pg_type, as the grammar does.
+var typeAliases = map[string]string{
+	"boolean":                     "bool",
+	"smallint":                    "int2",
+	"integer":                     "int4",
+	"int":                         "int4",
+	"bigint":                      "int8",
+	"real":                        "float4",
+	"double precision":            "float8",
+	"float":                       "float8",
+	"decimal":                     "numeric",
+	"dec":                         "numeric",
+	"character varying":           "varchar",
+	"char varying":                "varchar",
+	"character":                   "bpchar",
+	"bit varying":                 "varbit",
+	"time without time zone":      "time",
+	"time with time zone":         "timetz",
+	"timestamp without time zone": "timestamp",
+	"timestamp with time zone":    "timestamptz",
+}
+
+// extensionTypes maps well-known extensions to the layout of the column types they
+// create, as their scripts declare it.
+var extensionTypes = map[string]map[string]typeInfo{
+	"citext":  {"citext": {dataType: "USER-DEFINED", typLen: -1, typAlign: 4, typStorage: "x"}},
+	"hstore":  {"hstore": {dataType: "USER-DEFINED", typLen: -1, typAlign: 4, typStorage: "x"}},
+	"ltree":   {"ltree": {dataType: "USER-DEFINED", typLen: -1, typAlign: 4, typStorage: "x"}, "lquery": {dataType: "USER-DEFINED", typLen: -1, typAlign: 4, typStorage: "x"}},
+	"isn":     {"isbn": {dataType: "USER-DEFINED", typLen: 8, typAlign: 8, typStorage: "p"}, "ean13": {dataType: "USER-DEFINED", typLen: 8, typAlign: 8, typStorage: "p"}},
+	"postgis": {"geometry": {dataType: "USER-DEFINED", typLen: -1, typAlign: 8, typStorage: "m"}, "geography": {dataType: "USER-DEFINED", typLen: -1, typAlign: 8, typStorage: "m"}},
+}
+
+// serialTypes are the pseudo-types that create an integer column with a sequence default.
+var serialTypes = map[string]string{
+	"smallserial": "int2",
+	"serial2":     "int2",
+	"serial":      "int4",
+	"serial4":     "int4",
+	"bigserial":   "int8",
+	"serial8":     "int8",
+}
+
+// typeName is the name format_type gives a type created in schema, which it qualifies
+// unless the schema is on the default search path.
+func typeName(schema, name string) string {
+	if schema == defaultSchema {
+		return ddl.QuoteIdent(name)
+	}
+	return ddl.QualifiedName(schema, name)
+}
+
+// columnType is a type as written for a column, resolved against the type registry.
+type columnType struct {
+	info     typeInfo
+	modifier string
+	array    bool
+	serial   bool
+}
+
+// dataType is the name information_schema.columns.data_type gives the column.
+func (t columnType) dataType() string {
+	if t.array {
+		return "ARRAY"
+	}
+	return t.info.dataType
+}
+
+// formatted renders the type as format_type does, with its modifier and array marker.
+func (t columnType) formatted() string {
+	name := t.info.format()
+	modifier := t.modifier
+	if modifier == "" {
+		modifier = t.info.defaultModifier
+	}
+	if modifier != "" {
+		// format_type puts the precision of time types before their time zone.
+		if base, zone, found := strings.Cut(name, " with"); found && strings.HasPrefix(name, "time") {
+			name = fmt.Sprintf("%s(%s) with%s", base, modifier, zone)
+		} else {
+			name = fmt.Sprintf("%s(%s)", name, modifier)
+		}
+	}
+	if t.array {
+		name += "[]"
+	}
+	return name
+}
+
+// layout returns the typlen, typalign and typstorage of the column's type. Arrays are
+// varlenas aligned like their elements, with at least int alignment.
+func (t columnType) layout() (int, int, string) {
+	if t.array {
+		return -1, max(t.info.typAlign, 4), "x"
+	}
+	return t.info.typLen, t.info.typAlign, t.info.typStorage
+}
@@ -0,0 +1,52 @@
+package sqlfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnType(t *testing.T) {
+	tests := []struct {
+		definition string
+		formatted  string
+		dataType   string
+		typLen     int
+		typAlign   int
+	}{
+		{"int", "integer", "integer", 4, 4},
+		{"double precision", "double precision", "double precision", 8, 8},
+		{"float(20)", "real", "real", 4, 4},
+		{"float", "double precision", "double precision", 8, 8},
+		{"char", "character(1)", "character", -1, 4},
+		{`"char"`, `"char"`, `"char"`, 1, 1},
+		{"character varying(30)", "character varying(30)", "character varying", -1, 4},
+		{"numeric(10, 2)", "numeric(10,2)", "numeric", -1, 4},
+		{"time(6) without time zone", "time(6) without time zone", "time without time zone", 8, 8},
+		{"timetz", "time with time zone", "time with time zone", 12, 8},
+		{"interval day to second", "interval", "interval", 16, 8},
+		{"pg_catalog.int8", "bigint", "bigint", 8, 8},
+		{"smallint[][]", "smallint[]", "ARRAY", -1, 4},
+		{"bigint ARRAY[4]", "bigint[]", "ARRAY", -1, 8},
+		{"uuid", "uuid", "uuid", 16, 1},
+	}
+
+	for _, test := range tests {
+		statements, err := tokenize("", test.definition)
+		if err != nil {
+			t.Fatalf("tokenize(%q) failed: %v", test.definition, err)
+		}
+		p := &parser{src: test.definition, tokens: statements[0]}
+		columnType, err := NewCatalog().columnType(p, defaultSchema)
+		if err != nil {
+			t.Fatalf("columnType(%q) failed: %v", test.definition, err)
+		}
+
+		typLen, typAlign, _ := columnType.layout()
+		assert.Equal(t, test.formatted, columnType.formatted(), test.definition)
+		assert.Equal(t, test.dataType, columnType.dataType(), test.definition)
+		assert.Equal(t, test.typLen, typLen, test.definition)
+		assert.Equal(t, test.typAlign, typAlign, test.definition)
+		assert.True(t, p.done(), test.definition)
+	}
+}
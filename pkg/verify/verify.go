@@ -0,0 +1,284 @@
+package verify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"main/pkg/common"
+	"main/pkg/ddl"
+	"main/pkg/layout"
+)
+
+const (
+	DefaultRangeSize     = 100000
+	DefaultSizeTolerance = 0.1
+)
+
+// Tables names the original and rebuilt tables, both qualified, with the primary key they
+// are split into ranges by and the columns whose values are compared.
+type Tables struct {
+	Original  string
+	Rebuilt   string
+	Key       []common.ColumnInfo
+	Columns   []string
+	RangeSize int
+}
+
+// Range is a primary key range after Start up to and including End, where a nil Start is
+// the start of the table and a nil End its end, with the rows each table has in it and
+// their hash.
+type Range struct {
+	Start        []string
+	End          []string
+	OriginalRows int64
+	RebuiltRows  int64
+	OriginalHash string
+	RebuiltHash  string
+}
+
+func (r Range) Matches() bool {
+	return r.OriginalRows == r.RebuiltRows && r.OriginalHash == r.RebuiltHash
+}
+
+type Result struct {
+	OriginalRows int64
+	RebuiltRows  int64
+	Ranges       []Range
+}
+
+func (r Result) Mismatches() []Range {
+	var mismatches []Range
+	for _, rng := range r.Ranges {
+		if !rng.Matches() {
+			mismatches = append(mismatches, rng)
+		}
+	}
+	return mismatches
+}
+
+// Size compares the heap of the rebuilt table with the size the analyzer predicts for it.
+type Size struct {
+	Predicted int64
+	Actual    int64
+}
+
+// Deviation is how far the actual size is from the prediction, as a fraction of it.
+func (s Size) Deviation() float64 {
+	if s.Predicted == 0 {
+		if s.Actual == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(float64(s.Actual-s.Predicted)) / float64(s.Predicted)
+}
+
+// Columns returns the names of the original table's columns when the rebuilt table has
+// the same ones, in whatever order, and otherwise an error listing the differences.
+func Columns(original, rebuilt []common.ColumnInfo) ([]string, error) {
+	remaining := map[string]bool{}
+	for _, col := range rebuilt {
+		remaining[col.ColumnName] = true
+	}
+
+	var names, missing []string
+	for _, col := range original {
+		names = append(names, col.ColumnName)
+		if !remaining[col.ColumnName] {
+			missing = append(missing, col.ColumnName)
+		}
+		delete(remaining, col.ColumnName)
+	}
+
+	var extra []string
+	for name := range remaining {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+
+	if len(missing) > 0 || len(extra) > 0 {
+		return nil, fmt.Errorf("columns differ: missing from the rebuilt table: [%s], only in the rebuilt table: [%s]", strings.Join(missing, ", "), strings.Join(extra, ", "))
+	}
+	return names, nil
+}
+
+// PredictedSize is the heap size the analyzer expects for rows rows of the original
+// table's columns, with their statistics, laid out in the rebuilt table's order.
+func PredictedSize(original []common.ColumnInfo, order []string, rows int64, options string) int64 {
+	tupleSize := layout.Expected(ddl.ReorderByName(original, order)).TupleSize
+	return layout.HeapSize(rows, tupleSize, layout.FillFactor(options))
+}
+
+// BoundariesQuery selects every RangeSize-th primary key of the original table as text.
+func BoundariesQuery(tables Tables) string {
+	keyList := keyColumns(tables.Key)
+	text := make([]string, len(tables.Key))
+	for i, col := range tables.Key {
+		text[i] = ddl.QuoteIdent(col.ColumnName) + "::text"
+	}
+
+	return fmt.Sprintf("SELECT %s\nFROM (SELECT %s, row_number() OVER (ORDER BY %s) AS n FROM %s) keys\nWHERE n %% %d = 0\nORDER BY %s",
+		strings.Join(text, ", "), keyList, keyList, tables.Original, tables.RangeSize, keyList)
+}
+
+// HashQuery counts the rows of table in a key range and sums a 64-bit hash of each,
+// which does not depend on the order the rows are read in. The columns are listed by
+// name, so the hash does not depend on their position in the table either. The range
+// starts after the key in the first parameters and ends at the key in the next, either
+// all NULL to leave that side open.
+func HashQuery(table string, tables Tables) string {
+	keyList := keyColumns(tables.Key)
+	after := make([]string, len(tables.Key))
+	upTo := make([]string, len(tables.Key))
+	for i, col := range tables.Key {
+		after[i] = fmt.Sprintf("$%d::%s", i+1, col.FormattedType)
+		upTo[i] = fmt.Sprintf("$%d::%s", len(tables.Key)+i+1, col.FormattedType)
+	}
+
+	columns := make([]string, len(tables.Columns))
+	for i, name := range tables.Columns {
+		columns[i] = ddl.QuoteIdent(name)
+	}
+
+	return fmt.Sprintf("SELECT count(*), COALESCE(sum(('x' || left(md5(row(%s)::text), 16))::bit(64)::bigint), 0)::text\nFROM %s\nWHERE (%s IS NULL OR (%s) > (%s))\n    AND (%s IS NULL OR (%s) <= (%s))",
+		strings.Join(columns, ", "), table, after[0], keyList, strings.Join(after, ", "), upTo[0], keyList, strings.Join(upTo, ", "))
+}
+
+// Compare counts and hashes both tables range by range in one snapshot.
+func Compare(ctx context.Context, connection *sql.DB, tables Tables) (Result, error) {
+	if tables.RangeSize <= 0 {
+		tables.RangeSize = DefaultRangeSize
+	}
+
+	tx, err := connection.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	boundaries, err := queryBoundaries(ctx, tx, tables)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	originalQuery, rebuiltQuery := HashQuery(tables.Original, tables), HashQuery(tables.Rebuilt, tables)
+	var start []string
+	for i := 0; i <= len(boundaries); i++ {
+		rng := Range{Start: start}
+		if i < len(boundaries) {
+			rng.End = boundaries[i]
+		}
+
+		args := append(keyArgs(rng.Start, len(tables.Key)), keyArgs(rng.End, len(tables.Key))...)
+		if err := tx.QueryRowContext(ctx, originalQuery, args...).Scan(&rng.OriginalRows, &rng.OriginalHash); err != nil {
+			return Result{}, fmt.Errorf("failed to hash %s: %w", tables.Original, err)
+		}
+		if err := tx.QueryRowContext(ctx, rebuiltQuery, args...).Scan(&rng.RebuiltRows, &rng.RebuiltHash); err != nil {
+			return Result{}, fmt.Errorf("failed to hash %s: %w", tables.Rebuilt, err)
+		}
+
+		result.OriginalRows += rng.OriginalRows
+		result.RebuiltRows += rng.RebuiltRows
+		result.Ranges = append(result.Ranges, rng)
+		start = rng.End
+	}
+
+	return result, tx.Commit()
+}
+
+func queryBoundaries(ctx context.Context, tx *sql.Tx, tables Tables) ([][]string, error) {
+	rows, err := tx.QueryContext(ctx, BoundariesQuery(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to split %s into ranges: %w", tables.Original, err)
+	}
+	defer rows.Close()
+
+	var boundaries [][]string
+	for rows.Next() {
+		boundary := make([]string, len(tables.Key))
+		dest := make([]interface{}, len(boundary))
+		for i := range boundary {
+			dest[i] = &boundary[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan range boundary: %w", err)
+		}
+		boundaries = append(boundaries, boundary)
+	}
+	return boundaries, rows.Err()
+}
+
+func keyArgs(key []string, length int) []interface{} {
+	args := make([]interface{}, length)
+	for i := range key {
+		args[i] = key[i]
+	}
+	return args
+}
+
+// Write reports the comparison and whether the size is within tolerance of the
+// prediction. It returns false when anything does not match.
+func Write(out io.Writer, tables Tables, result Result, size Size, tolerance float64) bool {
+	ok := true
+
+	fmt.Fprintf(out, "Rows: %s has %d, %s has %d.\n", tables.Original, result.OriginalRows, tables.Rebuilt, result.RebuiltRows)
+	ok = ok && result.OriginalRows == result.RebuiltRows
+
+	mismatches := result.Mismatches()
+	fmt.Fprintf(out, "Ranges: %d compared by primary key (%s), %d mismatching.\n", len(result.Ranges), strings.Join(columnNames(tables.Key), ", "), len(mismatches))
+	for _, rng := range mismatches {
+		fmt.Fprintf(out, "  %s: %s has %d rows with hash %s, %s has %d rows with hash %s\n",
+			formatRange(rng), tables.Original, rng.OriginalRows, rng.OriginalHash, tables.Rebuilt, rng.RebuiltRows, rng.RebuiltHash)
+	}
+	ok = ok && len(mismatches) == 0
+
+	verdict := "within"
+	if size.Deviation() > tolerance {
+		verdict = "outside"
+		ok = false
+	}
+	fmt.Fprintf(out, "Size: %s is %d B on disk, %d B predicted, %.1f%% off, %s the %.0f%% tolerance.\n",
+		tables.Rebuilt, size.Actual, size.Predicted, 100*size.Deviation(), verdict, 100*tolerance)
+
+	return ok
+}
+
+func formatRange(rng Range) string {
+	start, end := "start", "end"
+	if rng.Start != nil {
+		start = formatKey(rng.Start)
+	}
+	if rng.End != nil {
+		end = formatKey(rng.End)
+	}
+	return fmt.Sprintf("(%s, %s]", start, end)
+}
+
+func formatKey(key []string) string {
+	if len(key) == 1 {
+		return key[0]
+	}
+	return "(" + strings.Join(key, ", ") + ")"
+}
+
+func keyColumns(key []common.ColumnInfo) string {
+	names := columnNames(key)
+	for i := range names {
+		names[i] = ddl.QuoteIdent(names[i])
+	}
+	return strings.Join(names, ", ")
+}
+
+func columnNames(columns []common.ColumnInfo) []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.ColumnName
+	}
+	return names
+}
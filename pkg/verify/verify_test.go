@@ -0,0 +1,111 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"main/pkg/common"
+	"main/pkg/layout"
+)
+
+var tables = Tables{
+	Original:  "public.orders_old",
+	Rebuilt:   "public.orders",
+	Key:       []common.ColumnInfo{{ColumnName: "id", FormattedType: "bigint"}},
+	Columns:   []string{"id", "note", "total"},
+	RangeSize: 2,
+}
+
+func TestColumns(t *testing.T) {
+	original := []common.ColumnInfo{{ColumnName: "id"}, {ColumnName: "note"}, {ColumnName: "total"}}
+
+	names, err := Columns(original, []common.ColumnInfo{{ColumnName: "total"}, {ColumnName: "id"}, {ColumnName: "note"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "note", "total"}, names)
+
+	_, err = Columns(original, []common.ColumnInfo{{ColumnName: "total"}, {ColumnName: "id"}, {ColumnName: "notes"}})
+	assert.EqualError(t, err, "columns differ: missing from the rebuilt table: [note], only in the rebuilt table: [notes]")
+}
+
+func TestPredictedSize(t *testing.T) {
+	original := []common.ColumnInfo{
+		{ColumnName: "flag", TypLen: 1, TypAlign: 1, IsNullable: "NO"},
+		{ColumnName: "id", TypLen: 8, TypAlign: 8, IsNullable: "NO"},
+	}
+
+	// id then flag: a 24 byte header and 9 bytes of data, 40 bytes once aligned.
+	assert.Equal(t, layout.HeapSize(1000, 40, 100), PredictedSize(original, []string{"id", "flag"}, 1000, ""))
+	assert.Equal(t, layout.HeapSize(1000, 40, 70), PredictedSize(original, []string{"id", "flag"}, 1000, "autovacuum_enabled=false, fillfactor=70"))
+}
+
+func TestQueries(t *testing.T) {
+	assert.Equal(t, `SELECT id::text
+FROM (SELECT id, row_number() OVER (ORDER BY id) AS n FROM public.orders_old) keys
+WHERE n % 2 = 0
+ORDER BY id`, BoundariesQuery(tables))
+
+	assert.Equal(t, `SELECT count(*), COALESCE(sum(('x' || left(md5(row(id, note, total)::text), 16))::bit(64)::bigint), 0)::text
+FROM public.orders
+WHERE ($1::bigint IS NULL OR (id) > ($1::bigint))
+    AND ($2::bigint IS NULL OR (id) <= ($2::bigint))`, HashQuery("public.orders", tables))
+}
+
+func TestCompare(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New failed: %v", err)
+	}
+	defer db.Close()
+
+	hash := func(table string) string {
+		return regexp.QuoteMeta("FROM " + table + "\nWHERE")
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("row_number() OVER (ORDER BY id)")).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("2"))
+	mock.ExpectQuery(hash("public.orders_old")).WithArgs(nil, "2").WillReturnRows(sqlmock.NewRows([]string{"count", "hash"}).AddRow(2, "17"))
+	mock.ExpectQuery(hash("public.orders")).WithArgs(nil, "2").WillReturnRows(sqlmock.NewRows([]string{"count", "hash"}).AddRow(2, "17"))
+	mock.ExpectQuery(hash("public.orders_old")).WithArgs("2", nil).WillReturnRows(sqlmock.NewRows([]string{"count", "hash"}).AddRow(1, "5"))
+	mock.ExpectQuery(hash("public.orders")).WithArgs("2", nil).WillReturnRows(sqlmock.NewRows([]string{"count", "hash"}).AddRow(1, "6"))
+	mock.ExpectCommit()
+
+	result, err := Compare(context.Background(), db, tables)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, int64(3), result.OriginalRows)
+	assert.Equal(t, int64(3), result.RebuiltRows)
+	assert.Equal(t, []Range{{Start: []string{"2"}, OriginalRows: 1, RebuiltRows: 1, OriginalHash: "5", RebuiltHash: "6"}}, result.Mismatches())
+}
+
+func TestWrite(t *testing.T) {
+	result := Result{
+		OriginalRows: 3,
+		RebuiltRows:  2,
+		Ranges: []Range{
+			{End: []string{"2"}, OriginalRows: 2, RebuiltRows: 2, OriginalHash: "17", RebuiltHash: "17"},
+			{Start: []string{"2"}, OriginalRows: 1, RebuiltRows: 0, OriginalHash: "5", RebuiltHash: "0"},
+		},
+	}
+
+	var out bytes.Buffer
+	ok := Write(&out, tables, result, Size{Predicted: 8192 * 100, Actual: 8192 * 104}, DefaultSizeTolerance)
+
+	assert.False(t, ok)
+	assert.Equal(t, "Rows: public.orders_old has 3, public.orders has 2.\n"+
+		"Ranges: 2 compared by primary key (id), 1 mismatching.\n"+
+		"  (2, end]: public.orders_old has 1 rows with hash 5, public.orders has 0 rows with hash 0\n"+
+		"Size: public.orders is 851968 B on disk, 819200 B predicted, 4.0% off, within the 10% tolerance.\n", out.String())
+}
+
+func TestWrite_Matching(t *testing.T) {
+	result := Result{OriginalRows: 2, RebuiltRows: 2, Ranges: []Range{{OriginalRows: 2, RebuiltRows: 2, OriginalHash: "17", RebuiltHash: "17"}}}
+
+	var out bytes.Buffer
+	assert.True(t, Write(&out, tables, result, Size{Predicted: 8192, Actual: 8192}, DefaultSizeTolerance))
+	assert.False(t, Write(&out, tables, result, Size{Predicted: 8192, Actual: 16384}, DefaultSizeTolerance))
+}